@@ -263,4 +263,260 @@ CREATE TABLE contract_receipt_checksum(
 	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	checksum VARCHAR(32)
-);
\ No newline at end of file
+);
+
+CREATE TABLE notification_outbox(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	contract_id INT,
+	gateway VARCHAR(16) NOT NULL,
+	recipients VARCHAR(1024) NOT NULL,
+	message VARCHAR(1024) NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+	attempts INT NOT NULL DEFAULT 0,
+	last_error VARCHAR(512),
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	next_attempt_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	sent_at DATETIME,
+	FOREIGN KEY (contract_id) REFERENCES contract(id),
+	INDEX (status, next_attempt_at)
+);
+
+CREATE TABLE contract_receipt_financial(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	contract_receipt_id INT NOT NULL UNIQUE,
+	recovery_status_id INT NOT NULL,
+	doubtful BOOLEAN NOT NULL,
+	capital_provisioned DECIMAL(13, 2) NOT NULL DEFAULT 0,
+	FOREIGN KEY (contract_receipt_id) REFERENCES contract_receipt(id),
+	FOREIGN KEY (recovery_status_id) REFERENCES recovery_status(id)
+);
+
+CREATE TABLE contract_receipt_reversal(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	contract_receipt_id INT NOT NULL UNIQUE,
+	user_id INT NOT NULL,
+	transaction_id INT NOT NULL,
+	datetime DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	reason VARCHAR(512) NOT NULL,
+	FOREIGN KEY (contract_receipt_id) REFERENCES contract_receipt(id),
+	FOREIGN KEY (user_id) REFERENCES user(id),
+	FOREIGN KEY (transaction_id) REFERENCES transaction(id)
+);
+
+/* Debit notes raised from the pending default interest of a contract when
+   a receipt is issued, reversed with the receipt */
+CREATE TABLE contract_receipt_default(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	contract_receipt_id INT NOT NULL,
+	contract_schedule_id INT NOT NULL,
+	amount DECIMAL(13, 2) NOT NULL,
+	FOREIGN KEY (contract_receipt_id) REFERENCES contract_receipt(id),
+	FOREIGN KEY (contract_schedule_id) REFERENCES contract_schedule(id)
+);
+
+INSERT INTO state (name, contract_type_id)
+SELECT 'Settled', CT.id FROM contract_type CT;
+
+CREATE TABLE contract_reschedule(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	contract_id INT NOT NULL,
+	user_id INT NOT NULL,
+	transaction_id INT NOT NULL,
+	datetime DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	capital DECIMAL(13, 2) NOT NULL,
+	closed_interest DECIMAL(13, 2) NOT NULL,
+	interest DECIMAL(13, 2) NOT NULL,
+	rate DECIMAL(6, 2) NOT NULL,
+	installments INT NOT NULL,
+	installment_interval INT NOT NULL,
+	method VARCHAR(8) NOT NULL,
+	initiation_date DATE NOT NULL,
+	FOREIGN KEY (contract_id) REFERENCES contract(id),
+	FOREIGN KEY (user_id) REFERENCES user(id),
+	FOREIGN KEY (transaction_id) REFERENCES transaction(id)
+);
+
+CREATE TABLE contract_reschedule_schedule(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	contract_reschedule_id INT NOT NULL,
+	contract_schedule_id INT NOT NULL UNIQUE,
+	capital DECIMAL(13, 2) NOT NULL,
+	interest DECIMAL(13, 2) NOT NULL,
+	installment DECIMAL(13, 2) NOT NULL,
+	marketed_capital DECIMAL(13, 2) NOT NULL,
+	marketed_interest DECIMAL(13, 2) NOT NULL,
+	FOREIGN KEY (contract_reschedule_id) REFERENCES contract_reschedule(id),
+	FOREIGN KEY (contract_schedule_id) REFERENCES contract_schedule(id)
+);
+
+CREATE TABLE eod_run(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	run_date DATE NOT NULL UNIQUE,
+	status VARCHAR(16) NOT NULL DEFAULT 'PENDING',
+	rentals_posted INT NOT NULL DEFAULT 0,
+	status_changes INT NOT NULL DEFAULT 0,
+	defaults_accrued INT NOT NULL DEFAULT 0,
+	default_amount DECIMAL(13, 2) NOT NULL DEFAULT 0,
+	rentals_done BOOLEAN NOT NULL DEFAULT 0,
+	defaults_done BOOLEAN NOT NULL DEFAULT 0,
+	started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	completed_at DATETIME,
+	last_error VARCHAR(512)
+);
+
+CREATE TABLE contract_default_accrual(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	eod_run_id INT NOT NULL,
+	contract_id INT NOT NULL,
+	arrears DECIMAL(13, 2) NOT NULL,
+	days INT NOT NULL,
+	amount DECIMAL(13, 2) NOT NULL,
+	UNIQUE (eod_run_id, contract_id),
+	FOREIGN KEY (eod_run_id) REFERENCES eod_run(id),
+	FOREIGN KEY (contract_id) REFERENCES contract(id)
+);
+
+CREATE TABLE role_permission(
+	role VARCHAR(32) NOT NULL,
+	permission VARCHAR(32) NOT NULL,
+	PRIMARY KEY (role, permission)
+);
+
+/* Permissions of each role. Finance operations are kept apart: journal
+   entries belong to accountants, and rebates, reversals, debit notes and
+   restructuring to managers. Users of a type not listed here are granted
+   nothing */
+INSERT INTO role_permission (role, permission) VALUES
+	('manager', 'receipts'),
+	('manager', 'receipt_reversal'),
+	('manager', 'rebates'),
+	('manager', 'restructuring'),
+	('manager', 'debit_notes'),
+	('manager', 'request_approval'),
+	('manager', 'recovery'),
+	('manager', 'reporting'),
+	('accountant', 'accounting'),
+	('accountant', 'reporting'),
+	('cashier', 'receipts'),
+	('recovery_officer', 'receipts'),
+	('recovery_officer', 'recovery'),
+	('auditor', 'reporting');
+
+/* Existing user types are mapped to the roles. The previous type is kept in
+   legacy_type so that the mapping can be reviewed or undone */
+ALTER TABLE user
+ADD legacy_type VARCHAR(32);
+
+UPDATE user SET legacy_type = type;
+
+UPDATE user SET type = CASE LOWER(TRIM(type))
+	WHEN 'admin' THEN 'manager'
+	WHEN 'administrator' THEN 'manager'
+	WHEN 'manager' THEN 'manager'
+	WHEN 'branch manager' THEN 'manager'
+	WHEN 'accountant' THEN 'accountant'
+	WHEN 'accounts' THEN 'accountant'
+	WHEN 'finance' THEN 'accountant'
+	WHEN 'cashier' THEN 'cashier'
+	WHEN 'front office' THEN 'cashier'
+	WHEN 'officer' THEN 'recovery_officer'
+	WHEN 'recovery officer' THEN 'recovery_officer'
+	WHEN 'recovery_officer' THEN 'recovery_officer'
+	WHEN 'credit officer' THEN 'recovery_officer'
+	WHEN 'field officer' THEN 'recovery_officer'
+	WHEN 'auditor' THEN 'auditor'
+	WHEN 'audit' THEN 'auditor'
+	ELSE type
+END;
+
+/* Users left without a role after the mapping */
+SELECT U.id, U.username, U.legacy_type
+FROM user U
+WHERE U.type NOT IN (SELECT DISTINCT role FROM role_permission);
+
+CREATE TABLE user_session(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	user_id INT NOT NULL,
+	refresh_token CHAR(64) NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	revoked_at DATETIME,
+	replaced_by INT,
+	INDEX (user_id, revoked_at),
+	FOREIGN KEY (user_id) REFERENCES user(id)
+);
+
+CREATE TABLE user_audit(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	actor_id INT NOT NULL,
+	user_id INT NOT NULL,
+	action VARCHAR(32) NOT NULL,
+	detail VARCHAR(255),
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX (user_id),
+	FOREIGN KEY (actor_id) REFERENCES user(id),
+	FOREIGN KEY (user_id) REFERENCES user(id)
+);
+
+/* User administration is granted to managers, a role of the permission
+   matrix above. Grant user_admin to other roles as required */
+INSERT INTO role_permission (role, permission) VALUES ('manager', 'user_admin');
+
+CREATE TABLE login_attempt(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	username VARCHAR(64) NOT NULL,
+	ip VARCHAR(45) NOT NULL,
+	user_id INT,
+	success BOOLEAN NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX (username, created_at),
+	INDEX (ip, created_at),
+	FOREIGN KEY (user_id) REFERENCES user(id)
+);
+
+CREATE TABLE login_throttle(
+	scope VARCHAR(16) NOT NULL,
+	subject VARCHAR(64) NOT NULL,
+	failures INT NOT NULL DEFAULT 0,
+	last_failure DATETIME NOT NULL,
+	locked_until DATETIME,
+	PRIMARY KEY (scope, subject)
+);
+
+CREATE TABLE user_totp(
+	user_id INT NOT NULL PRIMARY KEY,
+	secret VARCHAR(64) NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT 0,
+	last_step BIGINT NOT NULL DEFAULT 0,
+	enabled_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES user(id)
+);
+
+CREATE TABLE user_recovery_code(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	user_id INT NOT NULL,
+	code CHAR(64) NOT NULL,
+	used_at DATETIME,
+	UNIQUE (user_id, code),
+	FOREIGN KEY (user_id) REFERENCES user(id)
+);
+
+/* Loan products define the terms offered per contract type. Contract
+   types without a product keep the method answered on the contract */
+CREATE TABLE loan_product(
+	id INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	contract_type_id INT NOT NULL UNIQUE,
+	name VARCHAR(64) NOT NULL,
+	method VARCHAR(8) NOT NULL,
+	min_rate DECIMAL(6, 2) NOT NULL DEFAULT 0,
+	max_rate DECIMAL(6, 2) NOT NULL DEFAULT 0,
+	min_installments INT NOT NULL DEFAULT 1,
+	max_installments INT NOT NULL DEFAULT 0,
+	installment_interval INT NOT NULL DEFAULT 0,
+	min_capital DECIMAL(13, 2) NOT NULL DEFAULT 0,
+	max_capital DECIMAL(13, 2) NOT NULL DEFAULT 0,
+	max_grace_periods INT NOT NULL DEFAULT 0,
+	document_fee DECIMAL(13, 2) NOT NULL DEFAULT 0,
+	processing_fee_rate DECIMAL(6, 2) NOT NULL DEFAULT 0,
+	FOREIGN KEY (contract_type_id) REFERENCES contract_type(id)
+);
@@ -6,16 +6,21 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
+	"github.com/ssrdive/cidium/pkg/forms"
 	"github.com/ssrdive/cidium/pkg/loan"
 	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/totp"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -30,47 +35,129 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req authenticateRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	username := r.PostForm.Get("username")
-	password := r.PostForm.Get("password")
+	username, password := req.Username, req.Password
+	ip := clientIP(r)
+
+	wait, err := app.login.Attempt(username, ip)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		app.clientError(w, http.StatusTooManyRequests)
+		return
+	}
 
 	u, err := app.user.Get(username, password)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			err = app.login.Record(username, ip, 0, false)
+			if err != nil {
+				app.modelError(w, err)
+				return
+			}
 			app.notFound(w)
 		} else {
-			app.serverError(w, err)
+			app.modelError(w, err)
 		}
 		return
 	}
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
+	if u.TOTP {
+		if req.TOTP == "" {
+			err = app.login.Release(username, ip)
+			if err != nil {
+				app.modelError(w, err)
+				return
+			}
+			app.totpChallenge(w)
+			return
+		}
 
-	claims["username"] = u.Username
-	claims["name"] = u.Name
-	claims["exp"] = time.Now().Add(time.Minute * 180).Unix()
+		err = app.user.VerifyTOTP(u.ID, req.TOTP)
+		if errors.Is(err, models.ErrInvalidTOTP) {
+			err = app.login.Record(username, ip, u.ID, false)
+			if err != nil {
+				app.modelError(w, err)
+				return
+			}
+			app.totpChallenge(w)
+			return
+		} else if err != nil {
+			app.modelError(w, err)
+			return
+		}
+	}
 
-	ts, err := token.SignedString(app.secret)
+	err = app.login.Record(username, ip, u.ID, true)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
-	user := models.UserResponse{u.ID, u.Username, u.Name, u.Type, ts, u.AccessKeys}
-	js, err := json.Marshal(user)
+	sid, refreshToken, err := app.user.CreateSession(u.ID)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(js)
+	app.writeSession(w, u, sid, refreshToken)
+}
+
+func (app *application) authenticateRefresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	uid, sid, refreshToken, err := app.user.RotateSession(req.RefreshToken)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	u, err := app.user.GetByID(uid)
+	if errors.Is(err, models.ErrNoRecord) {
+		app.modelError(w, models.ErrInvalidRefreshToken)
+		return
+	} else if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	app.writeSession(w, u, sid, refreshToken)
+}
+
+func (app *application) logout(w http.ResponseWriter, r *http.Request) {
+	var req logoutRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	user := app.extractUser(r)
+	if req.All {
+		err = app.user.RevokeSessions(user.ID)
+	} else {
+		err = app.user.RevokeSession(user.ID, user.SessionID)
+	}
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *application) dropdownHandler(w http.ResponseWriter, r *http.Request) {
@@ -81,12 +168,18 @@ func (app *application) dropdownHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	items, err := app.dropdown.Get(name)
-	if err != nil {
+	q, ok := dropdownQuery(r)
+	if !ok {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
+	items, err := app.dropdown.Get(name, q)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(items)
 
@@ -168,12 +261,18 @@ func (app *application) dropdownConditionHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	items, err := app.dropdown.ConditionGet(name, where, value)
-	if err != nil {
+	q, ok := dropdownQuery(r)
+	if !ok {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
+	items, err := app.dropdown.ConditionGet(name, where, value, q)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(items)
 
@@ -189,36 +288,37 @@ func (app *application) dropdownConditionAccountsHandler(w http.ResponseWriter,
 		return
 	}
 
-	items, err := app.dropdown.ConditionAccountsGet(name, where, value)
-	if err != nil {
+	q, ok := dropdownQuery(r)
+	if !ok {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
+	items, err := app.dropdown.ConditionAccountsGet(name, where, value, q)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(items)
 
 }
 
 func (app *application) newAccountCategory(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req accountCategoryRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
+	app.setFormUser(r, "user_id")
 
 	requiredParams := []string{"sub_account_id", "user_id", "account_id", "name"}
 	optionalParams := []string{"datetime"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
 	id, err := app.account.CreateCategory(requiredParams, optionalParams, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -226,25 +326,19 @@ func (app *application) newAccountCategory(w http.ResponseWriter, r *http.Reques
 }
 
 func (app *application) newAccount(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req accountRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
+	app.setFormUser(r, "user_id")
 
 	requiredParams := []string{"account_category_id", "user_id", "account_id", "name"}
 	optionalParams := []string{"datetime"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
 	id, err := app.account.CreateAccount(requiredParams, optionalParams, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -252,25 +346,18 @@ func (app *application) newAccount(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) newContract(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req contractRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
+	app.setFormUser(r, "user_id")
 
 	requiredParams := []string{"external", "user_id", "introducing_officer_id", "credit_officer_id", "recovery_officer_id", "contract_type_id", "institute_dealer_id", "contract_batch_id", "model_id", "chassis_number", "customer_nic", "customer_name", "customer_address", "customer_contact", "price"}
 	optionalParams := []string{"institute_id", "liaison_name", "liaison_contact", "liaison_comment", "downpayment"}
 
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	ctidStr := r.PostForm.Get("contract_type_id")
-	ctid, _ := strconv.Atoi(ctidStr)
+	ctid := req.ContractTypeID
 
 	var id int64
 
@@ -281,7 +368,7 @@ func (app *application) newContract(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -289,39 +376,23 @@ func (app *application) newContract(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) newLegacyContract(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req legacyContractRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
+	app.setFormUser(r, "user_id")
 
 	requiredContractParams := []string{"user_id", "recovery_officer_id", "contract_type_id", "institute_dealer_id", "contract_batch_id", "model_id", "chassis_number", "customer_nic", "customer_name", "customer_address", "customer_contact", "price"}
-	requiredLoanParams := []string{"capital", "rate", "installments", "installment_interval", "method", "initiation_date"}
-	requiredParams := append(requiredContractParams, requiredLoanParams...)
 	optionalParams := []string{"institute_id", "liaison_name", "liaison_contact", "liaison_comment", "downpayment"}
 
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	ctidStr := r.PostForm.Get("contract_type_id")
-	ctid, _ := strconv.Atoi(ctidStr)
-
-	id, err := app.contract.Insert("Active", ctid, requiredContractParams, optionalParams, r.PostForm)
+	id, err := app.contract.Legacy(requiredContractParams, optionalParams, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
-	err = app.contract.Legacy(int(id), r.PostForm)
-	if err != nil {
-		app.serverError(w, err)
-	}
-
 	fmt.Fprintf(w, "%d", id)
 }
 
@@ -333,7 +404,7 @@ func (app *application) searchContractOld(w http.ResponseWriter, r *http.Request
 
 	results, err := app.contract.SearchOld(search, state, officer, batch)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -347,7 +418,7 @@ func (app *application) journalEntryAudit(w http.ResponseWriter, r *http.Request
 
 	results, err := app.account.JournalEntriesForAudit(entrydate, postingdate)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -361,7 +432,7 @@ func (app *application) pnlSummary(w http.ResponseWriter, r *http.Request) {
 
 	results, err := app.account.AccountsForPNL(startDate, endDate)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -374,7 +445,7 @@ func (app *application) balanceSheetSummary(w http.ResponseWriter, r *http.Reque
 
 	results, err := app.account.BalanceSheetSummary(postingdate)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -387,7 +458,7 @@ func (app *application) accountBalancesForReporting(w http.ResponseWriter, r *ht
 
 	results, err := app.account.AccountBalancesForReporting(postingdate)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -410,7 +481,7 @@ func (app *application) searchContractV2(w http.ResponseWriter, r *http.Request)
 
 	results, err := app.contract.SearchV2(searchType, search, state, officer, batch, npl, lkas17, external, startOd, endOd, legalCaseStatus)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -429,7 +500,7 @@ func (app *application) lkas17SearchContractV2(w http.ResponseWriter, r *http.Re
 
 	results, err := app.contract.LKAS17SearchV2(searchType, search, state, officer, batch, recoveryStatus, legalCaseStatus)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -456,7 +527,7 @@ func (app *application) receiptSearch(w http.ResponseWriter, r *http.Request) {
 
 	results, err := app.reporting.ReceiptSearch(startDate, endDate, officer)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -486,7 +557,7 @@ func (app *application) performanceReview(w http.ResponseWriter, r *http.Request
 
 	results, err := app.contract.PerformanceReview(startDate, endDate, state, officer, batch, npl)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -502,7 +573,7 @@ func (app *application) searchContract(w http.ResponseWriter, r *http.Request) {
 
 	results, err := app.contract.Search(search, state, officer, batch)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -517,7 +588,7 @@ func (app *application) csqaSearchContract(w http.ResponseWriter, r *http.Reques
 
 	results, err := app.contract.CSQASearch(search, question, empty)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -535,7 +606,7 @@ func (app *application) accountTransaction(w http.ResponseWriter, r *http.Reques
 
 	ledger, err := app.account.Transaction(tid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -553,7 +624,7 @@ func (app *application) accountLedger(w http.ResponseWriter, r *http.Request) {
 
 	ledger, err := app.account.Ledger(aid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -571,7 +642,7 @@ func (app *application) workDocuments(w http.ResponseWriter, r *http.Request) {
 
 	wds, err := app.contract.WorkDocuments(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -589,7 +660,7 @@ func (app *application) workQuestions(w http.ResponseWriter, r *http.Request) {
 
 	wqs, err := app.contract.WorkQuestions(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -607,7 +678,7 @@ func (app *application) contractQuestions(w http.ResponseWriter, r *http.Request
 
 	qs, err := app.contract.Questions(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -625,7 +696,7 @@ func (app *application) contractDocuments(w http.ResponseWriter, r *http.Request
 
 	ds, err := app.contract.Documents(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -643,7 +714,7 @@ func (app *application) contractHistory(w http.ResponseWriter, r *http.Request)
 
 	h, err := app.contract.History(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -652,26 +723,19 @@ func (app *application) contractHistory(w http.ResponseWriter, r *http.Request)
 }
 
 func (app *application) contractAnswer(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req contractAnswerRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
-
-	requiredParams := []string{"contract_state_id", "question_id", "user_id", "answer"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
+	app.setFormUser(r, "user_id")
 
 	t := time.Now()
 	r.PostForm.Set("created", t.Format("2006-01-02 15:04:05"))
 	id, err := app.contract.StateAnswer([]string{"contract_state_id", "question_id", "user_id", "created", "answer"}, []string{}, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -679,38 +743,30 @@ func (app *application) contractAnswer(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) contractDocument(w http.ResponseWriter, r *http.Request) {
-	maxSize := int64(5120000)
-	err := r.ParseMultipartForm(maxSize)
+	var req contractDocumentRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
-
-	requiredParams := []string{"contract_state_id", "document_id", "user_id"}
-	for _, param := range requiredParams {
-		if v := r.FormValue(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
+	app.setFormUser(r, "user_id")
 
 	file, fileHeader, err := r.FormFile("source")
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, models.NewFieldError(map[string]string{"source": "is required"}))
 		return
 	}
 	defer file.Close()
 
 	s, err := app.getS3Session(app.s3endpoint, app.s3region)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
 	fileName, err := app.uploadFileToS3(s, file, fileHeader)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -722,7 +778,7 @@ func (app *application) contractDocument(w http.ResponseWriter, r *http.Request)
 
 	id, err := app.contract.StateDocument([]string{"contract_state_id", "document_id", "user_id", "created", "s3bucket", "s3region", "source"}, []string{}, r.Form)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -740,20 +796,20 @@ func (app *application) contractDocumentDownload(w http.ResponseWriter, r *http.
 
 	sess, err := app.getS3Session(fmt.Sprintf("%s.digitaloceanspaces.com", region), region)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
 	s3c := s3.New(sess)
 	output, err := s3c.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(source)})
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
 	buff, err := ioutil.ReadAll(output.Body)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -773,7 +829,7 @@ func (app *application) contractDetailFinancial(w http.ResponseWriter, r *http.R
 
 	cdfs, err := app.contract.DetailFinancial(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -792,7 +848,7 @@ func (app *application) contractDetailFinancialRaw(w http.ResponseWriter, r *htt
 
 	cdfs, err := app.contract.DetailFinancialRaw(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -811,7 +867,7 @@ func (app *application) contractDetailLegacyFinancialRaw(w http.ResponseWriter,
 
 	cdfs, err := app.contract.DetailLegacyFinancialRaw(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -829,7 +885,7 @@ func (app *application) contractDetails(w http.ResponseWriter, r *http.Request)
 
 	cds, err := app.contract.Detail(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -847,7 +903,7 @@ func (app *application) contractInstallments(w http.ResponseWriter, r *http.Requ
 
 	installments, err := app.contract.Installment(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -865,7 +921,7 @@ func (app *application) contractReceiptsV2(w http.ResponseWriter, r *http.Reques
 
 	receipts, err := app.contract.ReceiptsV2(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -883,7 +939,7 @@ func (app *application) contractFloatReceipts(w http.ResponseWriter, r *http.Req
 
 	receipts, err := app.contract.FloatReceipts(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -901,7 +957,7 @@ func (app *application) contractReceipts(w http.ResponseWriter, r *http.Request)
 
 	receipts, err := app.contract.Receipts(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -920,7 +976,7 @@ func (app *application) contractOfficerReceipts(w http.ResponseWriter, r *http.R
 
 	receipts, err := app.contract.OfficerReceipts(oid, date)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -938,7 +994,7 @@ func (app *application) contractMicroLoanDetails(w http.ResponseWriter, r *http.
 
 	docs, err := app.contract.MicroLoanDetails(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -956,7 +1012,7 @@ func (app *application) contractStateDocGen(w http.ResponseWriter, r *http.Reque
 
 	docs, err := app.contract.DocGen(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -975,7 +1031,7 @@ func (app *application) contractRequestability(w http.ResponseWriter, r *http.Re
 	// Check if a request current exists for the contract current state
 	requestExists, err := app.contract.CurrentRequestExists(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -993,13 +1049,13 @@ func (app *application) contractRequestability(w http.ResponseWriter, r *http.Re
 
 	wds, err := app.contract.WorkDocuments(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
 	wqs, err := app.contract.WorkQuestions(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1030,13 +1086,13 @@ func (app *application) contractRequestability(w http.ResponseWriter, r *http.Re
 
 	ts, err := app.contract.TransionableStates(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
 	rr, err := app.contract.RejectedRequests(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1052,24 +1108,17 @@ func (app *application) contractRequestability(w http.ResponseWriter, r *http.Re
 }
 
 func (app *application) contractRequest(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req contractStateRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
-
-	requiredParams := []string{"contract_id", "state_id", "user_id"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
+	app.setFormUser(r, "user_id")
 
 	rid, err := app.contract.Request([]string{"contract_id", "state_id"}, []string{}, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1087,7 +1136,7 @@ func (app *application) contractSeasonalIncentive(w http.ResponseWriter, r *http
 
 	amt, err := app.contract.SeasonalIncentive(user)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1106,7 +1155,7 @@ func (app *application) contractRequests(w http.ResponseWriter, r *http.Request)
 
 	rs, err := app.contract.Requests(user)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1115,47 +1164,33 @@ func (app *application) contractRequests(w http.ResponseWriter, r *http.Request)
 }
 
 func (app *application) contractRequestAction(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req requestActionRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"request", "user", "action"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	user, err := strconv.Atoi(r.PostForm.Get("user"))
-	request, err := strconv.Atoi(r.PostForm.Get("request"))
-	action := r.PostForm.Get("action")
-	note := r.PostForm.Get("note")
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
+	user := app.extractUser(r).ID
+	request, action, note := req.Request, req.Action, req.Note
 
 	if action == "1" {
 		name, err := app.contract.RequestName(request)
 		if err != nil {
-			app.serverError(w, err)
+			app.modelError(w, err)
 			return
 		}
 		if name == "Contract Initiated" {
 			err := app.contract.InitiateContract(user, request)
 			if err != nil {
-				app.serverError(w, err)
+				app.modelError(w, err)
 				return
 			}
 		}
 		if name == "Credit Worthiness Approved" {
-			err := app.contract.CreditWorthinessApproved(user, request, app.aAPIKey)
+			err := app.contract.CreditWorthinessApproved(user, request)
 			if err != nil {
-				app.serverError(w, err)
+				app.modelError(w, err)
 				return
 			}
 		}
@@ -1163,7 +1198,7 @@ func (app *application) contractRequestAction(w http.ResponseWriter, r *http.Req
 
 	c, err := app.contract.RequestAction(user, request, action, note)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1171,32 +1206,16 @@ func (app *application) contractRequestAction(w http.ResponseWriter, r *http.Req
 }
 
 func (app *application) contractCommitmentAction(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req commitmentActionRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"id", "fulfilled", "user"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	id, err := strconv.Atoi(r.PostForm.Get("id"))
-	fulfilled, err := strconv.Atoi(r.PostForm.Get("fulfilled"))
-	user, err := strconv.Atoi(r.PostForm.Get("user"))
+	ca, err := app.contract.CommitmentAction(req.ID, req.Fulfilled, app.extractUser(r).ID)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-
-	ca, err := app.contract.CommitmentAction(id, fulfilled, user)
-	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1204,80 +1223,166 @@ func (app *application) contractCommitmentAction(w http.ResponseWriter, r *http.
 }
 
 func (app *application) deleteAnswer(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req deleteAnswerRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"id", "table"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
 	d, err := app.contract.DeleteStateInfo(r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 	fmt.Fprintf(w, "%v", d)
 }
 
+func (app *application) loanProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := app.contract.Products()
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
 func (app *application) contractCalculation(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	capital, err := strconv.ParseFloat(vars["capital"], 32)
-	rate, err := strconv.ParseFloat(vars["rate"], 32)
-	installments, err := strconv.Atoi(vars["installments"])
-	installmentInterval, err := strconv.Atoi(vars["installmentInterval"])
-	initiationDate := vars["initiationDate"]
-	structuredMonthlyRental, err := strconv.Atoi(vars["structuredMonthlyRental"])
-	method := vars["method"]
+	calculation, err := app.calculation(r)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	marketedSchedule, _, err := loan.Create(capital, rate, installments, installmentInterval, structuredMonthlyRental, initiationDate, method)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calculation)
+}
+
+// contractCalculationLegacy serves the marketed schedule alone, as returned
+// before calculations were disclosed
+func (app *application) contractCalculationLegacy(w http.ResponseWriter, r *http.Request) {
+	calculation, err := app.calculation(r)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
+	marketedSchedule := make([]loan.Installment, len(calculation.Marketed.Lines))
+	for i, l := range calculation.Marketed.Lines {
+		marketedSchedule[i] = loan.Installment{Capital: l.Capital, Interest: l.Interest, DueDate: l.DueDate}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(marketedSchedule)
 }
 
-func (app *application) contractLKAS17LegacyRebate(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+// calculation calculates the terms of the query, or of the path of the
+// legacy route
+func (app *application) calculation(r *http.Request) (loan.Calculation, error) {
+	values := r.URL.Query()
+	for k, v := range mux.Vars(r) {
+		values.Set(k, v)
+	}
+
+	return app.calculate(values)
+}
+
+func (app *application) calculate(values url.Values) (loan.Calculation, error) {
+	var req calculationRequest
+	err := forms.DecodeValues(values, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		return loan.Calculation{}, err
+	}
+
+	terms, err := req.terms()
+	if err != nil {
+		return loan.Calculation{}, err
+	}
+
+	return app.contract.Calculate(req.ContractTypeID, req.Method, terms)
+}
+
+// maxScenarios is the number of calculations compared by a request
+const maxScenarios = 10
+
+type comparison struct {
+	Calculation   loan.Calculation    `json:"calculation"`
+	Affordability *loan.Affordability `json:"affordability,omitempty"`
+}
+
+func (app *application) contractCalculationCompare(w http.ResponseWriter, r *http.Request) {
+	var req compareRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"user_id", "cid", "amount"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
+	var scenarios []map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(req.Scenarios))
+	dec.UseNumber()
+	err = dec.Decode(&scenarios)
+	if err != nil || len(scenarios) == 0 || len(scenarios) > maxScenarios {
+		app.modelError(w, models.NewFieldError(map[string]string{"scenarios": fmt.Sprintf("must be a list of 1 to %d calculations", maxScenarios)}))
+		return
+	}
+
+	comparisons := make([]comparison, len(scenarios))
+	errs := map[string]string{}
+	for i, scenario := range scenarios {
+		values := url.Values{}
+		for k, v := range r.PostForm {
+			if k != "scenarios" && k != "monthlyIncome" {
+				values[k] = v
+			}
+		}
+		for k, v := range forms.Values(scenario) {
+			values[k] = v
+		}
+
+		calculation, err := app.calculate(values)
+		var e *models.Error
+		if errors.As(err, &e) && len(e.Fields) > 0 {
+			for field, msg := range e.Fields {
+				errs[fmt.Sprintf("scenarios.%d.%s", i, field)] = msg
+			}
+			continue
+		} else if errors.Is(err, models.ErrUnsupportedMethod) {
+			errs[fmt.Sprintf("scenarios.%d.method", i)] = "is not a supported interest method"
+			continue
+		} else if err != nil {
+			app.modelError(w, err)
 			return
 		}
+
+		comparisons[i].Calculation = calculation
+		if req.MonthlyIncome > 0 {
+			a := calculation.Affordability(req.MonthlyIncome, app.repayRatio)
+			comparisons[i].Affordability = &a
+		}
+	}
+	if len(errs) > 0 {
+		app.modelError(w, models.NewFieldError(errs))
+		return
 	}
 
-	user_id, err := strconv.Atoi(r.PostForm.Get("user_id"))
-	cid, err := strconv.Atoi(r.PostForm.Get("cid"))
-	amount, err := strconv.ParseFloat(r.PostForm.Get("amount"), 32)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparisons)
+}
+
+func (app *application) contractLKAS17LegacyRebate(w http.ResponseWriter, r *http.Request) {
+	var req amountRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	rid, err := app.contract.LKAS17Rebate(user_id, cid, amount)
+	rid, err := app.contract.LKAS17Rebate(app.extractUser(r).ID, req.CID, req.Amount)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1285,94 +1390,93 @@ func (app *application) contractLKAS17LegacyRebate(w http.ResponseWriter, r *htt
 }
 
 func (app *application) contractLegacyRebate(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req amountRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"user_id", "cid", "amount"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
+	rid, err := app.contract.LegacyRebate(app.extractUser(r).ID, req.CID, req.Amount)
+	if err != nil {
+		app.modelError(w, err)
+		return
 	}
 
-	user_id, err := strconv.Atoi(r.PostForm.Get("user_id"))
-	cid, err := strconv.Atoi(r.PostForm.Get("cid"))
-	amount, err := strconv.ParseFloat(r.PostForm.Get("amount"), 32)
+	fmt.Fprintf(w, "%v", rid)
+}
+
+func (app *application) contractReceipt(w http.ResponseWriter, r *http.Request) {
+	var req receiptRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	rid, err := app.contract.LegacyRebate(user_id, cid, amount)
+	rid, err := app.contract.Receipt(app.extractUser(r).ID, req.CID, req.Amount, req.Notes, req.DueDate, req.Checksum)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
 	fmt.Fprintf(w, "%v", rid)
 }
 
-func (app *application) contractReceipt(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+func (app *application) contractReceiptPreview(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cid, err := strconv.Atoi(vars["cid"])
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	amount, err := money.Parse(vars["amount"])
+	if err != nil || amount <= 0 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
-	requiredParams := []string{"user_id", "cid", "amount"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
+	preview, err := app.contract.ReceiptPreview(app.extractUser(r).ID, cid, amount)
+	if err != nil {
+		app.modelError(w, err)
+		return
 	}
 
-	user_id, err := strconv.Atoi(r.PostForm.Get("user_id"))
-	cid, err := strconv.Atoi(r.PostForm.Get("cid"))
-	amount, err := strconv.ParseFloat(r.PostForm.Get("amount"), 32)
-	notes := r.PostForm.Get("notes")
-	due_date := r.PostForm.Get("due_date")
-	checksum := r.PostForm.Get("checksum")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+func (app *application) contractReceiptReverse(w http.ResponseWriter, r *http.Request) {
+	var req receiptReverseRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	rid, err := app.contract.Receipt(user_id, cid, amount, notes, due_date, app.rAPIKey, app.aAPIKey, app.aAPIPass, app.runtimeEnv, checksum)
+	tid, err := app.contract.ReverseReceipt(app.extractUser(r).ID, req.RID, req.Reason)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
-	fmt.Fprintf(w, "%v", rid)
+	fmt.Fprintf(w, "%v", tid)
 }
 
 func (app *application) contractDebitNote(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req debitNoteRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
+	app.setFormUser(r, "user_id")
 
 	requiredParams := []string{"contract_id", "contract_installment_type_id", "capital"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
 	r.PostForm.Set("due_date", time.Now().Format("2006-01-02 15:04:05"))
 	dnid, err := app.contract.DebitNote(requiredParams, []string{"due_date"}, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1380,25 +1484,18 @@ func (app *application) contractDebitNote(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) contractSetLegalCaseStatus(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req legalCaseStatusRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
 	requiredParams := []string{"contract_id", "legal_case_status"}
 	optionalParams := []string{}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
 	comid, err := app.contract.SetLegalCaseStatus(requiredParams, optionalParams, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1406,25 +1503,18 @@ func (app *application) contractSetLegalCaseStatus(w http.ResponseWriter, r *htt
 }
 
 func (app *application) contractSetTemporaryOfficer(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req temporaryOfficerRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
 	requiredParams := []string{"contract_id", "temporary_officer"}
 	optionalParams := []string{}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
 	comid, err := app.contract.SetTemporaryOfficer(requiredParams, optionalParams, r.PostForm)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1432,38 +1522,32 @@ func (app *application) contractSetTemporaryOfficer(w http.ResponseWriter, r *ht
 }
 
 func (app *application) contractCommitment(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req commitmentRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
+	app.setFormUser(r, "user_id")
 
 	requiredParams := []string{"user_id", "contract_id", "text"}
 	optionalParams := []string{"due_date", "created", "commitment"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
 	t := time.Now()
 	r.PostForm.Set("created", t.Format("2006-01-02 15:04:05"))
-	if r.PostForm.Get("due_date") == "" {
+	if req.DueDate == "" {
 		r.PostForm.Set("commitment", "0")
 	} else {
 		r.PostForm.Set("commitment", "1")
 	}
 
 	specialMessage := "0"
-	if r.PostForm.Get("special_message") == "1" {
+	if req.SpecialMessage {
 		specialMessage = "1"
 	}
 
-	comid, err := app.contract.Commitment(requiredParams, optionalParams, r.PostForm, specialMessage, app.aAPIKey)
+	comid, err := app.contract.Commitment(requiredParams, optionalParams, r.PostForm, specialMessage)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1480,7 +1564,7 @@ func (app *application) contractTemporaryAssignment(w http.ResponseWriter, r *ht
 
 	commitments, err := app.contract.TemporaryAssignment(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1498,7 +1582,7 @@ func (app *application) contractLegalCaseStatus(w http.ResponseWriter, r *http.R
 
 	commitments, err := app.contract.LegalCaseStatus(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1516,7 +1600,7 @@ func (app *application) contractTimeline(w http.ResponseWriter, r *http.Request)
 
 	commitments, err := app.contract.Timeline(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1534,7 +1618,7 @@ func (app *application) contractCommitments(w http.ResponseWriter, r *http.Reque
 
 	commitments, err := app.contract.Commitments(cid)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1542,12 +1626,30 @@ func (app *application) contractCommitments(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(commitments)
 }
 
+func (app *application) contractNotifications(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cid, err := strconv.Atoi(vars["cid"])
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	notifications, err := app.notification.Contract(cid)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notifications)
+}
+
 func (app *application) accountTrialBalance(w http.ResponseWriter, r *http.Request) {
 	postingdate := r.URL.Query().Get("postingdate")
 
 	accounts, err := app.account.TrialBalance(postingdate)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1558,7 +1660,7 @@ func (app *application) accountTrialBalance(w http.ResponseWriter, r *http.Reque
 func (app *application) accountChart(w http.ResponseWriter, r *http.Request) {
 	accounts, err := app.account.ChartOfAccounts()
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1567,24 +1669,16 @@ func (app *application) accountChart(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) accountPaymentVoucher(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req paymentVoucherRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"user_id", "posting_date", "from_account_id", "amount", "entries", "remark"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	tid, err := app.account.PaymentVoucher(r.PostForm.Get("user_id"), r.PostForm.Get("posting_date"), r.PostForm.Get("from_account_id"), r.PostForm.Get("amount"), r.PostForm.Get("entries"), r.PostForm.Get("remark"), r.PostForm.Get("due_date"), r.PostForm.Get("check_number"), r.PostForm.Get("payee"))
+	tid, err := app.account.PaymentVoucher(strconv.Itoa(app.extractUser(r).ID), req.PostingDate, strconv.Itoa(req.FromAccountID), req.Amount.String(), req.Entries, req.Remark, req.DueDate, req.CheckNumber, req.Payee)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1592,24 +1686,16 @@ func (app *application) accountPaymentVoucher(w http.ResponseWriter, r *http.Req
 }
 
 func (app *application) accountDeposit(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req depositRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"user_id", "posting_date", "to_account_id", "amount", "entries", "remark"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	tid, err := app.account.Deposit(r.PostForm.Get("user_id"), r.PostForm.Get("posting_date"), r.PostForm.Get("to_account_id"), r.PostForm.Get("amount"), r.PostForm.Get("entries"), r.PostForm.Get("remark"))
+	tid, err := app.account.Deposit(strconv.Itoa(app.extractUser(r).ID), req.PostingDate, strconv.Itoa(req.ToAccountID), req.Amount.String(), req.Entries, req.Remark)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1617,24 +1703,16 @@ func (app *application) accountDeposit(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) accountJournalEntry(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req journalEntryRequest
+	err := forms.Decode(r, &req)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.modelError(w, err)
 		return
 	}
 
-	requiredParams := []string{"user_id", "posting_date", "remark", "entries"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
-			app.clientError(w, http.StatusBadRequest)
-			return
-		}
-	}
-
-	tid, err := app.account.JournalEntry(r.PostForm.Get("user_id"), r.PostForm.Get("posting_date"), r.PostForm.Get("remark"), r.PostForm.Get("entries"))
+	tid, err := app.account.JournalEntry(strconv.Itoa(app.extractUser(r).ID), req.PostingDate, req.Remark, req.Entries)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1652,7 +1730,7 @@ func (app *application) dashboardCommitmentsByOfficer(w http.ResponseWriter, r *
 
 	commitments, err := app.contract.DashboardCommitmentsByOfficer(ctype, officer)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1670,7 +1748,7 @@ func (app *application) dashboardCommitments(w http.ResponseWriter, r *http.Requ
 
 	commitments, err := app.contract.DashboardCommitments(ctype)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
@@ -1679,35 +1757,360 @@ func (app *application) dashboardCommitments(w http.ResponseWriter, r *http.Requ
 }
 
 func (app *application) contractReceiptLegacy(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	var req receiptRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	rid, err := app.contract.LegacyReceipt(app.extractUser(r).ID, req.CID, req.Amount, req.Notes)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "%v", rid)
+}
+
+func (app *application) contractReceiptImport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(forms.MaxMemory)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	results, err := app.contract.ImportReceipts(app.extractUser(r).ID, file)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func (app *application) contractSettlement(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cid, err := strconv.Atoi(vars["cid"])
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	requiredParams := []string{"user_id", "cid", "amount"}
-	for _, param := range requiredParams {
-		if v := r.PostForm.Get(param); v == "" {
-			fmt.Println(param)
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	quote, err := app.contract.SettlementQuote(cid, date)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+func (app *application) contractSettle(w http.ResponseWriter, r *http.Request) {
+	var req settleRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	settlement, err := app.contract.Settle(app.extractUser(r).ID, req.CID, req.Amount)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlement)
+}
+
+func (app *application) contractReschedule(w http.ResponseWriter, r *http.Request) {
+	var req rescheduleRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	initiationDate := req.InitiationDate
+	if initiationDate == "" {
+		initiationDate = time.Now().Format("2006-01-02")
+	}
+
+	rsid, err := app.contract.Reschedule(app.extractUser(r).ID, req.CID, req.Rate, req.Installments, req.InstallmentInterval, req.Method, initiationDate)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "%v", rsid)
+}
+
+func (app *application) eodRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 30
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
 			app.clientError(w, http.StatusBadRequest)
 			return
 		}
 	}
 
-	user_id, err := strconv.Atoi(r.PostForm.Get("user_id"))
-	cid, err := strconv.Atoi(r.PostForm.Get("cid"))
-	amount, err := strconv.ParseFloat(r.PostForm.Get("amount"), 32)
-	notes := r.PostForm.Get("notes")
+	runs, err := app.eod.Runs(limit)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+func (app *application) newUser(w http.ResponseWriter, r *http.Request) {
+	var req newUserRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	id, err := app.user.Insert(app.extractUser(r).ID, req.GroupID, req.Role, req.FirstName, req.MiddleName, req.LastName, req.CommonName, req.Password)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	fmt.Fprintf(w, "%d", id)
+}
+
+func (app *application) users(w http.ResponseWriter, r *http.Request) {
+	users, err := app.user.Users()
 	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func (app *application) userDisable(w http.ResponseWriter, r *http.Request) {
+	app.userSetDisabled(w, r, true)
+}
+
+func (app *application) userEnable(w http.ResponseWriter, r *http.Request) {
+	app.userSetDisabled(w, r, false)
+}
+
+func (app *application) userSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	var req userRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	user := app.extractUser(r)
+	if disabled && req.ID == user.ID {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	rid, err := app.contract.LegacyReceipt(user_id, cid, amount, notes)
+	err = app.user.SetDisabled(user.ID, req.ID, disabled)
 	if err != nil {
-		app.serverError(w, err)
+		app.modelError(w, err)
 		return
 	}
 
-	fmt.Fprintf(w, "%v", rid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req userPasswordResetRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	err = app.user.ResetPassword(app.extractUser(r).ID, req.ID, req.Password)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) userPassword(w http.ResponseWriter, r *http.Request) {
+	var req userPasswordRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	user := app.extractUser(r)
+	err = app.user.ChangePassword(user.ID, user.SessionID, req.CurrentPassword, req.Password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	} else if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) userAccessKeys(w http.ResponseWriter, r *http.Request) {
+	var req userAccessKeysRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	err = app.user.SetAccessKeys(app.extractUser(r).ID, req.ID, req.AccessKeys)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) userGroup(w http.ResponseWriter, r *http.Request) {
+	var req userGroupRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	err = app.user.SetGroup(app.extractUser(r).ID, req.ID, req.GroupID)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) userUnlock(w http.ResponseWriter, r *http.Request) {
+	var req userUnlockRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	err = app.user.Unlock(app.extractUser(r).ID, req.ID, req.IP)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// totpChallenge responds that a two-factor authentication code is required
+func (app *application) totpChallenge(w http.ResponseWriter) {
+	app.writeError(w, http.StatusUnauthorized, errorResponse{Code: "totp_required", Message: "Two-factor authentication code required"})
+}
+
+func (app *application) userTOTPEnrol(w http.ResponseWriter, r *http.Request) {
+	user := app.extractUser(r)
+	secret, err := app.user.EnrolTOTP(user.ID)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TOTPEnrolment{Secret: secret, URI: totp.URI(app.totpIssuer, user.Username, secret)})
+}
+
+func (app *application) userTOTPEnable(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	codes, err := app.user.EnableTOTP(app.extractUser(r).ID, req.Code)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(codes)
+}
+
+func (app *application) userTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	user := app.extractUser(r)
+	err = app.user.VerifyTOTP(user.ID, req.Code)
+	if errors.Is(err, models.ErrNoRecord) {
+		app.notFound(w)
+		return
+	} else if errors.Is(err, models.ErrInvalidTOTP) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	} else if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	err = app.user.DisableTOTP(user.ID)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) userTOTPReset(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	err := forms.Decode(r, &req)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	err = app.user.ResetTOTP(app.extractUser(r).ID, req.ID)
+	if err != nil {
+		app.modelError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
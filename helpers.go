@@ -2,11 +2,17 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"path/filepath"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -14,26 +20,205 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/globalsign/mgo/bson"
+	"github.com/ssrdive/cidium/pkg/models"
 )
 
+// errorResponse is the body of error responses
+type errorResponse struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
 func (app *application) serverError(w http.ResponseWriter, err error) {
 	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
 	app.errorLog.Output(2, trace)
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	app.writeError(w, http.StatusInternalServerError, errorResponse{Code: "internal_error", Message: http.StatusText(http.StatusInternalServerError)})
 }
 
 func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	app.writeError(w, status, errorResponse{Code: code, Message: http.StatusText(status)})
 }
 
 func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
 
-func (app *application) extractUser(r *http.Request) jwt.Claims {
+// modelError responds with the status and details of a domain error returned
+// by a model. Other errors are server errors
+func (app *application) modelError(w http.ResponseWriter, err error) {
+	var e *models.Error
+	if !errors.As(err, &e) {
+		app.serverError(w, err)
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch e.Kind {
+	case models.KindInvalid:
+		status = http.StatusBadRequest
+	case models.KindUnauthorized:
+		status = http.StatusUnauthorized
+	case models.KindForbidden:
+		status = http.StatusForbidden
+	case models.KindNotFound:
+		status = http.StatusNotFound
+	case models.KindConflict:
+		status = http.StatusConflict
+	case models.KindUnprocessable:
+		status = http.StatusUnprocessableEntity
+	}
+
+	app.writeError(w, status, errorResponse{Code: e.Code, Message: e.Message, Fields: e.Fields})
+}
+
+func (app *application) writeError(w http.ResponseWriter, status int, body errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// principal is the authenticated user a request acts as
+type principal struct {
+	ID          int
+	SessionID   int64
+	Username    string
+	Name        string
+	Permissions []string
+}
+
+// can reports whether the principal was granted a permission
+func (p principal) can(permission string) bool {
+	for _, perm := range p.Permissions {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// newPrincipal builds a principal from token claims
+func newPrincipal(claims jwt.MapClaims) (principal, bool) {
+	id, ok := claims["user_id"].(float64)
+	if !ok || id <= 0 {
+		return principal{}, false
+	}
+
+	sid, ok := claims["sid"].(float64)
+	if !ok || sid <= 0 {
+		return principal{}, false
+	}
+
+	p := principal{ID: int(id), SessionID: int64(sid)}
+	p.Username, _ = claims["username"].(string)
+	p.Name, _ = claims["name"].(string)
+	permissions, _ := claims["permissions"].([]interface{})
+	for _, perm := range permissions {
+		if perm, ok := perm.(string); ok {
+			p.Permissions = append(p.Permissions, perm)
+		}
+	}
+	return p, true
+}
+
+// writeSession responds with a signed access token for a session of the user
+// and its refresh token. Users who must use two-factor authentication but have
+// not enrolled are granted no permissions until they do
+func (app *application) writeSession(w http.ResponseWriter, u *models.JWTUser, sid int64, refreshToken string) {
+	enrol := !u.TOTP && app.totpRequired(u)
+	if enrol {
+		u.Permissions = []string{}
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+
+	claims["user_id"] = u.ID
+	claims["sid"] = sid
+	claims["username"] = u.Username
+	claims["name"] = u.Name
+	claims["permissions"] = u.Permissions
+	claims["exp"] = time.Now().Add(app.tokenTTL).Unix()
+
+	ts, err := token.SignedString(app.secret)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	user := models.UserResponse{u.ID, u.Username, u.Name, u.Type, ts, refreshToken, u.AccessKeys, u.Permissions, enrol}
+	js, err := json.Marshal(user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// totpRequired reports whether a user holds an access key that requires
+// two-factor authentication
+func (app *application) totpRequired(u *models.JWTUser) bool {
+	for _, a := range u.AccessKeys {
+		for _, key := range app.totpKeys {
+			if a.Level == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dropdownQuery reads the search and paging parameters of a dropdown request
+func dropdownQuery(r *http.Request) (models.DropdownQuery, bool) {
+	v := r.URL.Query()
+	q := models.DropdownQuery{Search: v.Get("q")}
+
+	var err error
+	if l := v.Get("limit"); l != "" {
+		q.Limit, err = strconv.Atoi(l)
+		if err != nil || q.Limit < 0 {
+			return q, false
+		}
+	}
+	if o := v.Get("offset"); o != "" {
+		q.Offset, err = strconv.Atoi(o)
+		if err != nil || q.Offset < 0 {
+			return q, false
+		}
+	}
+
+	return q, true
+}
+
+// clientIP returns the address of the client without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (app *application) extractUser(r *http.Request) principal {
 	ctx := r.Context()
-	return ctx.Value(contextKey("User")).(jwt.MapClaims)
+	return ctx.Value(contextKey("User")).(principal)
+}
+
+// setFormUser replaces a user field of a parsed form with the acting user so
+// that requests cannot act on behalf of another user
+func (app *application) setFormUser(r *http.Request, field string) {
+	id := strconv.Itoa(app.extractUser(r).ID)
+	if r.PostForm != nil {
+		r.PostForm.Set(field, id)
+	}
+	if r.Form != nil {
+		r.Form.Set(field, id)
+	}
 }
 
 func (app *application) getS3Session(endpoint, region string) (*session.Session, error) {
@@ -10,34 +10,55 @@ import (
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/ssrdive/cidium/pkg/loan"
 	"github.com/ssrdive/cidium/pkg/models/mysql"
+	"github.com/ssrdive/cidium/pkg/notify"
 	"github.com/ssrdive/scribe"
 )
 
 type application struct {
-	errorLog   *log.Logger
-	infoLog    *log.Logger
-	secret     []byte
-	s3id       string
-	s3secret   string
-	s3endpoint string
-	s3region   string
-	s3bucket   string
-	rAPIKey    string
-	aAPIKey    string
-	aAPIPass   string
-	runtimeEnv string
-	user       *mysql.UserModel
-	dropdown   *mysql.DropdownModel
-	contract   *mysql.ContractModel
-	account    *scribe.AccountModel
-	reporting  *mysql.ReportingModel
+	errorLog     *log.Logger
+	infoLog      *log.Logger
+	secret       []byte
+	tokenTTL     time.Duration
+	totpIssuer   string
+	totpKeys     []string
+	s3id         string
+	s3secret     string
+	s3endpoint   string
+	s3region     string
+	s3bucket     string
+	runtimeEnv   string
+	repayRatio   float64
+	user         *mysql.UserModel
+	login        *mysql.LoginModel
+	dropdown     *mysql.DropdownModel
+	contract     *mysql.ContractModel
+	notification *mysql.NotificationModel
+	eod          *mysql.EODModel
+	account      *scribe.AccountModel
+	reporting    *mysql.ReportingModel
 }
 
 func main() {
+	// cidium eod runs the day-end once and exits
+	eodCommand := len(os.Args) > 1 && os.Args[1] == "eod"
+	if eodCommand {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	addr := flag.String("addr", ":4000", "HTTP network address")
 	dsn := flag.String("dsn", "user:password@tcp(host)/database_name?parseTime=true", "MySQL data source name")
 	secret := flag.String("secret", "cidium", "Secret key for generating jwts")
+	tokenTTL := flag.Duration("tokenTTL", 180*time.Minute, "Lifetime of access tokens")
+	refreshTTL := flag.Duration("refreshTTL", 30*24*time.Hour, "Lifetime of refresh tokens")
+	totpIssuer := flag.String("totpIssuer", "Cidium", "Issuer shown by authenticator apps")
+	totpAccessKeys := flag.String("totpAccessKeys", "", "Comma separated access keys that require two-factor authentication")
+	dropdownTTL := flag.Duration("dropdownTTL", 0, "Time dropdowns are cached, disabled when zero. Changes to dropdown tables show once cached lists expire")
+	loginFailures := flag.Int("loginFailures", 5, "Failed logins of a username before it is locked")
+	loginIPFailures := flag.Int("loginIPFailures", 20, "Failed logins from an address before it is locked")
+	loginDelay := flag.Duration("loginDelay", time.Second, "Wait after a failed login, doubled on each further failure")
+	loginLockout := flag.Duration("loginLockout", 15*time.Minute, "Duration of a login lockout")
 	s3id := flag.String("id", "", "AWS S3 identification")
 	s3secret := flag.String("s3secret", "", "AWS S3 secret")
 	s3endpoint := flag.String("endpoint", "sgp1.digitaloceanspaces.com", "AWS S3 endpoint")
@@ -46,6 +67,16 @@ func main() {
 	rAPIKey := flag.String("rAPIKey", "", "Randeepa Text Message API Key")
 	aAPIKey := flag.String("aAPIKey", "", "Agrivest Text Message API User")
 	aAPIPass := flag.String("aAPIPass", "", "Agrivest Text Message API Password")
+	receiptRecipients := flag.String("receiptRecipients", "94768237192,94703524281,94768724555,94703524271,94703524420,94775607777", "Staff numbers copied on receipt messages")
+	approvalRecipients := flag.String("approvalRecipients", "768237192,703524330,703524420,775607777,703524300,703524333,703524408", "Staff numbers copied on credit worthiness approval messages")
+	devRecipients := flag.String("devRecipients", "94768237192", "Numbers that receive every message in dev runtime environment")
+	notifyInterval := flag.Duration("notifyInterval", 30*time.Second, "Interval between notification outbox deliveries")
+	notifyAttempts := flag.Int("notifyAttempts", 8, "Delivery attempts before a notification is marked failed")
+	eodAt := flag.String("eodAt", "", "Time of day (15:04) to run the day-end, disabled when empty")
+	eodDate := flag.String("date", "", "Day-end date for the eod command, defaults to today")
+	skipCalendar := flag.String("skipCalendar", loan.FestivalCalendar.String(), "Comma separated MM-DD:MM-DD windows weekly installments are not due in")
+	repayRatio := flag.Float64("repayRatio", 40, "Largest percentage of monthly income taken by the repayments of an affordable loan")
+	defaultRate := flag.Float64("defaultRate", 0, "Annual default interest rate accrued on arrears at day-end")
 	runtimeEnv := flag.String("renv", "prod", "Runtime environment mode")
 	logPath := flag.String("logpath", "/var/www/agrivest.app/logs/", "Path to create or alter log files")
 	flag.Parse()
@@ -68,26 +99,83 @@ func main() {
 
 	defer db.Close()
 
+	gateways := notify.Gateways{
+		Randeepa: notify.Dialog{URL: "https://richcommunication.dialog.lk/api/sms/inline/send.php", APIKey: *rAPIKey},
+		Agrivest: notify.Mobitel{URL: "https://msmsenterpriseapi.mobitel.lk/EnterpriseSMSV3/esmsproxy.php", Alias: "AGRIVEST", User: *aAPIKey, Password: *aAPIPass},
+		Approval: notify.Dialog{URL: "https://richcommunication.dialog.lk/api/sms/inline/send.php", APIKey: *aAPIKey},
+		Officer:  notify.Dialog{URL: "https://cpsolutions.dialog.lk/index.php/cbs/sms/send", APIKey: *aAPIKey},
+	}
+
+	recipients := notify.Recipients{
+		Receipt:  notify.ParseList(*receiptRecipients),
+		Approval: notify.ParseList(*approvalRecipients),
+	}
+	if *runtimeEnv == "dev" {
+		recipients.Redirect = notify.ParseList(*devRecipients)
+	}
+
+	calendar, err := loan.ParseCalendar(*skipCalendar)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	app := &application{
 		errorLog:   errorLog,
 		infoLog:    infoLog,
 		secret:     []byte(*secret),
+		tokenTTL:   *tokenTTL,
+		totpIssuer: *totpIssuer,
+		totpKeys:   notify.ParseList(*totpAccessKeys),
 		s3id:       *s3id,
 		s3secret:   *s3secret,
 		s3endpoint: *s3endpoint,
 		s3region:   *s3region,
 		s3bucket:   *s3bucket,
-		rAPIKey:    *rAPIKey,
-		aAPIKey:    *aAPIKey,
-		aAPIPass:   *aAPIPass,
 		runtimeEnv: *runtimeEnv,
-		user:       &mysql.UserModel{DB: db},
-		dropdown:   &mysql.DropdownModel{DB: db},
-		contract:   &mysql.ContractModel{DB: db, ReceiptLogger: receiptLog},
-		account:    &scribe.AccountModel{DB: db},
-		reporting:  &mysql.ReportingModel{DB: db},
+		repayRatio: *repayRatio,
+		user:       &mysql.UserModel{DB: db, RefreshTTL: *refreshTTL},
+		dropdown:   &mysql.DropdownModel{DB: db, CacheTTL: *dropdownTTL},
+		contract:   &mysql.ContractModel{DB: db, ReceiptLogger: receiptLog, Recipients: recipients, Calendar: calendar},
+		notification: &mysql.NotificationModel{
+			DB:          db,
+			Gateways:    gateways,
+			MaxAttempts: *notifyAttempts,
+			Backoff:     time.Minute,
+			MaxBackoff:  6 * time.Hour,
+		},
+		login: &mysql.LoginModel{
+			DB:            db,
+			MaxFailures:   *loginFailures,
+			MaxIPFailures: *loginIPFailures,
+			Delay:         *loginDelay,
+			Lockout:       *loginLockout,
+		},
+		eod:       &mysql.EODModel{DB: db, DefaultRate: *defaultRate},
+		account:   &scribe.AccountModel{DB: db},
+		reporting: &mysql.ReportingModel{DB: db},
+	}
+
+	if eodCommand {
+		date := *eodDate
+		if date == "" {
+			date = time.Now().Format("2006-01-02")
+		}
+		err = app.runEOD(date)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		return
+	}
+
+	if *eodAt != "" {
+		if _, err := time.Parse("15:04", *eodAt); err != nil {
+			errorLog.Fatal(err)
+		}
+		go app.scheduleEOD(*eodAt)
 	}
 
+	go app.deliverNotifications(*notifyInterval)
+
 	srv := &http.Server{
 		Addr:     *addr,
 		ErrorLog: errorLog,
@@ -99,6 +187,46 @@ func main() {
 	errorLog.Fatal(err)
 }
 
+// deliverNotifications periodically sends messages waiting in the notification outbox
+func (app *application) deliverNotifications(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := app.notification.Deliver(50); err != nil {
+			app.errorLog.Printf("NOTIFY %v", err)
+		}
+	}
+}
+
+// runEOD runs the day-end for a date and logs the outcome
+func (app *application) runEOD(date string) error {
+	run, err := app.eod.Run(date)
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("EOD %s %s rentals %d status changes %d defaults %d (%s)", run.RunDate, run.Status, run.RentalsPosted, run.StatusChanges, run.DefaultsAccrued, run.DefaultAmount)
+	return nil
+}
+
+// scheduleEOD runs the day-end every day at the given time of day
+func (app *application) scheduleEOD(at string) {
+	for {
+		now := time.Now()
+		t, _ := time.ParseInLocation("15:04", at, now.Location())
+		next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		time.Sleep(next.Sub(now))
+
+		if err := app.runEOD(next.Format("2006-01-02")); err != nil {
+			app.errorLog.Printf("EOD %v", err)
+		}
+	}
+}
+
 func openDB(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
@@ -11,6 +11,20 @@ import (
 
 type contextKey string
 
+// Permissions granted to roles through role_permission
+const (
+	permReceipts        = "receipts"
+	permReceiptReversal = "receipt_reversal"
+	permRebates         = "rebates"
+	permRestructuring   = "restructuring"
+	permDebitNotes      = "debit_notes"
+	permRequestApproval = "request_approval"
+	permRecovery        = "recovery"
+	permAccounting      = "accounting"
+	permReporting       = "reporting"
+	permUserAdmin       = "user_admin"
+)
+
 func secureHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
@@ -44,6 +58,17 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// deprecated marks the responses of a legacy path as deprecated in favour of
+// its successor
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) validateToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rt := r.Header.Get("Authorization")
@@ -70,10 +95,39 @@ func (app *application) validateToken(next http.Handler) http.Handler {
 			return
 		}
 
+		user, ok := newPrincipal(claims)
+		if !ok {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		active, err := app.user.SessionActive(user.SessionID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if !active {
+			app.clientError(w, http.StatusUnauthorized)
+			return
+		}
+
 		ctx := r.Context()
-		ctx = context.WithValue(ctx, contextKey("User"), claims)
+		ctx = context.WithValue(ctx, contextKey("User"), user)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requirePermission allows the request only if the token carries the permission.
+// It must be wrapped by validateToken
+func (app *application) requirePermission(permission string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.extractUser(r).can(permission) {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ssrdive/cidium/pkg/forms"
+)
+
+// The OpenAPI document is generated from apiRoutes and the request structs
+// they decode, so it cannot drift from the routes served
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIOperation struct {
+	Tags        []string                    `json:"tags,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    *[]map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool                      `json:"exclusiveMinimum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+}
+
+// newOpenAPIDocument describes the routes served under apiPrefix
+func newOpenAPIDocument(routes []apiRoute) *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Cidium API", Version: "1"},
+		Servers: []openAPIServer{{URL: apiPrefix}},
+		Paths:   map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: map[string]*openAPISchema{
+				"Error": {
+					Type:     "object",
+					Required: []string{"code", "message"},
+					Properties: map[string]*openAPISchema{
+						"code":    {Type: "string"},
+						"message": {Type: "string"},
+						"fields":  {Type: "object", AdditionalProperties: &openAPISchema{Type: "string"}},
+					},
+				},
+			},
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		Security: []map[string][]string{{"bearer": {}}},
+	}
+
+	for _, route := range routes {
+		if route.Path == "" {
+			continue
+		}
+
+		op := &openAPIOperation{
+			Tags:    []string{route.Tag},
+			Summary: route.Summary,
+			Responses: map[string]*openAPIResponse{
+				"2XX": {Description: "Success"},
+				"default": {Description: "Error", Content: map[string]openAPIMediaType{
+					"application/json": {Schema: &openAPISchema{Ref: "#/components/schemas/Error"}},
+				}},
+			},
+		}
+		if route.Public {
+			op.Security = &[]map[string][]string{}
+		}
+		if route.Permission != "" {
+			op.Description = "Requires the " + route.Permission + " permission."
+		}
+		if route.Legacy != "" {
+			desc := "Formerly " + route.Legacy + ", still served as a deprecated alias."
+			if op.Description != "" {
+				desc = op.Description + " " + desc
+			}
+			op.Description = desc
+		}
+
+		for _, name := range pathParams(route.Path) {
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: name, In: "path", Required: true, Schema: &openAPISchema{Type: "string"}})
+		}
+		for _, name := range route.Query {
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: name, In: "query", Schema: &openAPISchema{Type: "string"}})
+		}
+		if route.Params != nil {
+			for _, f := range forms.Fields(route.Params) {
+				_, required := f.Rule("required")
+				op.Parameters = append(op.Parameters, openAPIParameter{Name: f.Name, In: "query", Required: required, Schema: fieldSchema(f)})
+			}
+		}
+
+		if route.Body != nil || route.File != "" {
+			op.RequestBody = requestBody(doc, route)
+		}
+
+		if doc.Paths[route.Path] == nil {
+			doc.Paths[route.Path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+
+	return doc
+}
+
+// requestBody describes the body of a route. Bodies are accepted as JSON or
+// as forms, and as multipart forms by routes uploading a file
+func requestBody(doc *openAPIDocument, route apiRoute) *openAPIRequestBody {
+	if route.File != "" {
+		schema := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+		if route.Body != nil {
+			schema = structSchema(route.Body)
+		}
+		schema.Properties[route.File] = &openAPISchema{Type: "string", Format: "binary"}
+		schema.Required = append(schema.Required, route.File)
+
+		return &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+			"multipart/form-data": {Schema: schema},
+		}}
+	}
+
+	t := reflect.TypeOf(route.Body)
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	doc.Components.Schemas[name] = structSchema(route.Body)
+
+	ref := &openAPISchema{Ref: "#/components/schemas/" + name}
+	return &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+		"application/json":                  {Schema: ref},
+		"application/x-www-form-urlencoded": {Schema: ref},
+	}}
+}
+
+// structSchema describes a request struct from its form and validate tags
+func structSchema(body interface{}) *openAPISchema {
+	schema := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for _, f := range forms.Fields(body) {
+		schema.Properties[f.Name] = fieldSchema(f)
+		if _, ok := f.Rule("required"); ok {
+			schema.Required = append(schema.Required, f.Name)
+		}
+	}
+	return schema
+}
+
+func fieldSchema(f forms.Field) *openAPISchema {
+	s := &openAPISchema{}
+	numeric := true
+	switch {
+	case f.IsAmount():
+		s.Type, s.Format = "number", "decimal"
+	case f.Type.Kind() == reflect.Int || f.Type.Kind() == reflect.Int64:
+		s.Type = "integer"
+	case f.Type.Kind() == reflect.Float64:
+		s.Type = "number"
+	case f.Type.Kind() == reflect.Bool:
+		s.Type = "boolean"
+		numeric = false
+	case f.Type.Kind() == reflect.Slice:
+		s.Type, s.Items = "array", &openAPISchema{Type: "string"}
+		numeric = false
+	default:
+		s.Type = "string"
+		numeric = false
+	}
+
+	if arg, ok := f.Rule("min"); ok {
+		n, _ := strconv.ParseFloat(arg, 64)
+		if numeric {
+			s.Minimum = &n
+		} else {
+			l := int(n)
+			s.MinLength = &l
+		}
+	}
+	if arg, ok := f.Rule("max"); ok {
+		n, _ := strconv.ParseFloat(arg, 64)
+		if numeric {
+			s.Maximum = &n
+		} else {
+			l := int(n)
+			s.MaxLength = &l
+		}
+	}
+	if _, ok := f.Rule("positive"); ok {
+		zero := 0.0
+		s.Minimum, s.ExclusiveMinimum = &zero, true
+	}
+	if _, ok := f.Rule("date"); ok {
+		s.Format = "date"
+	}
+	if arg, ok := f.Rule("oneof"); ok {
+		for _, v := range strings.Split(arg, "|") {
+			if n, err := strconv.Atoi(v); err == nil && s.Type == "integer" {
+				s.Enum = append(s.Enum, n)
+			} else {
+				s.Enum = append(s.Enum, v)
+			}
+		}
+	}
+
+	return s
+}
+
+// pathParams returns the names of the variables of a route path
+func pathParams(path string) []string {
+	names := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.Trim(segment, "{}"))
+		}
+	}
+	return names
+}
+
+func openAPIHandler(doc *openAPIDocument) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	})
+}
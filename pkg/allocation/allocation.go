@@ -0,0 +1,115 @@
+package allocation
+
+import "github.com/ssrdive/cidium/pkg/money"
+
+// Component identifies the part of an installment a payment settles.
+// Values match contract_payment_type
+type Component int
+
+const (
+	// Capital settles installment capital
+	Capital Component = 1
+	// Interest settles installment interest
+	Interest Component = 2
+	// Debit settles debit notes and charges
+	Debit Component = 3
+)
+
+// Order decides how a payment moves across payables
+type Order int
+
+const (
+	// Waterfall settles debits on every payable, then interest, then capital
+	Waterfall Order = iota
+	// OldestFirst settles debits, interest and capital of a payable
+	// before moving to the next
+	OldestFirst
+)
+
+// Payable holds the amounts outstanding on an installment
+type Payable struct {
+	ID       int
+	Debit    money.Amount
+	Interest money.Amount
+	Capital  money.Amount
+}
+
+// Line holds a payment against a component of a payable
+type Line struct {
+	// Index is the position of the payable in the slice passed to Allocate
+	Index     int
+	ID        int
+	Component Component
+	Amount    money.Amount
+}
+
+var components = []Component{Debit, Interest, Capital}
+
+// Allocate splits amount across payables in the given order.
+// Returns the payment lines and the balance left after every payable is settled.
+// Components with nothing due or overpaid are skipped, so an overpayment is
+// never paid back out of the amount
+func Allocate(amount money.Amount, payables []Payable, order Order) ([]Line, money.Amount) {
+	balance := amount
+	lines := []Line{}
+
+	pay := func(i int, c Component) {
+		due := payables[i].amount(c)
+		if due <= 0 || balance <= 0 {
+			return
+		}
+		paid := due
+		if balance < due {
+			paid = balance
+		}
+		balance -= paid
+		lines = append(lines, Line{Index: i, ID: payables[i].ID, Component: c, Amount: paid})
+	}
+
+	if order == OldestFirst {
+		for i := range payables {
+			for _, c := range components {
+				pay(i, c)
+			}
+		}
+	} else {
+		for _, c := range components {
+			for i := range payables {
+				pay(i, c)
+			}
+		}
+	}
+
+	return lines, balance
+}
+
+// Filter returns the lines settling a component
+func Filter(lines []Line, c Component) []Line {
+	filtered := []Line{}
+	for _, l := range lines {
+		if l.Component == c {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
+}
+
+// Total returns the sum of lines settling a component
+func Total(lines []Line, c Component) money.Amount {
+	var total money.Amount
+	for _, l := range Filter(lines, c) {
+		total += l.Amount
+	}
+	return total
+}
+
+func (p Payable) amount(c Component) money.Amount {
+	switch c {
+	case Debit:
+		return p.Debit
+	case Interest:
+		return p.Interest
+	default:
+		return p.Capital
+	}
+}
@@ -0,0 +1,151 @@
+package allocation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+func TestAllocate(t *testing.T) {
+	payables := []Payable{
+		{ID: 10, Debit: 500, Interest: 1000, Capital: 4000},
+		{ID: 11, Debit: 0, Interest: 800, Capital: 4200},
+	}
+
+	tests := []struct {
+		name     string
+		amount   money.Amount
+		payables []Payable
+		order    Order
+		lines    []Line
+		balance  money.Amount
+	}{
+		{
+			name:     "waterfall settles each component on every payable first",
+			amount:   3000,
+			payables: payables,
+			order:    Waterfall,
+			lines: []Line{
+				{Index: 0, ID: 10, Component: Debit, Amount: 500},
+				{Index: 0, ID: 10, Component: Interest, Amount: 1000},
+				{Index: 1, ID: 11, Component: Interest, Amount: 800},
+				{Index: 0, ID: 10, Component: Capital, Amount: 700},
+			},
+		},
+		{
+			name:     "oldest first settles a payable before the next",
+			amount:   6000,
+			payables: payables,
+			order:    OldestFirst,
+			lines: []Line{
+				{Index: 0, ID: 10, Component: Debit, Amount: 500},
+				{Index: 0, ID: 10, Component: Interest, Amount: 1000},
+				{Index: 0, ID: 10, Component: Capital, Amount: 4000},
+				{Index: 1, ID: 11, Component: Interest, Amount: 500},
+			},
+		},
+		{
+			name:     "partial payment stops within a component",
+			amount:   300,
+			payables: payables,
+			order:    Waterfall,
+			lines: []Line{
+				{Index: 0, ID: 10, Component: Debit, Amount: 300},
+			},
+		},
+		{
+			name:     "exact payment settles every payable",
+			amount:   10500,
+			payables: payables,
+			order:    OldestFirst,
+			lines: []Line{
+				{Index: 0, ID: 10, Component: Debit, Amount: 500},
+				{Index: 0, ID: 10, Component: Interest, Amount: 1000},
+				{Index: 0, ID: 10, Component: Capital, Amount: 4000},
+				{Index: 1, ID: 11, Component: Interest, Amount: 800},
+				{Index: 1, ID: 11, Component: Capital, Amount: 4200},
+			},
+		},
+		{
+			name:     "payment beyond the payables is left as balance",
+			amount:   11000,
+			payables: payables,
+			order:    Waterfall,
+			lines: []Line{
+				{Index: 0, ID: 10, Component: Debit, Amount: 500},
+				{Index: 0, ID: 10, Component: Interest, Amount: 1000},
+				{Index: 1, ID: 11, Component: Interest, Amount: 800},
+				{Index: 0, ID: 10, Component: Capital, Amount: 4000},
+				{Index: 1, ID: 11, Component: Capital, Amount: 4200},
+			},
+			balance: 500,
+		},
+		{
+			name:   "zero and negative dues are skipped",
+			amount: 1000,
+			payables: []Payable{
+				{ID: 20, Debit: -200, Interest: 0, Capital: -50},
+				{ID: 21, Interest: 300, Capital: 900},
+			},
+			order: Waterfall,
+			lines: []Line{
+				{Index: 1, ID: 21, Component: Interest, Amount: 300},
+				{Index: 1, ID: 21, Component: Capital, Amount: 700},
+			},
+		},
+		{
+			name:     "no payables leaves the amount",
+			amount:   750,
+			payables: nil,
+			order:    OldestFirst,
+			lines:    []Line{},
+			balance:  750,
+		},
+		{
+			name:     "zero amount pays nothing",
+			amount:   0,
+			payables: payables,
+			order:    Waterfall,
+			lines:    []Line{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, balance := Allocate(tt.amount, tt.payables, tt.order)
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("lines = %+v, want %+v", lines, tt.lines)
+			}
+			if balance != tt.balance {
+				t.Errorf("balance = %v, want %v", balance, tt.balance)
+			}
+		})
+	}
+}
+
+func TestFilterTotal(t *testing.T) {
+	lines, _ := Allocate(3000, []Payable{
+		{ID: 10, Debit: 500, Interest: 1000, Capital: 4000},
+		{ID: 11, Interest: 800, Capital: 4200},
+	}, Waterfall)
+
+	tests := []struct {
+		component Component
+		count     int
+		total     money.Amount
+	}{
+		{Debit, 1, 500},
+		{Interest, 2, 1800},
+		{Capital, 1, 700},
+	}
+
+	for _, tt := range tests {
+		if got := len(Filter(lines, tt.component)); got != tt.count {
+			t.Errorf("len(Filter(%d)) = %d, want %d", tt.component, got, tt.count)
+		}
+		if got := Total(lines, tt.component); got != tt.total {
+			t.Errorf("Total(%d) = %v, want %v", tt.component, got, tt.total)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Package forms decodes JSON and form request bodies into typed request
+// structs and validates them, reporting every invalid field at once.
+//
+// Fields are mapped by their form tag and validated by their validate tag, a
+// comma separated list of rules:
+//
+//	required   the field must be present and not empty
+//	min=N      numbers must be at least N, strings at least N characters long
+//	max=N      numbers must be at most N, strings at most N characters long
+//	positive   numbers and amounts must be greater than zero
+//	date       the value must be a date formatted as 2006-01-02
+//	oneof=a|b  the value must be one of the listed values
+//
+// Supported field types are string, int, int64, float64, bool, []string
+// and money.Amount.
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+// MaxMemory is the memory used to parse multipart bodies
+const MaxMemory = 5120000
+
+var amountType = reflect.TypeOf(money.Amount(0))
+
+// Decode reads the body of a request into dst, a pointer to a struct, and
+// validates it. JSON bodies are also copied into r.PostForm and r.Form so that
+// handlers passing the form on to models work with either encoding. A
+// *models.Error holding every field error is returned when the body is invalid
+func Decode(r *http.Request, dst interface{}) error {
+	values, err := parse(r)
+	if err != nil {
+		return err
+	}
+
+	return DecodeValues(values, dst)
+}
+
+// DecodeValues decodes and validates values, such as a query string or route
+// variables, into dst
+func DecodeValues(values url.Values, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+
+	errs := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("form")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		msg := decodeField(v.Field(i), values[name], strings.Split(f.Tag.Get("validate"), ","))
+		if msg != "" {
+			errs[name] = msg
+		}
+	}
+
+	if len(errs) > 0 {
+		return models.NewFieldError(errs)
+	}
+	return nil
+}
+
+// Field describes a field of a request struct
+type Field struct {
+	Name  string
+	Type  reflect.Type
+	Rules []string
+}
+
+// Fields returns the fields of a request struct, dst being a struct or a
+// pointer to one, in declaration order
+func Fields(dst interface{}) []Field {
+	t := reflect.TypeOf(dst)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := []Field{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("form")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		rules := []string{}
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule != "" {
+				rules = append(rules, rule)
+			}
+		}
+		fields = append(fields, Field{Name: name, Type: f.Type, Rules: rules})
+	}
+	return fields
+}
+
+// IsAmount reports whether a field holds a money.Amount
+func (f Field) IsAmount() bool {
+	return f.Type == amountType
+}
+
+// Rule returns the argument of a rule of the field and whether it is set
+func (f Field) Rule(name string) (string, bool) {
+	for _, rule := range f.Rules {
+		if rule == name {
+			return "", true
+		}
+		if strings.HasPrefix(rule, name+"=") {
+			return rule[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// parse returns the values of a JSON, multipart or urlencoded body
+func parse(r *http.Request) (url.Values, error) {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/json":
+		// Numbers are kept as sent so that amounts and large identifiers
+		// are not rounded through float64
+		var body map[string]interface{}
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		err := dec.Decode(&body)
+		if err != nil {
+			return nil, &models.Error{Kind: models.KindInvalid, Code: "invalid_json", Message: "request body is not a JSON object"}
+		}
+
+		values := Values(body)
+		r.PostForm = values
+		r.Form = values
+		return values, nil
+	case "multipart/form-data":
+		err := r.ParseMultipartForm(MaxMemory)
+		if err != nil {
+			return nil, &models.Error{Kind: models.KindInvalid, Code: "invalid_form", Message: "request body is not a valid form"}
+		}
+		return r.Form, nil
+	default:
+		err := r.ParseForm()
+		if err != nil {
+			return nil, &models.Error{Kind: models.KindInvalid, Code: "invalid_form", Message: "request body is not a valid form"}
+		}
+		return r.PostForm, nil
+	}
+}
+
+// Values returns the members of a JSON object as they would be sent in a
+// form. Arrays of scalars become repeated values and other arrays and objects
+// are kept as JSON
+func Values(obj map[string]interface{}) url.Values {
+	values := url.Values{}
+	for k, v := range obj {
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			if !scalars(v) {
+				values.Set(k, jsonString(v))
+				continue
+			}
+			for _, item := range v {
+				values.Add(k, jsonString(item))
+			}
+		default:
+			values.Set(k, jsonString(v))
+		}
+	}
+	return values
+}
+
+// jsonString returns a JSON value as it would be sent in a form
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// scalars reports whether a JSON array holds only strings, numbers and booleans
+func scalars(items []interface{}) bool {
+	for _, item := range items {
+		switch item.(type) {
+		case string, json.Number, float64, bool:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// decodeField sets a field from its values and returns the validation error
+func decodeField(field reflect.Value, values []string, rules []string) string {
+	raw := ""
+	if len(values) > 0 {
+		raw = strings.TrimSpace(values[0])
+	}
+
+	if raw == "" {
+		if has(rules, "required") {
+			return "is required"
+		}
+		return ""
+	}
+
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		field.Set(reflect.ValueOf(values))
+		return ""
+	}
+
+	var number float64
+	numeric := true
+	switch {
+	case field.Type() == amountType:
+		a, err := money.Parse(raw)
+		if err != nil {
+			return "must be an amount"
+		}
+		field.SetInt(int64(a))
+		number = a.Float64()
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return "must be a whole number"
+		}
+		field.SetInt(n)
+		number = float64(n)
+	case field.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return "must be a number"
+		}
+		field.SetFloat(n)
+		number = n
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "must be true or false"
+		}
+		field.SetBool(b)
+		numeric = false
+	default:
+		field.SetString(raw)
+		number = float64(len([]rune(raw)))
+		numeric = false
+	}
+
+	for _, rule := range rules {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("forms: invalid rule %q", rule))
+			}
+			if name == "min" && number < limit {
+				if numeric {
+					return "must be at least " + arg
+				}
+				return "must be at least " + arg + " characters"
+			}
+			if name == "max" && number > limit {
+				if numeric {
+					return "must be at most " + arg
+				}
+				return "must be at most " + arg + " characters"
+			}
+		case "positive":
+			if number <= 0 {
+				return "must be greater than zero"
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", raw); err != nil {
+				return "must be a date formatted as YYYY-MM-DD"
+			}
+		case "oneof":
+			if !has(strings.Split(arg, "|"), raw) {
+				return "must be one of " + strings.ReplaceAll(arg, "|", ", ")
+			}
+		}
+	}
+
+	return ""
+}
+
+func has(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
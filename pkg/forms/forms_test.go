@@ -0,0 +1,260 @@
+package forms
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+type testRequest struct {
+	Name     string       `form:"name" validate:"required,min=2,max=10"`
+	Count    int          `form:"count" validate:"min=1,max=12"`
+	ID       int64        `form:"id"`
+	Rate     float64      `form:"rate" validate:"positive"`
+	Amount   money.Amount `form:"amount" validate:"positive"`
+	Date     string       `form:"date" validate:"date"`
+	Method   string       `form:"method" validate:"oneof=S|R"`
+	Active   bool         `form:"active"`
+	Tags     []string     `form:"tags"`
+	Internal string
+}
+
+func jsonRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return r
+}
+
+func formRequest(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func multipartRequest(t *testing.T, values url.Values) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, vs := range values {
+		for _, v := range vs {
+			if err := mw.WriteField(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestDecode(t *testing.T) {
+	full := url.Values{
+		"name":   {"Amal"},
+		"count":  {"12"},
+		"id":     {"9007199254740993"},
+		"rate":   {"2.5"},
+		"amount": {"1250.50"},
+		"date":   {"2026-02-28"},
+		"method": {"R"},
+		"active": {"true"},
+		"tags":   {"tractor", "trailer"},
+	}
+	want := testRequest{
+		Name:   "Amal",
+		Count:  12,
+		ID:     9007199254740993,
+		Rate:   2.5,
+		Amount: 125050,
+		Date:   "2026-02-28",
+		Method: "R",
+		Active: true,
+		Tags:   []string{"tractor", "trailer"},
+	}
+
+	tests := []struct {
+		name string
+		r    *http.Request
+	}{
+		{
+			name: "JSON",
+			r: jsonRequest(`{"name": "Amal", "count": 12, "id": 9007199254740993, "rate": 2.5, "amount": 1250.50,
+				"date": "2026-02-28", "method": "R", "active": true, "tags": ["tractor", "trailer"], "notes": null}`),
+		},
+		{
+			name: "JSON strings",
+			r: jsonRequest(`{"name": "Amal", "count": "12", "id": "9007199254740993", "rate": "2.5", "amount": "1250.50",
+				"date": "2026-02-28", "method": "R", "active": "true", "tags": ["tractor", "trailer"]}`),
+		},
+		{name: "urlencoded", r: formRequest(full)},
+		{name: "multipart", r: multipartRequest(t, full)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testRequest
+			if err := Decode(tt.r, &got); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Decode() = %+v, want %+v", got, want)
+			}
+			if v := tt.r.PostFormValue("name"); v != "Amal" {
+				t.Errorf("PostForm name = %q, want Amal", v)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		fields map[string]string
+	}{
+		{
+			name:   "required",
+			values: url.Values{"name": {"  "}},
+			fields: map[string]string{"name": "is required"},
+		},
+		{
+			name: "every field error at once",
+			values: url.Values{
+				"name":   {"A"},
+				"count":  {"13"},
+				"id":     {"1.5"},
+				"rate":   {"0"},
+				"amount": {"-10"},
+				"date":   {"2026-02-30"},
+				"method": {"F"},
+				"active": {"maybe"},
+			},
+			fields: map[string]string{
+				"name":   "must be at least 2 characters",
+				"count":  "must be at most 12",
+				"id":     "must be a whole number",
+				"rate":   "must be greater than zero",
+				"amount": "must be greater than zero",
+				"date":   "must be a date formatted as YYYY-MM-DD",
+				"method": "must be one of S, R",
+				"active": "must be true or false",
+			},
+		},
+		{
+			name:   "string max",
+			values: url.Values{"name": {"Amal Bandara"}},
+			fields: map[string]string{"name": "must be at most 10 characters"},
+		},
+		{
+			name:   "number min",
+			values: url.Values{"name": {"Amal"}, "count": {"0"}},
+			fields: map[string]string{"count": "must be at least 1"},
+		},
+		{
+			name:   "numbers",
+			values: url.Values{"name": {"Amal"}, "rate": {"two"}, "amount": {"1,250"}},
+			fields: map[string]string{"rate": "must be a number", "amount": "must be an amount"},
+		},
+		{
+			name:   "amount overflow",
+			values: url.Values{"name": {"Amal"}, "amount": {"92233720368547758.08"}},
+			fields: map[string]string{"amount": "must be an amount"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testRequest
+			err := Decode(formRequest(tt.values), &got)
+
+			var e *models.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Decode() error = %v, want a field error", err)
+			}
+			if e.Kind != models.KindInvalid {
+				t.Errorf("kind = %v, want %v", e.Kind, models.KindInvalid)
+			}
+			if !reflect.DeepEqual(e.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", e.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalidBody(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *http.Request
+		code string
+	}{
+		{"malformed JSON", jsonRequest(`{"name": "Amal"`), "invalid_json"},
+		{"JSON array", jsonRequest(`[{"name": "Amal"}]`), "invalid_json"},
+		{"malformed form", formRequest(nil), "invalid_form"},
+	}
+	tests[2].r.Body = ioutil.NopCloser(strings.NewReader("name=%zz"))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testRequest
+			err := Decode(tt.r, &got)
+
+			var e *models.Error
+			if !errors.As(err, &e) || e.Code != tt.code {
+				t.Errorf("Decode() error = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	r := jsonRequest(`{"amount": 12345678901234.56, "id": 9007199254740993, "ok": false, "tags": ["a", 1],
+		"rows": [{"a": 1}], "object": {"b": [2]}, "none": null}`)
+	if _, err := parse(r); err != nil {
+		t.Fatal(err)
+	}
+
+	want := url.Values{
+		"amount": {"12345678901234.56"},
+		"id":     {"9007199254740993"},
+		"ok":     {"false"},
+		"tags":   {"a", "1"},
+		"rows":   {`[{"a":1}]`},
+		"object": {`{"b":[2]}`},
+	}
+	if !reflect.DeepEqual(r.PostForm, want) {
+		t.Errorf("values = %v, want %v", r.PostForm, want)
+	}
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields(&testRequest{})
+	if len(fields) != 9 {
+		t.Fatalf("len(Fields()) = %d, want 9", len(fields))
+	}
+
+	name := fields[0]
+	if max, ok := name.Rule("max"); name.Name != "name" || !ok || max != "10" {
+		t.Errorf("name max = %q, %v, want 10", max, ok)
+	}
+	if _, ok := name.Rule("required"); !ok {
+		t.Error("name is not required")
+	}
+	if _, ok := name.Rule("date"); ok {
+		t.Error("name has the date rule")
+	}
+	if !fields[4].IsAmount() || fields[3].IsAmount() {
+		t.Errorf("IsAmount() of amount, rate = %v, %v, want true, false", fields[4].IsAmount(), fields[3].IsAmount())
+	}
+}
@@ -0,0 +1,67 @@
+package loan
+
+import (
+	"math"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+// Affordability compares the repayments of a calculation with the monthly
+// income of a customer
+type Affordability struct {
+	MonthlyIncome money.Amount `json:"monthly_income"`
+	// MonthlyRepayment is the largest marketed rental spread over the
+	// months since the previous installment, so that weekly rentals count
+	// about four times a month and quarterly rentals a third
+	MonthlyRepayment money.Amount `json:"monthly_repayment"`
+	// Ratio is the percentage of the income taken by the monthly repayment
+	Ratio      float64 `json:"ratio"`
+	MaxRatio   float64 `json:"max_ratio"`
+	Affordable bool    `json:"affordable"`
+}
+
+// Affordability checks that the repayments of the calculation take no more
+// than maxRatio percent of a monthly income
+func (c Calculation) Affordability(income money.Amount, maxRatio float64) Affordability {
+	a := Affordability{MonthlyIncome: income, MaxRatio: maxRatio}
+
+	prev, err := time.Parse("2006-01-02", c.Terms.InitiationDate)
+	if err != nil {
+		return a
+	}
+	// Schedules run from the 28th when initiated later in a month
+	if prev.Day() > 28 {
+		prev = prev.AddDate(0, 0, -(prev.Day() - 28))
+	}
+	for _, l := range c.Marketed.Lines {
+		due, err := time.Parse("2006-01-02", l.DueDate)
+		if err != nil {
+			return a
+		}
+		months := monthsBetween(prev, due)
+		prev = due
+		if months <= 0 {
+			continue
+		}
+
+		if monthly := money.FromFloat(l.Rental.Float64() / months); monthly > a.MonthlyRepayment {
+			a.MonthlyRepayment = monthly
+		}
+	}
+
+	if income > 0 {
+		a.Ratio = math.Round(a.MonthlyRepayment.Float64()/income.Float64()*10000) / 100
+		a.Affordable = a.Ratio <= maxRatio
+	}
+	return a
+}
+
+// monthsBetween returns the calendar months between dates, counting the
+// days left over as parts of the month the first date falls in, so that a
+// week is about a quarter of a month whether or not it crosses a month end
+func monthsBetween(from, to time.Time) float64 {
+	months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	days := time.Date(from.Year(), from.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return float64(months) + float64(to.Day()-from.Day())/float64(days)
+}
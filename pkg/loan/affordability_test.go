@@ -0,0 +1,108 @@
+package loan
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+func TestAffordability(t *testing.T) {
+	monthly := Terms{Capital: 120000, Rate: 24, Installments: 12, InstallmentInterval: 1, InitiationDate: "2026-01-15"}
+	capitalGrace := monthly
+	capitalGrace.GracePeriods, capitalGrace.Grace = 3, GraceCapital
+	interestGrace := monthly
+	interestGrace.GracePeriods, interestGrace.Grace = 3, GraceInterestOnly
+
+	tests := []struct {
+		name   string
+		method Method
+		terms  Terms
+		income money.Amount
+		want   Affordability
+	}{
+		{
+			name:   "monthly",
+			method: MethodReducing,
+			terms:  monthly,
+			income: 5000000,
+			want:   Affordability{MonthlyIncome: 5000000, MonthlyRepayment: 1240000, Ratio: 24.8, MaxRatio: 40, Affordable: true},
+		},
+		{
+			name:   "weekly rentals count about four times a month",
+			method: MethodWeekly,
+			terms:  Terms{Capital: 40000, Rate: 30, Installments: 20, InstallmentInterval: 1, InitiationDate: "2026-01-15"},
+			income: 5000000,
+			// 2,230.14 a week over the 31 days of January
+			want: Affordability{MonthlyIncome: 5000000, MonthlyRepayment: 987633, Ratio: 19.75, MaxRatio: 40, Affordable: true},
+		},
+		{
+			name:   "quarterly rentals count a third",
+			method: MethodReducing,
+			terms:  Terms{Capital: 120000, Rate: 24, Installments: 4, InstallmentInterval: 3, InitiationDate: "2026-01-31"},
+			income: 5000000,
+			// 37,200 due on 28 April, three months from the 28th
+			want: Affordability{MonthlyIncome: 5000000, MonthlyRepayment: 1240000, Ratio: 24.8, MaxRatio: 40, Affordable: true},
+		},
+		{
+			name:   "capital grace",
+			method: MethodReducing,
+			terms:  capitalGrace,
+			income: 4000000,
+			// The first rental of 16,696.34 is due after the grace and
+			// spread over four months, so a later rental is the largest
+			want: Affordability{MonthlyIncome: 4000000, MonthlyRepayment: 1641335, Ratio: 41.03, MaxRatio: 40},
+		},
+		{
+			name:   "interest only grace counts the rentals after it",
+			method: MethodReducing,
+			terms:  interestGrace,
+			income: 5000000,
+			want:   Affordability{MonthlyIncome: 5000000, MonthlyRepayment: 1573333, Ratio: 31.47, MaxRatio: 40, Affordable: true},
+		},
+		{
+			name:   "no income",
+			method: MethodReducing,
+			terms:  monthly,
+			want:   Affordability{MonthlyRepayment: 1240000, MaxRatio: 40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marketed, financial, err := Create(tt.method, tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := Product{Method: tt.method}.Calculate(tt.terms, marketed, financial)
+
+			if got := c.Affordability(tt.income, 40); got != tt.want {
+				t.Errorf("Affordability() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonthsBetween(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     float64
+	}{
+		{"2026-01-15", "2026-02-15", 1},
+		{"2026-01-28", "2026-04-28", 3},
+		{"2026-12-15", "2027-03-15", 3},
+		{"2026-01-15", "2026-01-22", 7.0 / 31},
+		{"2026-01-29", "2026-02-05", 7.0 / 31},
+		{"2026-02-26", "2026-03-05", 7.0 / 28},
+		{"2026-01-15", "2026-05-15", 4},
+	}
+
+	for _, tt := range tests {
+		from, _ := time.Parse("2006-01-02", tt.from)
+		to, _ := time.Parse("2006-01-02", tt.to)
+		if got := monthsBetween(from, to); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("monthsBetween(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package loan
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Skip is a window of days in a year in which no installment falls due.
+// Windows may wrap the year end
+type Skip struct {
+	FromMonth time.Month `json:"from_month"`
+	FromDay   int        `json:"from_day"`
+	ToMonth   time.Month `json:"to_month"`
+	ToDay     int        `json:"to_day"`
+}
+
+// Contains reports whether a date falls in the window
+func (s Skip) Contains(d time.Time) bool {
+	day := int(d.Month())*100 + d.Day()
+	from := int(s.FromMonth)*100 + s.FromDay
+	to := int(s.ToMonth)*100 + s.ToDay
+	if from <= to {
+		return day >= from && day <= to
+	}
+	return day >= from || day <= to
+}
+
+func (s Skip) String() string {
+	return fmt.Sprintf("%02d-%02d:%02d-%02d", s.FromMonth, s.FromDay, s.ToMonth, s.ToDay)
+}
+
+// Calendar holds the windows weekly installments are moved out of
+type Calendar []Skip
+
+// FestivalCalendar skips the April new year and December festival weeks
+var FestivalCalendar = Calendar{
+	{FromMonth: time.April, FromDay: 10, ToMonth: time.April, ToDay: 16},
+	{FromMonth: time.December, FromDay: 23, ToMonth: time.December, ToDay: 29},
+}
+
+// Skips reports whether a date falls in a window of the calendar
+func (c Calendar) Skips(d time.Time) bool {
+	for _, s := range c {
+		if s.Contains(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Calendar) String() string {
+	skips := make([]string, len(c))
+	for i, s := range c {
+		skips[i] = s.String()
+	}
+	return strings.Join(skips, ",")
+}
+
+// ParseCalendar parses comma separated MM-DD:MM-DD windows as formatted by
+// Calendar.String
+func ParseCalendar(s string) (Calendar, error) {
+	c := Calendar{}
+	for _, window := range strings.Split(s, ",") {
+		window = strings.TrimSpace(window)
+		if window == "" {
+			continue
+		}
+
+		var skip Skip
+		_, err := fmt.Sscanf(window, "%d-%d:%d-%d", &skip.FromMonth, &skip.FromDay, &skip.ToMonth, &skip.ToDay)
+		if err != nil || !validDay(skip.FromMonth, skip.FromDay) || !validDay(skip.ToMonth, skip.ToDay) {
+			return nil, fmt.Errorf("loan: invalid skip window %q", window)
+		}
+		c = append(c, skip)
+	}
+	return c, nil
+}
+
+func validDay(m time.Month, d int) bool {
+	// 2000 is a leap year so 29 February is accepted
+	t := time.Date(2000, m, d, 0, 0, 0, 0, time.UTC)
+	return m >= time.January && m <= time.December && t.Month() == m && t.Day() == d
+}
@@ -0,0 +1,88 @@
+package loan
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSkipContains(t *testing.T) {
+	april := Skip{FromMonth: time.April, FromDay: 10, ToMonth: time.April, ToDay: 16}
+	yearEnd := Skip{FromMonth: time.December, FromDay: 20, ToMonth: time.January, ToDay: 5}
+
+	tests := []struct {
+		skip Skip
+		date string
+		want bool
+	}{
+		{april, "2026-04-09", false},
+		{april, "2026-04-10", true},
+		{april, "2026-04-16", true},
+		{april, "2026-04-17", false},
+		{april, "2026-10-13", false},
+		{yearEnd, "2026-12-19", false},
+		{yearEnd, "2026-12-20", true},
+		{yearEnd, "2026-12-31", true},
+		{yearEnd, "2027-01-01", true},
+		{yearEnd, "2027-01-05", true},
+		{yearEnd, "2027-01-06", false},
+		{yearEnd, "2026-07-01", false},
+	}
+
+	for _, tt := range tests {
+		d, _ := time.Parse("2006-01-02", tt.date)
+		if got := tt.skip.Contains(d); got != tt.want {
+			t.Errorf("%v.Contains(%s) = %v, want %v", tt.skip, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestParseCalendar(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Calendar
+		ok   bool
+	}{
+		{"", Calendar{}, true},
+		{FestivalCalendar.String(), FestivalCalendar, true},
+		{" 12-20:01-05 , ,02-29:03-01", Calendar{
+			{FromMonth: time.December, FromDay: 20, ToMonth: time.January, ToDay: 5},
+			{FromMonth: time.February, FromDay: 29, ToMonth: time.March, ToDay: 1},
+		}, true},
+		{"13-01:01-05", nil, false},
+		{"02-30:03-01", nil, false},
+		{"04-10:04-00", nil, false},
+		{"04-10", nil, false},
+		{"april", nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCalendar(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseCalendar(%q) error = %v, want ok %v", tt.s, err, tt.ok)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCalendar(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWeeklyCalendar(t *testing.T) {
+	terms := Terms{Capital: 40000, Rate: 30, Installments: 4, InstallmentInterval: 1, InitiationDate: "2026-12-10",
+		Calendar: Calendar{{FromMonth: time.December, FromDay: 20, ToMonth: time.January, ToDay: 5}}}
+
+	marketed, _, err := Create(MethodWeekly, terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dates := make([]string, len(marketed))
+	for i, inst := range marketed {
+		dates[i] = inst.DueDate
+	}
+	want := []string{"2026-12-17", "2027-01-07", "2027-01-14", "2027-01-21"}
+	if !reflect.DeepEqual(dates, want) {
+		t.Errorf("due dates = %v, want %v", dates, want)
+	}
+}
@@ -0,0 +1,141 @@
+package loan
+
+import (
+	"math"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+// Line is an installment of a disclosed schedule
+type Line struct {
+	DueDate  string       `json:"due_date"`
+	Capital  money.Amount `json:"capital"`
+	Interest money.Amount `json:"interest"`
+	Rental   money.Amount `json:"rental"`
+	// Balance is the capital outstanding after the installment
+	Balance money.Amount `json:"balance"`
+}
+
+// Disclosure states the cost of a schedule to the customer
+type Disclosure struct {
+	Capital  money.Amount `json:"capital"`
+	Interest money.Amount `json:"interest"`
+	Fees     money.Amount `json:"fees"`
+	// Payable is the capital, interest and fees paid over the schedule
+	Payable money.Amount `json:"payable"`
+	// EffectiveRate is the annual percentage rate at which the rentals
+	// repay the capital disbursed net of fees. It is omitted when the cash
+	// flows have no rate, such as when the fees take the whole capital
+	EffectiveRate *float64 `json:"effective_rate,omitempty"`
+	Lines         []Line   `json:"installments"`
+}
+
+// Calculation holds the disclosures of the marketed and financial schedules
+// of terms. Methods without a financial schedule omit it
+type Calculation struct {
+	Terms     Terms       `json:"terms"`
+	Method    Method      `json:"method"`
+	Marketed  Disclosure  `json:"marketed"`
+	Financial *Disclosure `json:"financial,omitempty"`
+}
+
+// Calculate discloses the schedules of terms created under a product. Fees
+// are charged by the product on the capital
+func (p Product) Calculate(t Terms, marketed []Installment, financial []InstallmentSchedule) Calculation {
+	fees := p.Fees(money.FromFloat(t.Capital))
+	c := Calculation{Terms: t, Method: p.Method}
+
+	lines := make([]Line, 0, len(marketed))
+	for _, inst := range marketed {
+		lines = append(lines, Line{DueDate: inst.DueDate, Capital: inst.Capital, Interest: inst.Interest})
+	}
+	c.Marketed = disclose(t.InitiationDate, fees, lines)
+
+	lines = make([]Line, 0, len(financial))
+	for _, inst := range financial {
+		if inst.MonthlyDate == "" {
+			continue
+		}
+		lines = append(lines, Line{DueDate: inst.MonthlyDate, Capital: inst.Capital, Interest: inst.Interest})
+	}
+	if len(lines) > 0 {
+		financialDisclosure := disclose(t.InitiationDate, fees, lines)
+		c.Financial = &financialDisclosure
+	}
+
+	return c
+}
+
+func disclose(disbursed string, fees money.Amount, lines []Line) Disclosure {
+	d := Disclosure{Fees: fees, Lines: lines}
+	for _, l := range lines {
+		d.Capital += l.Capital
+		d.Interest += l.Interest
+	}
+	d.Payable = d.Capital + d.Interest + d.Fees
+
+	balance := d.Capital
+	for i := range d.Lines {
+		balance -= d.Lines[i].Capital
+		d.Lines[i].Rental = d.Lines[i].Capital + d.Lines[i].Interest
+		d.Lines[i].Balance = balance
+	}
+
+	if rate, ok := effectiveRate(disbursed, d.Capital-fees, d.Lines); ok {
+		d.EffectiveRate = &rate
+	}
+	return d
+}
+
+// effectiveRate returns the annual percentage internal rate of return of
+// disbursing an amount on a date and collecting the rentals of the lines,
+// discounting by the actual number of days between them. It reports false
+// when a date is invalid or precedes the disbursement, nothing is disbursed
+// or no rate solves the flows
+func effectiveRate(disbursed string, amount money.Amount, lines []Line) (float64, bool) {
+	start, err := time.Parse("2006-01-02", disbursed)
+	if err != nil || amount <= 0 || len(lines) == 0 {
+		return 0, false
+	}
+
+	years := make([]float64, len(lines))
+	for i, l := range lines {
+		due, err := time.Parse("2006-01-02", l.DueDate)
+		if err != nil || due.Before(start) {
+			return 0, false
+		}
+		years[i] = due.Sub(start).Hours() / 24 / 365
+	}
+
+	// npv falls as the rate rises as long as the rentals follow the
+	// disbursement
+	npv := func(rate float64) float64 {
+		v := -amount.Float64()
+		for i, l := range lines {
+			v += l.Rental.Float64() / math.Pow(1+rate, years[i])
+		}
+		return v
+	}
+
+	low, high := -0.99, 1.0
+	for npv(high) > 0 {
+		high *= 2
+		if high > 1e6 {
+			return 0, false
+		}
+	}
+	if npv(low) < 0 {
+		return 0, false
+	}
+	for i := 0; i < 200 && high-low > 1e-10; i++ {
+		mid := (low + high) / 2
+		if npv(mid) > 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return math.Round(low*10000) / 100, true
+}
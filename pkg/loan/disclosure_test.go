@@ -0,0 +1,113 @@
+package loan
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+func TestEffectiveRate(t *testing.T) {
+	year := func(due string, rental money.Amount) []Line {
+		return []Line{{DueDate: due, Rental: rental}}
+	}
+
+	tests := []struct {
+		name      string
+		disbursed string
+		amount    money.Amount
+		lines     []Line
+		rate      float64
+		ok        bool
+	}{
+		// 2% a month compounds to 26.82% a year
+		{"a year at 2% a month", "2026-01-01", 10000000, year("2027-01-01", 12682418), 26.82, true},
+		{"nothing earned", "2026-01-01", 10000000, year("2027-01-01", 10000000), 0, true},
+		{"invalid disbursement date", "2026-02-30", 10000000, year("2027-01-01", 12682418), 0, false},
+		{"invalid due date", "2026-01-01", 10000000, year("2027-13-01", 12682418), 0, false},
+		{"due before disbursement", "2026-01-01", 10000000, year("2025-12-01", 12682418), 0, false},
+		{"fees take the capital", "2026-01-01", 0, year("2027-01-01", 12682418), 0, false},
+		{"no rentals", "2026-01-01", 10000000, nil, 0, false},
+		{"rentals never repay", "2026-01-01", 10000000, year("2027-01-01", 0), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := effectiveRate(tt.disbursed, tt.amount, tt.lines)
+			if ok != tt.ok || rate != tt.rate {
+				t.Errorf("effectiveRate() = %v, %v, want %v, %v", rate, ok, tt.rate, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	terms := Terms{Capital: 120000, Rate: 24, Installments: 12, InstallmentInterval: 1, InitiationDate: "2026-01-15"}
+
+	// Monthly rentals are discounted by the actual days between them, so
+	// 2% a month on the reducing balance lands near the 26.82% it
+	// compounds to
+	tests := []struct {
+		name      string
+		product   Product
+		interest  money.Amount
+		marketed  float64
+		financial float64
+	}{
+		{"reducing", Product{Method: MethodReducing}, 1560000, 26.96, 0},
+		{"flat charges interest on the whole capital", Product{Method: MethodFlat}, 2880000, 50.95, 0},
+		{"annuity", Product{Method: MethodAnnuity}, 1616583, 28, 26.95},
+		{"fees raise the rate", Product{Method: MethodReducing, DocumentFee: 120000, ProcessingFeeRate: 1}, 1560000, 32.19, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marketed, financial, err := Create(tt.product.Method, terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := tt.product.Calculate(terms, marketed, financial)
+
+			if c.Marketed.Interest != tt.interest {
+				t.Errorf("interest = %v, want %v", c.Marketed.Interest, tt.interest)
+			}
+			if want := c.Marketed.Capital + c.Marketed.Interest + c.Marketed.Fees; c.Marketed.Payable != want {
+				t.Errorf("payable = %v, want %v", c.Marketed.Payable, want)
+			}
+			if c.Marketed.EffectiveRate == nil || *c.Marketed.EffectiveRate != tt.marketed {
+				t.Errorf("marketed rate = %v, want %v", c.Marketed.EffectiveRate, tt.marketed)
+			}
+			if tt.financial == 0 {
+				if c.Financial != nil {
+					t.Errorf("financial = %+v, want none", c.Financial)
+				}
+				return
+			}
+			if c.Financial == nil || c.Financial.EffectiveRate == nil || *c.Financial.EffectiveRate != tt.financial {
+				t.Errorf("financial rate = %+v, want %v", c.Financial, tt.financial)
+			}
+		})
+	}
+}
+
+func TestCalculateWithoutRate(t *testing.T) {
+	terms := Terms{Capital: 1000, Rate: 24, Installments: 12, InstallmentInterval: 1, InitiationDate: "2026-01-15"}
+	marketed, financial, err := Create(MethodReducing, terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Product{Method: MethodReducing, DocumentFee: 100000}.Calculate(terms, marketed, financial)
+	if c.Marketed.EffectiveRate != nil {
+		t.Errorf("rate = %v with fees taking the capital, want none", *c.Marketed.EffectiveRate)
+	}
+
+	b, err := json.Marshal(c.Marketed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "effective_rate") {
+		t.Errorf("disclosure = %s, want the effective rate omitted", b)
+	}
+}
@@ -0,0 +1,176 @@
+package loan
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+// Grace is how interest is settled during the grace periods of a loan
+type Grace string
+
+// Grace kinds
+const (
+	// GraceCapital defers both capital and interest. Nothing is due during
+	// the grace periods and the interest accrued over them is capitalised
+	GraceCapital Grace = "capital"
+	// GraceInterestOnly defers capital. Only interest is due during the
+	// grace periods
+	GraceInterestOnly Grace = "interest_only"
+)
+
+// structured reports whether the terms defer repayment with grace periods
+// or a balloon
+func (t Terms) structured() bool {
+	return t.GracePeriods != 0 || t.Grace != "" || t.Balloon != 0
+}
+
+// structureErrors returns the reasons grace periods and a balloon are not
+// offered with the terms under a method
+func (t Terms) structureErrors(method Method) TermsError {
+	errs := TermsError{}
+	if !t.structured() {
+		return errs
+	}
+
+	if method != MethodReducing && method != MethodAnnuity && method != MethodIRR {
+		errs["method"] = "must be " + string(MethodReducing) + ", " + string(MethodAnnuity) + " or " + string(MethodIRR) + " for grace periods or a balloon"
+	}
+	if t.StructuredMonthlyRental > 0 {
+		errs["structured_monthly_rental"] = "is not offered with grace periods or a balloon"
+	}
+
+	switch {
+	case t.GracePeriods < 0:
+		errs["grace_periods"] = "must not be negative"
+	case t.GracePeriods > 0 && t.GracePeriods >= t.Installments:
+		errs["grace_periods"] = "must be less than installments"
+	}
+	switch {
+	case t.GracePeriods > 0 && t.Grace != GraceCapital && t.Grace != GraceInterestOnly:
+		errs["grace"] = "must be " + string(GraceCapital) + " or " + string(GraceInterestOnly)
+	case t.GracePeriods == 0 && t.Grace != "":
+		errs["grace"] = "requires grace_periods"
+	}
+
+	switch {
+	case t.Balloon < 0:
+		errs["balloon"] = "must not be negative"
+	case t.Balloon >= t.Capital:
+		errs["balloon"] = "must be less than the capital"
+	}
+
+	return errs
+}
+
+// createStructured creates the schedules of terms with grace periods or a
+// balloon. The financial schedule is monthly reducing balance at the rate.
+// Grace installments repay no capital and the capital outstanding after
+// them is repaid with equal capital installments under MethodReducing and
+// with equal rentals otherwise, less the balloon which is added to the last
+// installment. Interest capitalised during a capital grace is recovered as
+// interest from the first rentals so that the capital of the schedules is
+// the capital lent
+func createStructured(method Method, t Terms) ([]Installment, []InstallmentSchedule, error) {
+	initDate, err := time.Parse("2006-01-02", t.InitiationDate)
+	if err != nil {
+		return nil, nil, err
+	}
+	if initDate.Day() > 28 {
+		initDate = initDate.AddDate(0, 0, -(initDate.Day() - 28))
+	}
+
+	r := t.Rate / float64(12) / 100
+	interval := t.InstallmentInterval
+	graceMonths := t.GracePeriods * interval
+	repayments := t.Installments - t.GracePeriods
+	n := repayments * interval
+
+	capital := money.FromFloat(t.Capital)
+	balloon := money.FromFloat(t.Balloon)
+	balance := capital
+	capitalised := money.Amount(0)
+
+	var financialSchedule []InstallmentSchedule
+	for i := 1; i <= graceMonths; i++ {
+		initDate = initDate.AddDate(0, 1, 0)
+		interest := balance.Mul(r)
+		if t.Grace == GraceCapital {
+			balance += interest
+			capitalised += interest
+			continue
+		}
+		financialSchedule = append(financialSchedule, InstallmentSchedule{
+			Interest:    interest,
+			MonthlyDate: initDate.Format("2006-01-02"),
+		})
+	}
+
+	amortised := balance - balloon
+	payment := money.Amount(0)
+	if method != MethodReducing {
+		if r == 0 {
+			payment = money.FromFloat(amortised.Float64() / float64(n))
+		} else {
+			discountedBalloon := balloon.Float64() / math.Pow(1+r, float64(n))
+			payment = money.FromFloat((balance.Float64() - discountedBalloon) * r / (1 - math.Pow(1+r, -float64(n))))
+		}
+	}
+	installmentCapital := money.FromFloat(amortised.Float64() / float64(repayments))
+
+	for i := 1; i <= n; i++ {
+		initDate = initDate.AddDate(0, 1, 0)
+		interest := balance.Mul(r)
+
+		var rentalCapital money.Amount
+		switch {
+		case i == n:
+			rentalCapital = balance
+		case method == MethodReducing && i%interval == 0:
+			rentalCapital = installmentCapital
+		case method != MethodReducing:
+			rentalCapital = payment - interest
+		}
+		balance -= rentalCapital
+
+		financialSchedule = append(financialSchedule, InstallmentSchedule{
+			Capital:     rentalCapital,
+			Interest:    interest,
+			MonthlyDate: initDate.Format("2006-01-02"),
+		})
+	}
+
+	for i := range financialSchedule {
+		if capitalised == 0 {
+			break
+		}
+		recovered := financialSchedule[i].Capital
+		if recovered > capitalised {
+			recovered = capitalised
+		}
+		financialSchedule[i].Capital -= recovered
+		financialSchedule[i].Interest += recovered
+		capitalised -= recovered
+	}
+
+	var marketedSchedule []Installment
+	for i := interval; i <= len(financialSchedule); i += interval {
+		inst := Installment{DueDate: financialSchedule[i-1].MonthlyDate}
+		for j := i - interval; j < i; j++ {
+			inst.Capital += financialSchedule[j].Capital
+			inst.Interest += financialSchedule[j].Interest
+			financialSchedule[j].MarketedDueDate = inst.DueDate
+		}
+		financialSchedule[i-1].MarketedInstallment = 1
+		financialSchedule[i-1].MarketedCapital = inst.Capital
+		financialSchedule[i-1].MarketedInterest = inst.Interest
+		marketedSchedule = append(marketedSchedule, inst)
+	}
+
+	if len(marketedSchedule) == 0 {
+		return nil, nil, fmt.Errorf("loan: no installments in %d grace and %d repayment periods", t.GracePeriods, repayments)
+	}
+	return marketedSchedule, financialSchedule, nil
+}
@@ -0,0 +1,168 @@
+package loan
+
+import (
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+func TestCreateStructured(t *testing.T) {
+	monthly := func(periods int, grace Grace, balloon float64) Terms {
+		return Terms{Capital: 120000, Rate: 24, Installments: 12, InstallmentInterval: 1, InitiationDate: "2026-01-15", GracePeriods: periods, Grace: grace, Balloon: balloon}
+	}
+	quarterly := func(periods int, grace Grace, balloon float64) Terms {
+		return Terms{Capital: 120000, Rate: 24, Installments: 4, InstallmentInterval: 3, InitiationDate: "2026-01-31", GracePeriods: periods, Grace: grace, Balloon: balloon}
+	}
+
+	tests := []struct {
+		name      string
+		method    Method
+		terms     Terms
+		marketed  int
+		financial int
+		interest  money.Amount
+		// first and last are the marketed rentals of the first and last
+		// installments
+		first money.Amount
+		last  money.Amount
+	}{
+		{
+			name:      "capital grace defers the first installments",
+			method:    MethodReducing,
+			terms:     monthly(3, GraceCapital, 0),
+			marketed:  9,
+			financial: 9,
+			interest:  2007946,
+			first:     1669634,
+			last:      1443243,
+		},
+		{
+			name:      "interest only grace collects interest",
+			method:    MethodReducing,
+			terms:     monthly(3, GraceInterestOnly, 0),
+			marketed:  12,
+			financial: 12,
+			interest:  1920000,
+			first:     240000,
+			last:      1360003,
+		},
+		{
+			name:      "reducing balloon is added to the last installment",
+			method:    MethodReducing,
+			terms:     monthly(0, "", 24000),
+			marketed:  12,
+			financial: 12,
+			interest:  1824000,
+			first:     1040000,
+			last:      3264000,
+		},
+		{
+			name:      "annuity balloon",
+			method:    MethodAnnuity,
+			terms:     monthly(0, "", 20000),
+			marketed:  12,
+			financial: 12,
+			interest:  1827153,
+			first:     985596,
+			last:      2985597,
+		},
+		{
+			name:      "annuity capital grace and balloon",
+			method:    MethodAnnuity,
+			terms:     monthly(2, GraceCapital, 20000),
+			marketed:  10,
+			financial: 10,
+			interest:  2072363,
+			first:     1207236,
+			last:      3207239,
+		},
+		{
+			name:      "IRR interest only grace",
+			method:    MethodIRR,
+			terms:     quarterly(1, GraceInterestOnly, 0),
+			marketed:  4,
+			financial: 12,
+			interest:  1951667,
+			first:     720000,
+			last:      4410557,
+		},
+		{
+			name:      "IRR balloon",
+			method:    MethodIRR,
+			terms:     quarterly(0, "", 30000),
+			marketed:  4,
+			financial: 12,
+			interest:  1932436,
+			first:     2733108,
+			last:      5733112,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marketed, financial, err := Create(tt.method, tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(marketed) != tt.marketed {
+				t.Errorf("marketed installments = %d, want %d", len(marketed), tt.marketed)
+			}
+			if len(financial) != tt.financial {
+				t.Errorf("financial installments = %d, want %d", len(financial), tt.financial)
+			}
+
+			var mCapital, mInterest, fCapital, fInterest money.Amount
+			for _, inst := range marketed {
+				mCapital += inst.Capital
+				mInterest += inst.Interest
+			}
+			for _, inst := range financial {
+				fCapital += inst.Capital
+				fInterest += inst.Interest
+			}
+
+			capital := money.FromFloat(tt.terms.Capital)
+			if mCapital != capital || fCapital != capital {
+				t.Errorf("capital = %v marketed, %v financial, want %v", mCapital, fCapital, capital)
+			}
+			if mInterest != tt.interest || fInterest != tt.interest {
+				t.Errorf("interest = %v marketed, %v financial, want %v", mInterest, fInterest, tt.interest)
+			}
+
+			if len(marketed) == 0 {
+				return
+			}
+			if first := marketed[0].Capital + marketed[0].Interest; first != tt.first {
+				t.Errorf("first rental = %v, want %v", first, tt.first)
+			}
+			if last := marketed[len(marketed)-1].Capital + marketed[len(marketed)-1].Interest; last != tt.last {
+				t.Errorf("last rental = %v, want %v", last, tt.last)
+			}
+		})
+	}
+}
+
+func TestStructureErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method Method
+		terms  Terms
+		term   string
+	}{
+		{"flat is not offered", MethodFlat, Terms{Capital: 1000, Installments: 12, GracePeriods: 2, Grace: GraceCapital}, "method"},
+		{"grace periods must be less than installments", MethodReducing, Terms{Capital: 1000, Installments: 12, GracePeriods: 12, Grace: GraceCapital}, "grace_periods"},
+		{"grace kind is required", MethodReducing, Terms{Capital: 1000, Installments: 12, GracePeriods: 2}, "grace"},
+		{"grace kind requires periods", MethodReducing, Terms{Capital: 1000, Installments: 12, Grace: GraceInterestOnly}, "grace"},
+		{"balloon must be less than the capital", MethodAnnuity, Terms{Capital: 1000, Installments: 12, Balloon: 1000}, "balloon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.terms.structureErrors(tt.method)
+			if _, ok := errs[tt.term]; !ok {
+				t.Errorf("errors = %v, want %s", errs, tt.term)
+			}
+		})
+	}
+}
@@ -4,74 +4,101 @@ import (
 	"fmt"
 	"math"
 	"time"
+
+	"github.com/ssrdive/cidium/pkg/money"
 )
 
 // Installment holds an installment of the marketed rental schedule
 type Installment struct {
-	Capital         float64 `json:"capital"`
-	Interest        float64 `json:"interest"`
-	DefaultInterest float64 `json:"default_interest"`
-	DueDate         string  `json:"due_date"`
+	Capital         money.Amount `json:"capital"`
+	Interest        money.Amount `json:"interest"`
+	DefaultInterest money.Amount `json:"default_interest"`
+	DueDate         string       `json:"due_date"`
 }
 
 // InstallmentSchedule holds an installment of the financial rental schedule
 type InstallmentSchedule struct {
-	Capital             float64 `json:"capital"`
-	Interest            float64 `json:"interest"`
-	MonthlyDate         string  `json:"due_date"`
-	MarketedInstallment int     `json:"marketed_installment"`
-	MarketedCapital     float64 `json:"marketed_capital"`
-	MarketedInterest    float64 `json:"marketed_interest"`
-	MarketedDueDate     string  `json:"marketed_due_date"`
+	Capital             money.Amount `json:"capital"`
+	Interest            money.Amount `json:"interest"`
+	MonthlyDate         string       `json:"due_date"`
+	MarketedInstallment int          `json:"marketed_installment"`
+	MarketedCapital     money.Amount `json:"marketed_capital"`
+	MarketedInterest    money.Amount `json:"marketed_interest"`
+	MarketedDueDate     string       `json:"marketed_due_date"`
 }
 
-// Create creates marketed and financial rental schedule
-func Create(capital, rate float64, installments, installmentInterval, structuredMonthlyRental int, initiationDate, method string) ([]Installment, []InstallmentSchedule, error) {
-	initDate, err := time.Parse("2006-01-02 15:04:05", fmt.Sprintf("%s 00:00:00", initiationDate))
-	if initDate.Day() > 28 {
-		initDate = initDate.AddDate(0, 0, -(initDate.Day() - 28))
+// Create creates the marketed and financial rental schedules of the terms
+// with an interest method. Terms are not validated against a product; use
+// Product.Create to create schedules offered by a product. Terms with grace
+// periods or a balloon are scheduled by createStructured and seasonal plans
+// by createSeasonal
+func Create(method Method, t Terms) ([]Installment, []InstallmentSchedule, error) {
+	if !method.Valid() {
+		return nil, nil, ErrUnknownMethod
+	}
+	if method == MethodSeasonal || len(t.Plan) > 0 {
+		if errs := t.planErrors(method); len(errs) > 0 {
+			return nil, nil, errs
+		}
+		return createSeasonal(t)
 	}
+	if t.structured() {
+		if errs := t.structureErrors(method); len(errs) > 0 {
+			return nil, nil, errs
+		}
+		return createStructured(method, t)
+	}
+
+	capital, rate := t.Capital, t.Rate
+	installments, installmentInterval := t.Installments, t.InstallmentInterval
+	structuredMonthlyRental, initiationDate := t.StructuredMonthlyRental, t.InitiationDate
+
+	initDate, err := time.Parse("2006-01-02 15:04:05", fmt.Sprintf("%s 00:00:00", initiationDate))
 	if err != nil {
 		return nil, nil, err
 	}
+	if initDate.Day() > 28 {
+		initDate = initDate.AddDate(0, 0, -(initDate.Day() - 28))
+	}
 
-	installmentCapital := math.Round((capital/float64(installments))*100) / 100
+	capitalAmount := money.FromFloat(capital)
+	installmentCapital := money.FromFloat(capital / float64(installments))
 	marketedSchedule := make([]Installment, installments)
 	financialSchedule := make([]InstallmentSchedule, installmentInterval*installments)
 
-	if method == "R2" && structuredMonthlyRental > 0 && installmentInterval > 2 {
+	if method == MethodAnnuity && structuredMonthlyRental > 0 && installmentInterval > 2 {
 		marketedSchedule = make([]Installment, installments*installmentInterval)
 
-		installmentCapital = installmentCapital - float64((structuredMonthlyRental * (installmentInterval - 1)))
+		installmentCapital = installmentCapital - money.Amount(structuredMonthlyRental*(installmentInterval-1)*100)
 
 		P := capital
 		r := rate / float64(12) / 100
 		n := installmentInterval * installments
 
-		payment := math.Round((P*r*(math.Pow(1+r, float64(n))/(math.Pow(1+r, float64(n))-1)))*100) / 100
+		payment := money.FromFloat(P * r * (math.Pow(1+r, float64(n)) / (math.Pow(1+r, float64(n)) - 1)))
 
-		capitalTotal := float64(0)
+		capitalTotal := money.Amount(0)
 		// instInterest := (rate / (float64(12) / float64(installmentInterval))) * 0.01
 		for i := 1; i <= n; i++ {
 			if i%installmentInterval == 0 {
-				instInterest := float64(0)
+				instInterest := money.Amount(0)
 				for j := (i - installmentInterval) + 1; j <= i; j++ {
-					rentalInterest := math.Round((((P*r)-payment)*math.Pow((r+1), (float64(j)-1))+payment)*100) / 100
+					rentalInterest := periodInterest(P, r, payment, j)
 					instInterest = instInterest + rentalInterest
 				}
 
 				initDate = initDate.AddDate(0, 1, 0)
 				marketedSchedule[i-1] = Installment{
 					Capital:         installmentCapital,
-					Interest:        math.Round(instInterest*100) / 100,
+					Interest:        instInterest,
 					DefaultInterest: 0,
 					DueDate:         initDate.Format("2006-01-02"),
 				}
 			} else {
-				capitalTotal += float64(structuredMonthlyRental)
+				capitalTotal += money.Amount(structuredMonthlyRental * 100)
 				initDate = initDate.AddDate(0, 1, 0)
 				marketedSchedule[i-1] = Installment{
-					Capital:         float64(structuredMonthlyRental),
+					Capital:         money.Amount(structuredMonthlyRental * 100),
 					Interest:        0,
 					DefaultInterest: 0,
 					DueDate:         initDate.Format("2006-01-02"),
@@ -79,19 +106,19 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 			}
 		}
 
-		capitalTotal += installmentCapital * float64(installments)
-		capitalDiff := math.Round((capital-capitalTotal)*100) / 100
-		marketedSchedule[n-1].Capital = math.Round((marketedSchedule[n-1].Capital+capitalDiff)*100) / 100
+		capitalTotal += installmentCapital * money.Amount(installments)
+		capitalDiff := capitalAmount - capitalTotal
+		marketedSchedule[n-1].Capital += capitalDiff
 
 		initDate, err = time.Parse("2006-01-02 15:04:05", fmt.Sprintf("%s 00:00:00", initiationDate))
 		if initDate.Day() > 28 {
 			initDate = initDate.AddDate(0, 0, -(initDate.Day() - 28))
 		}
-		capitalTotal = float64(0)
+		capitalTotal = money.Amount(0)
 		for i := 1; i <= n; i++ {
 			initDate = initDate.AddDate(0, 1, 0)
-			rentalInterest := math.Round((((P*r)-payment)*math.Pow((r+1), (float64(i)-1))+payment)*100) / 100
-			rentalCapital := math.Round((payment-rentalInterest)*100) / 100
+			rentalInterest := periodInterest(P, r, payment, i)
+			rentalCapital := payment - rentalInterest
 			capitalTotal = capitalTotal + rentalCapital
 			financialSchedule[i-1] = InstallmentSchedule{
 				Capital:     rentalCapital,
@@ -104,12 +131,12 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 			financialSchedule[i-1].MarketedInterest = marketedSchedule[i-1].Interest
 			financialSchedule[i-1].MarketedDueDate = marketedSchedule[i-1].DueDate
 		}
-		capitalDiff = math.Round((P-capitalTotal)*100) / 100
-		financialSchedule[n-1].Capital = math.Round((financialSchedule[n-1].Capital+capitalDiff)*100) / 100
-	} else if method == "S" {
+		capitalDiff = capitalAmount - capitalTotal
+		financialSchedule[n-1].Capital += capitalDiff
+	} else if method == MethodFlat {
 		realRate := rate * 0.01
 		interest := (realRate / float64(12)) * float64(installmentInterval) * float64(installments) * capital
-		instInterest := math.Round((interest/float64(installments))*100) / 100
+		instInterest := money.FromFloat(interest / float64(installments))
 		for i := 0; i < installments; i++ {
 			initDate = initDate.AddDate(0, installmentInterval, 0)
 			marketedSchedule[i] = Installment{
@@ -120,57 +147,57 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 			}
 		}
 
-		capitalTotal := installmentCapital * float64(installments)
-		capitalDiff := math.Round((capital-capitalTotal)*100) / 100
-		marketedSchedule[installments-1].Capital = math.Round((marketedSchedule[installments-1].Capital+capitalDiff)*100) / 100
-	} else if method == "R" {
+		capitalTotal := installmentCapital * money.Amount(installments)
+		capitalDiff := capitalAmount - capitalTotal
+		marketedSchedule[installments-1].Capital += capitalDiff
+	} else if method == MethodReducing {
 		instInterest := (rate / (float64(12) / float64(installmentInterval))) * 0.01
 		for i := 0; i < installments; i++ {
 			initDate = initDate.AddDate(0, installmentInterval, 0)
 			marketedSchedule[i] = Installment{
 				Capital:         installmentCapital,
-				Interest:        math.Round(((capital-(installmentCapital*float64(i)))*instInterest)*100) / 100,
+				Interest:        money.FromFloat((capital - installmentCapital.Float64()*float64(i)) * instInterest),
 				DefaultInterest: 0,
 				DueDate:         initDate.Format("2006-01-02"),
 			}
 		}
-	} else if method == "R2" {
+	} else if method == MethodAnnuity {
 		P := capital
 		r := rate / float64(12) / 100
 		n := installmentInterval * installments
 
-		payment := math.Round((P*r*(math.Pow(1+r, float64(n))/(math.Pow(1+r, float64(n))-1)))*100) / 100
+		payment := money.FromFloat(P * r * (math.Pow(1+r, float64(n)) / (math.Pow(1+r, float64(n)) - 1)))
 
 		// instInterest := (rate / (float64(12) / float64(installmentInterval))) * 0.01
 		for i := 1; i <= installments; i++ {
-			instInterest := float64(0)
+			instInterest := money.Amount(0)
 			for j := (i-1)*installmentInterval + 1; j <= i*installmentInterval; j++ {
-				rentalInterest := math.Round((((P*r)-payment)*math.Pow((r+1), (float64(j)-1))+payment)*100) / 100
+				rentalInterest := periodInterest(P, r, payment, j)
 				instInterest = instInterest + rentalInterest
 			}
 
 			initDate = initDate.AddDate(0, installmentInterval, 0)
 			marketedSchedule[i-1] = Installment{
 				Capital:         installmentCapital,
-				Interest:        math.Round(instInterest*100) / 100,
+				Interest:        instInterest,
 				DefaultInterest: 0,
 				DueDate:         initDate.Format("2006-01-02"),
 			}
 		}
 
-		capitalTotal := installmentCapital * float64(installments)
-		capitalDiff := math.Round((capital-capitalTotal)*100) / 100
-		marketedSchedule[installments-1].Capital = math.Round((marketedSchedule[installments-1].Capital+capitalDiff)*100) / 100
+		capitalTotal := installmentCapital * money.Amount(installments)
+		capitalDiff := capitalAmount - capitalTotal
+		marketedSchedule[installments-1].Capital += capitalDiff
 
 		initDate, err = time.Parse("2006-01-02 15:04:05", fmt.Sprintf("%s 00:00:00", initiationDate))
 		if initDate.Day() > 28 {
 			initDate = initDate.AddDate(0, 0, -(initDate.Day() - 28))
 		}
-		capitalTotal = float64(0)
+		capitalTotal = money.Amount(0)
 		for i := 1; i <= n; i++ {
 			initDate = initDate.AddDate(0, 1, 0)
-			rentalInterest := math.Round((((P*r)-payment)*math.Pow((r+1), (float64(i)-1))+payment)*100) / 100
-			rentalCapital := math.Round((payment-rentalInterest)*100) / 100
+			rentalInterest := periodInterest(P, r, payment, i)
+			rentalCapital := payment - rentalInterest
 			capitalTotal = capitalTotal + rentalCapital
 			financialSchedule[i-1] = InstallmentSchedule{
 				Capital:     rentalCapital,
@@ -187,22 +214,22 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 				financialSchedule[i-1].MarketedDueDate = marketedSchedule[i/installmentInterval].DueDate
 			}
 		}
-		capitalDiff = math.Round((P-capitalTotal)*100) / 100
-		financialSchedule[n-1].Capital = math.Round((financialSchedule[n-1].Capital+capitalDiff)*100) / 100
-	} else if method == "IRR" {
+		capitalDiff = capitalAmount - capitalTotal
+		financialSchedule[n-1].Capital += capitalDiff
+	} else if method == MethodIRR {
 		P := capital
 		r := rate / float64(12) / 100
 		n := installmentInterval * installments
 
-		payment := math.Round((P*r*(math.Pow(1+r, float64(n))/(math.Pow(1+r, float64(n))-1)))*100) / 100
+		payment := money.FromFloat(P * r * (math.Pow(1+r, float64(n)) / (math.Pow(1+r, float64(n)) - 1)))
 
-		capitalTotal := float64(0)
+		capitalTotal := money.Amount(0)
 		for i := 1; i <= installments; i++ {
-			instInterest := float64(0)
-			instCapital := float64(0)
+			instInterest := money.Amount(0)
+			instCapital := money.Amount(0)
 			for j := (i-1)*installmentInterval + 1; j <= i*installmentInterval; j++ {
-				rentalInterest := math.Round((((P*r)-payment)*math.Pow((r+1), (float64(j)-1))+payment)*100) / 100
-				rentalCapital := math.Round((payment-rentalInterest)*100) / 100
+				rentalInterest := periodInterest(P, r, payment, j)
+				rentalCapital := payment - rentalInterest
 				instInterest = instInterest + rentalInterest
 				instCapital = instCapital + rentalCapital
 			}
@@ -210,24 +237,24 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 			initDate = initDate.AddDate(0, installmentInterval, 0)
 			marketedSchedule[i-1] = Installment{
 				Capital:         instCapital,
-				Interest:        math.Round(instInterest*100) / 100,
+				Interest:        instInterest,
 				DefaultInterest: 0,
 				DueDate:         initDate.Format("2006-01-02"),
 			}
 			capitalTotal = capitalTotal + instCapital
 		}
-		capitalDiff := math.Round((capital-capitalTotal)*100) / 100
-		marketedSchedule[installments-1].Capital = math.Round((marketedSchedule[installments-1].Capital+capitalDiff)*100) / 100
+		capitalDiff := capitalAmount - capitalTotal
+		marketedSchedule[installments-1].Capital += capitalDiff
 
 		initDate, err = time.Parse("2006-01-02 15:04:05", fmt.Sprintf("%s 00:00:00", initiationDate))
 		if initDate.Day() > 28 {
 			initDate = initDate.AddDate(0, 0, -(initDate.Day() - 28))
 		}
-		capitalTotal = float64(0)
+		capitalTotal = money.Amount(0)
 		for i := 1; i <= n; i++ {
 			initDate = initDate.AddDate(0, 1, 0)
-			rentalInterest := math.Round((((P*r)-payment)*math.Pow((r+1), (float64(i)-1))+payment)*100) / 100
-			rentalCapital := math.Round((payment-rentalInterest)*100) / 100
+			rentalInterest := periodInterest(P, r, payment, i)
+			rentalCapital := payment - rentalInterest
 			capitalTotal = capitalTotal + rentalCapital
 			financialSchedule[i-1] = InstallmentSchedule{
 				Capital:     rentalCapital,
@@ -244,22 +271,20 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 				financialSchedule[i-1].MarketedDueDate = marketedSchedule[i/installmentInterval].DueDate
 			}
 		}
-		capitalDiff = math.Round((P-capitalTotal)*100) / 100
-		financialSchedule[n-1].Capital = math.Round((financialSchedule[n-1].Capital+capitalDiff)*100) / 100
-	} else if method == "SM" {
+		capitalDiff = capitalAmount - capitalTotal
+		financialSchedule[n-1].Capital += capitalDiff
+	} else if method == MethodWeekly {
 		realRate := math.Round((rate*0.01)*100) / 100
 
 		interest := (realRate * (float64(installments) * float64(7) / float64(365))) * capital
-		instInterest := math.Round((interest/float64(installments))*100) / 100
+		instInterest := money.FromFloat(interest / float64(installments))
 
 		for i := 0; i < installments; i++ {
 			initDate = initDate.AddDate(0, 0, 7)
 
-			if initDate.Month() == 4 && initDate.Day() >= 10 && initDate.Day() <= 16 {
-				initDate = initDate.AddDate(0, 0, 7)
-			}
-
-			if initDate.Month() == 12 && initDate.Day() >= 23 && initDate.Day() <= 29 {
+			// Bounded so that a calendar skipping the whole year cannot
+			// hold an installment back forever
+			for weeks := 0; weeks < 53 && t.Calendar.Skips(initDate); weeks++ {
 				initDate = initDate.AddDate(0, 0, 7)
 			}
 
@@ -271,9 +296,9 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 			}
 		}
 
-		capitalTotal := installmentCapital * float64(installments)
-		capitalDiff := math.Round((capital-capitalTotal)*100) / 100
-		marketedSchedule[installments-1].Capital = math.Round((marketedSchedule[installments-1].Capital+capitalDiff)*100) / 100
+		capitalTotal := installmentCapital * money.Amount(installments)
+		capitalDiff := capitalAmount - capitalTotal
+		marketedSchedule[installments-1].Capital += capitalDiff
 
 		for i := 0; i < len(financialSchedule); i++ {
 			financialSchedule[i].Capital = marketedSchedule[i].Capital
@@ -288,3 +313,9 @@ func Create(capital, rate float64, installments, installmentInterval, structured
 
 	return marketedSchedule, financialSchedule, nil
 }
+
+// periodInterest returns the interest portion of a reducing balance rental for a period
+func periodInterest(P, r float64, payment money.Amount, period int) money.Amount {
+	p := payment.Float64()
+	return money.FromFloat(((P*r)-p)*math.Pow((r+1), (float64(period)-1)) + p)
+}
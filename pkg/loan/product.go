@@ -0,0 +1,200 @@
+package loan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+// Method is the interest method a schedule is generated with
+type Method string
+
+// Interest methods
+const (
+	// MethodFlat charges interest on the initial capital for the whole tenure
+	MethodFlat Method = "S"
+	// MethodReducing charges interest on the capital outstanding before each
+	// installment, with equal capital installments
+	MethodReducing Method = "R"
+	// MethodAnnuity charges monthly reducing balance interest and collects the
+	// capital in equal installments. Structured monthly rentals may be paid
+	// between installments
+	MethodAnnuity Method = "R2"
+	// MethodIRR collects equal monthly annuity payments grouped into
+	// installments
+	MethodIRR Method = "IRR"
+	// MethodWeekly charges flat interest on weekly installments, moving
+	// installments out of the windows of the skip calendar of the terms
+	MethodWeekly Method = "SM"
+	// MethodSeasonal collects weighted rentals on the due dates of the plan
+	// of the terms, solved for the rate
+	MethodSeasonal Method = "SP"
+)
+
+// ErrUnknownMethod is returned when a schedule is requested for a method
+// that is not supported
+var ErrUnknownMethod = errors.New("loan: unknown method")
+
+// Valid reports whether the method is supported
+func (m Method) Valid() bool {
+	switch m {
+	case MethodFlat, MethodReducing, MethodAnnuity, MethodIRR, MethodWeekly, MethodSeasonal:
+		return true
+	}
+	return false
+}
+
+// Terms are the terms of a loan a schedule is generated for
+type Terms struct {
+	Capital                 float64 `json:"capital"`
+	Rate                    float64 `json:"rate"`
+	Installments            int     `json:"installments"`
+	InstallmentInterval     int     `json:"installment_interval"`
+	StructuredMonthlyRental int     `json:"structured_monthly_rental"`
+	InitiationDate          string  `json:"initiation_date"`
+	// GracePeriods is the number of installments at the start of the tenure
+	// in which no capital is repaid
+	GracePeriods int   `json:"grace_periods"`
+	Grace        Grace `json:"grace"`
+	// Balloon is the capital repaid with the last installment in addition
+	// to its rental
+	Balloon float64 `json:"balloon"`
+	// Plan holds the installments of a seasonal plan
+	Plan []Due `json:"plan,omitempty"`
+	// Calendar holds the windows weekly installments are not due in
+	Calendar Calendar `json:"-"`
+}
+
+// Product defines the loans offered for a contract type. Upper bounds that
+// are zero are not enforced
+type Product struct {
+	ID              int     `json:"id"`
+	ContractTypeID  int     `json:"contract_type_id"`
+	Name            string  `json:"name"`
+	Method          Method  `json:"method"`
+	MinRate         float64 `json:"min_rate"`
+	MaxRate         float64 `json:"max_rate"`
+	MinInstallments int     `json:"min_installments"`
+	MaxInstallments int     `json:"max_installments"`
+	// InstallmentInterval is the number of months between installments. Any
+	// interval is offered when zero
+	InstallmentInterval int          `json:"installment_interval"`
+	MinCapital          money.Amount `json:"min_capital"`
+	MaxCapital          money.Amount `json:"max_capital"`
+	// MaxGracePeriods is the number of installments repayment may be
+	// deferred by
+	MaxGracePeriods int          `json:"max_grace_periods"`
+	DocumentFee     money.Amount `json:"document_fee"`
+	// ProcessingFeeRate is the percentage of the capital charged on
+	// disbursement
+	ProcessingFeeRate float64 `json:"processing_fee_rate"`
+}
+
+// TermsError holds the reasons terms are not offered by a product, by term
+type TermsError map[string]string
+
+func (e TermsError) Error() string {
+	terms := make([]string, 0, len(e))
+	for term, reason := range e {
+		terms = append(terms, term+" "+reason)
+	}
+	sort.Strings(terms)
+	return "loan: terms not offered: " + strings.Join(terms, ", ")
+}
+
+// Validate checks that the product offers the terms. A TermsError is
+// returned when it does not
+func (p Product) Validate(t Terms) error {
+	errs := TermsError{}
+
+	if !p.Method.Valid() {
+		return ErrUnknownMethod
+	}
+	if p.Method == MethodSeasonal {
+		t.Installments, t.InstallmentInterval = len(t.Plan), 1
+	}
+
+	capital := money.FromFloat(t.Capital)
+	switch {
+	case capital <= 0:
+		errs["capital"] = "must be greater than zero"
+	case capital < p.MinCapital:
+		errs["capital"] = "must be at least " + p.MinCapital.String()
+	case p.MaxCapital > 0 && capital > p.MaxCapital:
+		errs["capital"] = "must be at most " + p.MaxCapital.String()
+	}
+
+	switch {
+	case t.Rate < 0:
+		errs["rate"] = "must not be negative"
+	case t.Rate < p.MinRate:
+		errs["rate"] = fmt.Sprintf("must be at least %g", p.MinRate)
+	case p.MaxRate > 0 && t.Rate > p.MaxRate:
+		errs["rate"] = fmt.Sprintf("must be at most %g", p.MaxRate)
+	}
+
+	switch {
+	case t.Installments <= 0:
+		errs["installments"] = "must be greater than zero"
+	case t.Installments < p.MinInstallments:
+		errs["installments"] = fmt.Sprintf("must be at least %d", p.MinInstallments)
+	case p.MaxInstallments > 0 && t.Installments > p.MaxInstallments:
+		errs["installments"] = fmt.Sprintf("must be at most %d", p.MaxInstallments)
+	}
+
+	switch {
+	case t.InstallmentInterval <= 0:
+		errs["installment_interval"] = "must be greater than zero"
+	case p.Method == MethodWeekly && t.InstallmentInterval != 1:
+		errs["installment_interval"] = "must be 1 for weekly installments"
+	case p.InstallmentInterval > 0 && t.InstallmentInterval != p.InstallmentInterval:
+		errs["installment_interval"] = fmt.Sprintf("must be %d", p.InstallmentInterval)
+	}
+
+	switch {
+	case t.StructuredMonthlyRental < 0:
+		errs["structured_monthly_rental"] = "must not be negative"
+	case t.StructuredMonthlyRental > 0 && p.Method != MethodAnnuity:
+		errs["structured_monthly_rental"] = "is only offered with the " + string(MethodAnnuity) + " method"
+	}
+
+	if _, err := time.Parse("2006-01-02", t.InitiationDate); err != nil {
+		errs["initiation_date"] = "must be a date formatted as YYYY-MM-DD"
+	}
+
+	if p.MaxGracePeriods > 0 && t.GracePeriods > p.MaxGracePeriods {
+		errs["grace_periods"] = fmt.Sprintf("must be at most %d", p.MaxGracePeriods)
+	}
+	for _, termErrs := range []TermsError{t.structureErrors(p.Method), t.planErrors(p.Method)} {
+		for term, reason := range termErrs {
+			if _, ok := errs[term]; !ok {
+				errs[term] = reason
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Create validates the terms against the product and creates their marketed
+// and financial rental schedules
+func (p Product) Create(t Terms) ([]Installment, []InstallmentSchedule, error) {
+	err := p.Validate(t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return Create(p.Method, t)
+}
+
+// Fees returns the fees charged on disbursing a capital under the product
+func (p Product) Fees(capital money.Amount) money.Amount {
+	return p.DocumentFee + capital.Mul(p.ProcessingFeeRate/100)
+}
@@ -0,0 +1,159 @@
+package loan
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+// Due is an installment of a seasonal plan. Rentals are in proportion to
+// the weights of their installments
+type Due struct {
+	Date   string  `json:"date"`
+	Weight float64 `json:"weight"`
+}
+
+// ParsePlan parses installments formatted as YYYY-MM-DD:weight. A date
+// without a weight is weighted 1
+func ParsePlan(plan []string) ([]Due, error) {
+	dues := make([]Due, 0, len(plan))
+	for _, s := range plan {
+		s = strings.TrimSpace(s)
+		due := Due{Date: s, Weight: 1}
+		if i := strings.Index(s, ":"); i >= 0 {
+			w, err := strconv.ParseFloat(s[i+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("loan: invalid weight in %q", s)
+			}
+			due = Due{Date: s[:i], Weight: w}
+		}
+		dues = append(dues, due)
+	}
+	return dues, nil
+}
+
+// planErrors returns the reasons a seasonal plan is not offered
+func (t Terms) planErrors(method Method) TermsError {
+	errs := TermsError{}
+	if method != MethodSeasonal {
+		if len(t.Plan) > 0 {
+			errs["plan"] = "is only offered with the " + string(MethodSeasonal) + " method"
+		}
+		return errs
+	}
+
+	if len(t.Plan) == 0 {
+		errs["plan"] = "is required"
+		return errs
+	}
+	prev := t.InitiationDate
+	for i, due := range t.Plan {
+		if _, err := time.Parse("2006-01-02", due.Date); err != nil {
+			errs["plan"] = fmt.Sprintf("installment %d must be dated YYYY-MM-DD", i+1)
+			break
+		}
+		if due.Date <= prev {
+			errs["plan"] = fmt.Sprintf("installment %d must fall due after %s", i+1, prev)
+			break
+		}
+		if due.Weight <= 0 {
+			errs["plan"] = fmt.Sprintf("installment %d must be weighted greater than zero", i+1)
+			break
+		}
+		prev = due.Date
+	}
+	return errs
+}
+
+// createSeasonal creates the schedules of a seasonal plan. Interest is
+// compounded monthly at the rate and accrues by day between installments.
+// The rentals are solved so that their present value at the rate is the
+// capital. The financial schedule is monthly: the interest of an installment
+// is spread by day over the months since the previous installment and its
+// capital is due with the last of them, on the date of the installment
+func createSeasonal(t Terms) ([]Installment, []InstallmentSchedule, error) {
+	if errs := t.planErrors(MethodSeasonal); len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	start, err := time.Parse("2006-01-02", t.InitiationDate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := t.Rate / float64(12) / 100
+	// growth returns the factor interest grows a balance by between dates
+	growth := func(from, to time.Time) float64 {
+		months := to.Sub(from).Hours() / 24 * 12 / 365
+		return math.Pow(1+r, months)
+	}
+
+	dates := make([]time.Time, len(t.Plan))
+	discounted := 0.0
+	for i, due := range t.Plan {
+		dates[i], _ = time.Parse("2006-01-02", due.Date)
+		discounted += due.Weight / growth(start, dates[i])
+	}
+	rental := t.Capital / discounted
+
+	// Months of the financial schedule run from the initiation date, from
+	// the 28th when initiated later in a month
+	monthStart := start
+	if monthStart.Day() > 28 {
+		monthStart = monthStart.AddDate(0, 0, -(monthStart.Day() - 28))
+	}
+	month := 1
+
+	marketedSchedule := make([]Installment, len(t.Plan))
+	var financialSchedule []InstallmentSchedule
+	balance := money.FromFloat(t.Capital)
+	prev := start
+	for i, due := range t.Plan {
+		interest := balance.Mul(growth(prev, dates[i]) - 1)
+		capital := money.FromFloat(rental*due.Weight) - interest
+		if i == len(t.Plan)-1 {
+			capital = balance
+		}
+		balance -= capital
+
+		marketedSchedule[i] = Installment{
+			Capital:  capital,
+			Interest: interest,
+			DueDate:  due.Date,
+		}
+
+		days := dates[i].Sub(prev).Hours() / 24
+		spread := money.Amount(0)
+		from := prev
+		if !monthStart.AddDate(0, month, 0).After(prev) {
+			month++
+		}
+		for ; monthStart.AddDate(0, month, 0).Before(dates[i]); month++ {
+			to := monthStart.AddDate(0, month, 0)
+			monthInterest := interest.Mul(to.Sub(from).Hours() / 24 / days)
+			spread += monthInterest
+			financialSchedule = append(financialSchedule, InstallmentSchedule{
+				Interest:        monthInterest,
+				MonthlyDate:     to.Format("2006-01-02"),
+				MarketedDueDate: due.Date,
+			})
+			from = to
+		}
+		financialSchedule = append(financialSchedule, InstallmentSchedule{
+			Capital:             capital,
+			Interest:            interest - spread,
+			MonthlyDate:         due.Date,
+			MarketedInstallment: 1,
+			MarketedCapital:     capital,
+			MarketedInterest:    interest,
+			MarketedDueDate:     due.Date,
+		})
+		prev = dates[i]
+	}
+
+	return marketedSchedule, financialSchedule, nil
+}
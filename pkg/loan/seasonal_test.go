@@ -0,0 +1,147 @@
+package loan
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+func TestCreateSeasonal(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms Terms
+		// rentals are the solved marketed rentals, in proportion to the
+		// weights of the plan
+		rentals   []money.Amount
+		interest  money.Amount
+		financial []string
+	}{
+		{
+			name: "quarterly harvests",
+			terms: Terms{Capital: 100000, Rate: 24, InitiationDate: "2026-01-15", Plan: []Due{
+				{Date: "2026-04-15", Weight: 1}, {Date: "2026-07-15", Weight: 2}, {Date: "2026-10-15", Weight: 1},
+			}},
+			rentals:  []money.Amount{2810622, 5621244, 2810621},
+			interest: 1242487,
+			financial: []string{
+				"2026-02-15", "2026-03-15", "2026-04-15",
+				"2026-05-15", "2026-06-15", "2026-07-15",
+				"2026-08-15", "2026-09-15", "2026-10-15",
+			},
+		},
+		{
+			name: "initiated late in a month",
+			terms: Terms{Capital: 250000, Rate: 30, InitiationDate: "2026-01-31", Plan: []Due{
+				{Date: "2026-03-10", Weight: 1}, {Date: "2026-08-31", Weight: 3},
+			}},
+			rentals:  []money.Amount{7152469, 21457406},
+			interest: 3609875,
+			financial: []string{
+				"2026-02-28", "2026-03-10",
+				"2026-03-28", "2026-04-28", "2026-05-28", "2026-06-28", "2026-07-28", "2026-08-28", "2026-08-31",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marketed, financial, err := Create(MethodSeasonal, tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rentals := make([]money.Amount, len(marketed))
+			capital, interest := money.Amount(0), money.Amount(0)
+			for i, inst := range marketed {
+				rentals[i] = inst.Capital + inst.Interest
+				capital += inst.Capital
+				interest += inst.Interest
+				if inst.DueDate != tt.terms.Plan[i].Date {
+					t.Errorf("installment %d due %s, want %s", i+1, inst.DueDate, tt.terms.Plan[i].Date)
+				}
+			}
+			if !reflect.DeepEqual(rentals, tt.rentals) {
+				t.Errorf("rentals = %v, want %v", rentals, tt.rentals)
+			}
+			if capital != money.FromFloat(tt.terms.Capital) {
+				t.Errorf("capital = %v, want %v", capital, tt.terms.Capital)
+			}
+			if interest != tt.interest {
+				t.Errorf("interest = %v, want %v", interest, tt.interest)
+			}
+
+			// Rentals per unit of weight differ by no more than a cent of
+			// rounding
+			unit := rentals[0].Float64() / tt.terms.Plan[0].Weight
+			for i, r := range rentals {
+				if d := r.Float64()/tt.terms.Plan[i].Weight - unit; math.Abs(d) > 0.015 {
+					t.Errorf("rental %d = %v for weight %v, want %.2f a unit of weight", i+1, r, tt.terms.Plan[i].Weight, unit)
+				}
+			}
+
+			dates := make([]string, len(financial))
+			financialCapital := money.Amount(0)
+			spread := map[string]money.Amount{}
+			for i, row := range financial {
+				dates[i] = row.MonthlyDate
+				financialCapital += row.Capital
+				spread[row.MarketedDueDate] += row.Interest
+			}
+			if !reflect.DeepEqual(dates, tt.financial) {
+				t.Errorf("financial dates = %v, want %v", dates, tt.financial)
+			}
+			if financialCapital != capital {
+				t.Errorf("financial capital = %v, want %v", financialCapital, capital)
+			}
+			for _, inst := range marketed {
+				if spread[inst.DueDate] != inst.Interest {
+					t.Errorf("financial interest for %s = %v, want %v", inst.DueDate, spread[inst.DueDate], inst.Interest)
+				}
+			}
+		})
+	}
+}
+
+func TestSeasonalPlanErrors(t *testing.T) {
+	plan := []Due{{Date: "2026-04-15", Weight: 1}}
+
+	tests := []struct {
+		name   string
+		method Method
+		terms  Terms
+		err    string
+	}{
+		{"plan with another method", MethodReducing, Terms{InitiationDate: "2026-01-15", Plan: plan}, "is only offered with the " + string(MethodSeasonal) + " method"},
+		{"no plan", MethodSeasonal, Terms{InitiationDate: "2026-01-15"}, "is required"},
+		{"invalid date", MethodSeasonal, Terms{InitiationDate: "2026-01-15", Plan: []Due{{Date: "2026-04-31", Weight: 1}}}, "installment 1 must be dated YYYY-MM-DD"},
+		{"due before initiation", MethodSeasonal, Terms{InitiationDate: "2026-05-01", Plan: plan}, "installment 1 must fall due after 2026-05-01"},
+		{"out of order", MethodSeasonal, Terms{InitiationDate: "2026-01-15", Plan: []Due{{Date: "2026-04-15", Weight: 1}, {Date: "2026-04-15", Weight: 1}}}, "installment 2 must fall due after 2026-04-15"},
+		{"zero weight", MethodSeasonal, Terms{InitiationDate: "2026-01-15", Plan: []Due{{Date: "2026-04-15", Weight: 0}}}, "installment 1 must be weighted greater than zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.terms.planErrors(tt.method)
+			if errs["plan"] != tt.err {
+				t.Errorf("plan error = %q, want %q", errs["plan"], tt.err)
+			}
+		})
+	}
+}
+
+func TestParsePlan(t *testing.T) {
+	dues, err := ParsePlan([]string{" 2026-04-15:1.5", "2026-07-15"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Due{{Date: "2026-04-15", Weight: 1.5}, {Date: "2026-07-15", Weight: 1}}
+	if !reflect.DeepEqual(dues, want) {
+		t.Errorf("ParsePlan() = %v, want %v", dues, want)
+	}
+
+	if _, err := ParsePlan([]string{"2026-04-15:heavy"}); err == nil {
+		t.Error("ParsePlan() with an invalid weight error = nil")
+	}
+}
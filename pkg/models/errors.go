@@ -0,0 +1,83 @@
+package models
+
+import "strings"
+
+// Kind classifies domain errors so that handlers can respond with a
+// matching status
+type Kind int
+
+// Kinds of domain errors
+const (
+	KindInvalid Kind = iota + 1
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUnprocessable
+)
+
+// Error is a domain error returned by models. Code is a stable identifier
+// clients can rely on and Fields holds errors of individual request fields
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  map[string]string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return "models: " + e.Message
+	}
+
+	fields := make([]string, 0, len(e.Fields))
+	for f, m := range e.Fields {
+		fields = append(fields, f+" "+m)
+	}
+	return "models: " + e.Message + ": " + strings.Join(fields, ", ")
+}
+
+// NewFieldError returns an invalid request error for fields
+func NewFieldError(fields map[string]string) *Error {
+	return &Error{Kind: KindInvalid, Code: "invalid_fields", Message: "request has invalid fields", Fields: fields}
+}
+
+var ErrNoRecord = &Error{Kind: KindNotFound, Code: "not_found", Message: "no matching record found"}
+
+var ErrReceiptNotReversible = &Error{Kind: KindConflict, Code: "receipt_not_reversible", Message: "receipt cannot be reversed"}
+
+var ErrContractSettled = &Error{Kind: KindConflict, Code: "contract_settled", Message: "contract is already settled"}
+
+var ErrSettlementChanged = &Error{Kind: KindConflict, Code: "settlement_changed", Message: "settlement amount does not match quotation"}
+
+var ErrRescheduleNotAllowed = &Error{Kind: KindConflict, Code: "reschedule_not_allowed", Message: "contract cannot be rescheduled"}
+
+var ErrImportHeader = &Error{Kind: KindInvalid, Code: "import_header", Message: "import file requires amount and contract_id or reference columns"}
+
+var ErrWeakPassword = &Error{Kind: KindInvalid, Code: "weak_password", Message: "password is too short", Fields: map[string]string{"password": "too short"}}
+
+var ErrTOTPEnabled = &Error{Kind: KindConflict, Code: "totp_enabled", Message: "two-factor authentication is already enabled"}
+
+var ErrInvalidTOTP = &Error{Kind: KindInvalid, Code: "invalid_totp", Message: "invalid two-factor authentication code"}
+
+var ErrUnknownRole = &Error{Kind: KindInvalid, Code: "unknown_role", Message: "role does not exist", Fields: map[string]string{"role": "unknown role"}}
+
+var ErrRoleAboveActor = &Error{Kind: KindForbidden, Code: "role_above_actor", Message: "user holds permissions the administrator does not"}
+
+var ErrSelfAdministration = &Error{Kind: KindForbidden, Code: "self_administration", Message: "administrators cannot act on their own user"}
+
+var ErrDropdownFilter = &Error{Kind: KindInvalid, Code: "dropdown_filter", Message: "dropdown cannot be filtered by column"}
+
+var ErrInvalidRefreshToken = &Error{Kind: KindUnauthorized, Code: "invalid_refresh_token", Message: "refresh token is invalid, expired or revoked"}
+
+var ErrPaymentExceedsPayables = &Error{Kind: KindUnprocessable, Code: "payment_exceeds_payables", Message: "payment exceeds payables"}
+
+var ErrRebateExceedsInterest = &Error{Kind: KindUnprocessable, Code: "rebate_exceeds_interest", Message: "rebate exceeds payable interest"}
+
+var ErrLiaisonContactMissing = &Error{Kind: KindUnprocessable, Code: "liaison_contact_missing", Message: "liaison contact not provided"}
+
+var ErrInvalidCommitmentType = &Error{Kind: KindInvalid, Code: "invalid_commitment_type", Message: "invalid commitment type"}
+
+var ErrEODRunning = &Error{Kind: KindConflict, Code: "eod_running", Message: "day-end is already running for the date"}
+
+var ErrUnsupportedMethod = &Error{Kind: KindInvalid, Code: "unsupported_method", Message: "unsupported interest method"}
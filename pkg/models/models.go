@@ -2,19 +2,23 @@ package models
 
 import (
 	"database/sql"
-	"errors"
 	"time"
-)
 
-var ErrNoRecord = errors.New("models: no matching record found")
+	"github.com/ssrdive/cidium/pkg/money"
+)
 
 type UserResponse struct {
-	ID         int            `json:"id"`
-	Username   string         `json:"username"`
-	Name       string         `json:"name"`
-	Role       string         `json:"role"`
-	Token      string         `json:"token"`
-	AccessKeys []AccessLevels `json:"access_keys"`
+	ID           int            `json:"id"`
+	Username     string         `json:"username"`
+	Name         string         `json:"name"`
+	Role         string         `json:"role"`
+	Token        string         `json:"token"`
+	RefreshToken string         `json:"refresh_token"`
+	AccessKeys   []AccessLevels `json:"access_keys"`
+	Permissions  []string       `json:"permissions"`
+	// TOTPEnrolmentRequired is set when the user must enrol in two-factor
+	// authentication before being granted permissions
+	TOTPEnrolmentRequired bool `json:"totp_enrolment_required"`
 }
 
 type User struct {
@@ -26,13 +30,30 @@ type User struct {
 	CreatedAt time.Time
 }
 
+type UserSummary struct {
+	ID        int            `json:"id"`
+	GroupID   sql.NullInt32  `json:"group_id"`
+	Username  string         `json:"username"`
+	Name      string         `json:"name"`
+	Role      sql.NullString `json:"role"`
+	Disabled  bool           `json:"disabled"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
 type JWTUser struct {
-	ID         int
-	Username   string
-	Password   string
-	Name       string
-	Type       string
-	AccessKeys []AccessLevels `json:"access_keys"`
+	ID          int
+	Username    string
+	Password    string
+	Name        string
+	Type        string
+	AccessKeys  []AccessLevels `json:"access_keys"`
+	Permissions []string       `json:"permissions"`
+	TOTP        bool           `json:"-"`
 }
 
 type Dropdown struct {
@@ -40,6 +61,14 @@ type Dropdown struct {
 	Name string `json:"name"`
 }
 
+// DropdownQuery holds the optional search and paging of a dropdown.
+// All items are returned when Limit is zero
+type DropdownQuery struct {
+	Search string
+	Limit  int
+	Offset int
+}
+
 type DropdownAccount struct {
 	ID        string `json:"id"`
 	AccountID int    `json:"account_id"`
@@ -142,17 +171,17 @@ type RejectedRequest struct {
 type ContractPayable struct {
 	InstallmentID   int
 	ContractID      int
-	CapitalPayable  float64
-	InterestPayable float64
-	DefaultInterest float64
+	CapitalPayable  money.Amount
+	InterestPayable money.Amount
+	DefaultInterest money.Amount
 }
 
 type DebitPayable struct {
 	InstallmentID     int
 	ContractID        int
-	CapitalPayable    float64
-	InterestPayable   float64
-	DefaultInterest   float64
+	CapitalPayable    money.Amount
+	InterestPayable   money.Amount
+	DefaultInterest   money.Amount
 	UnearnedAccountID int
 	IncomeAccountID   int
 }
@@ -160,9 +189,9 @@ type DebitPayable struct {
 type DebitPayableLKAS17 struct {
 	InstallmentID       int
 	ContractID          int
-	CapitalPayable      float64
-	InterestPayable     float64
-	DefaultInterest     float64
+	CapitalPayable      money.Amount
+	InterestPayable     money.Amount
+	DefaultInterest     money.Amount
 	ExpenseAccountID    int
 	ReceivableAccountID int
 }
@@ -181,13 +210,13 @@ type ContractDefaultInterestUpdate struct {
 type ContractPayment struct {
 	ContractInstallmentID int
 	ContractReceiptID     int64
-	Amount                float64
+	Amount                money.Amount
 }
 
 type DebitPayment struct {
 	ContractInstallmentID int
 	ContractReceiptID     int64
-	Amount                float64
+	Amount                money.Amount
 	UnearnedAccountID     int
 	IncomeAccountID       int
 }
@@ -195,7 +224,7 @@ type DebitPayment struct {
 type DebitPaymentLKAS17 struct {
 	ContractInstallmentID int
 	ContractReceiptID     int64
-	Amount                float64
+	Amount                money.Amount
 	ExpenseAccountID      int
 	ReceivableAccountID   int
 }
@@ -350,9 +379,9 @@ type TimelineRow struct {
 	Grouping       int16
 	ContractID     int16
 	Type           string
-	Amount         float64
+	Amount         money.Amount
 	Date           time.Time
-	Change         float64
+	Change         money.Amount
 	Days           int
 	DaysCumulative int
 }
@@ -360,7 +389,7 @@ type TimelineRow struct {
 type ContractBalanceChangeRow struct {
 	ContractID int16
 	Type       string
-	Amount     float64
+	Amount     money.Amount
 	Date       string
 }
 
@@ -399,11 +428,11 @@ type CSQASearchResult struct {
 }
 
 type FloatReceipts struct {
-	ID       int       `json:"id"`
-	UserID   int       `json:"user_id"`
-	Amount   float64   `json:"amount"`
-	Date     string    `json:"date"`
-	Datetime time.Time `json:"datetime"`
+	ID       int          `json:"id"`
+	UserID   int          `json:"user_id"`
+	Amount   money.Amount `json:"amount"`
+	Date     string       `json:"date"`
+	Datetime time.Time    `json:"datetime"`
 }
 
 type FloatReceiptsClient struct {
@@ -482,3 +511,139 @@ type ContractLegacyFinancial struct {
 	DueDate         string  `json:"due_date"`
 	DueIn           string  `json:"due_in"`
 }
+
+type Notification struct {
+	ID         int    `json:"id"`
+	Gateway    string `json:"gateway"`
+	Recipients string `json:"recipients"`
+	Message    string `json:"message"`
+	Attempts   int    `json:"attempts"`
+}
+
+type ContractNotification struct {
+	ID            int            `json:"id"`
+	Gateway       string         `json:"gateway"`
+	Recipients    string         `json:"recipients"`
+	Message       string         `json:"message"`
+	Status        string         `json:"status"`
+	Attempts      int            `json:"attempts"`
+	LastError     sql.NullString `json:"last_error"`
+	CreatedAt     time.Time      `json:"created_at"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	SentAt        sql.NullTime   `json:"sent_at"`
+}
+
+type ReceiptReversalTarget struct {
+	ContractID int
+	LKAS17     int
+	Reversed   int
+	Latest     int
+	Snapshot   int
+}
+
+type ReceiptAllocation struct {
+	PaymentTypeID int
+	ScheduleID    int
+	Amount        money.Amount
+}
+
+type ReceiptDefaultDebitNote struct {
+	ScheduleID int
+	Amount     money.Amount
+}
+
+type TransactionEntry struct {
+	AccountID int          `json:"account_id"`
+	Type      string       `json:"type"`
+	Amount    money.Amount `json:"amount"`
+}
+
+type ReceiptPreview struct {
+	Float          bool                       `json:"float"`
+	Allocations    []ReceiptPreviewAllocation `json:"allocations"`
+	Status         *ReceiptPreviewStatus      `json:"status"`
+	JournalEntries []TransactionEntry         `json:"journal_entries"`
+}
+
+type ReceiptPreviewAllocation struct {
+	Schedule    string `json:"schedule"`
+	PaymentType string `json:"payment_type"`
+	// ScheduleID is zero for the debit note raised from the pending default
+	ScheduleID int          `json:"schedule_id"`
+	Amount     money.Amount `json:"amount"`
+}
+
+type ReceiptPreviewStatus struct {
+	RecoveryStatus     string       `json:"recovery_status"`
+	Doubtful           int          `json:"doubtful"`
+	CapitalArrears     money.Amount `json:"capital_arrears"`
+	InterestArrears    money.Amount `json:"interest_arrears"`
+	CapitalProvisioned money.Amount `json:"capital_provisioned"`
+}
+
+type ReceiptImportResult struct {
+	Row        int          `json:"row"`
+	Reference  string       `json:"reference"`
+	ContractID int          `json:"contract_id"`
+	Amount     money.Amount `json:"amount"`
+	Status     string       `json:"status"`
+	ReceiptID  int64        `json:"receipt_id"`
+	Error      string       `json:"error"`
+}
+
+type SettlementQuote struct {
+	ContractID         int          `json:"contract_id"`
+	LKAS17             bool         `json:"lkas_17"`
+	SettlementDate     string       `json:"settlement_date"`
+	CapitalOutstanding money.Amount `json:"capital_outstanding"`
+	CapitalArrears     money.Amount `json:"capital_arrears"`
+	InterestArrears    money.Amount `json:"interest_arrears"`
+	ChargesDebits      money.Amount `json:"charges_debits"`
+	DefaultInterest    money.Amount `json:"default_interest"`
+	UnearnedInterest   money.Amount `json:"unearned_interest"`
+	Rebate             money.Amount `json:"rebate"`
+	SettlementAmount   money.Amount `json:"settlement_amount"`
+}
+
+type Settlement struct {
+	ReceiptID int64 `json:"receipt_id"`
+	RebateID  int64 `json:"rebate_id"`
+}
+
+type RescheduleInstallment struct {
+	ID                   int
+	Capital              money.Amount
+	CapitalPaid          money.Amount
+	Interest             money.Amount
+	InterestPaid         money.Amount
+	Installment          money.Amount
+	InstallmentPaid      money.Amount
+	MarketedCapital      money.Amount
+	MarketedCapitalPaid  money.Amount
+	MarketedInterest     money.Amount
+	MarketedInterestPaid money.Amount
+}
+
+type EODRun struct {
+	ID              int            `json:"id"`
+	RunDate         string         `json:"run_date"`
+	Status          string         `json:"status"`
+	RentalsPosted   int            `json:"rentals_posted"`
+	StatusChanges   int            `json:"status_changes"`
+	DefaultsAccrued int            `json:"defaults_accrued"`
+	DefaultAmount   money.Amount   `json:"default_amount"`
+	RentalsDone     int            `json:"rentals_done"`
+	DefaultsDone    int            `json:"defaults_done"`
+	StartedAt       time.Time      `json:"started_at"`
+	CompletedAt     sql.NullTime   `json:"completed_at"`
+	LastError       sql.NullString `json:"last_error"`
+}
+
+type DefaultInterestArrears struct {
+	ContractID int
+	Arrears    money.Amount
+	// ArrearsSince is the due date of the oldest installment in arrears
+	ArrearsSince string
+	// LastAccrual is the date default interest was last accrued, empty if never
+	LastAccrual string
+}
@@ -2,17 +2,17 @@ package mysql
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
-	"math"
-	"net/http"
 	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/ssrdive/cidium/pkg/allocation"
 	"github.com/ssrdive/cidium/pkg/loan"
 	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/notify"
 	"github.com/ssrdive/cidium/pkg/sql/queries"
 	"github.com/ssrdive/mysequel"
 	"github.com/ssrdive/scribe"
@@ -24,6 +24,9 @@ import (
 type ContractModel struct {
 	DB            *sql.DB
 	ReceiptLogger *log.Logger
+	Recipients    notify.Recipients
+	// Calendar holds the windows weekly installments are not due in
+	Calendar loan.Calendar
 }
 
 // Insert creates a new contract
@@ -40,6 +43,12 @@ func (m *ContractModel) Insert(initialState string, ctid int, rparams, oparams [
 		_ = tx.Commit()
 	}()
 
+	cid, err := insertContract(tx, initialState, ctid, rparams, oparams, form)
+	return cid, err
+}
+
+// insertContract creates a contract in its initial state
+func insertContract(tx *sql.Tx, initialState string, ctid int, rparams, oparams []string, form url.Values) (int64, error) {
 	cid, err := mysequel.Insert(mysequel.FormTable{
 		TableName: "contract",
 		RCols:     rparams,
@@ -58,14 +67,12 @@ func (m *ContractModel) Insert(initialState string, ctid int, rparams, oparams [
 		Tx:        tx,
 	})
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
 	var isid int
 	err = tx.QueryRow(queries.STATE_ID_FROM_STATE, initialState, ctid).Scan(&isid)
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
@@ -85,6 +92,9 @@ func (m *ContractModel) Insert(initialState string, ctid int, rparams, oparams [
 		Vals:      []interface{}{sid, time.Now().Format("2006-01-02 15:04:05")},
 		Tx:        tx,
 	})
+	if err != nil {
+		return 0, err
+	}
 
 	_, err = mysequel.Update(mysequel.UpdateTable{
 		Table: mysequel.Table{
@@ -103,11 +113,13 @@ func (m *ContractModel) Insert(initialState string, ctid int, rparams, oparams [
 	return cid, nil
 }
 
-// Legacy creates a new legacy contract
-func (m *ContractModel) Legacy(cid int, form url.Values) error {
+// Legacy creates an active contract migrated from the legacy system with
+// its schedule. The terms were agreed under the legacy system, so they are
+// not validated against the current loan product
+func (m *ContractModel) Legacy(rparams, oparams []string, form url.Values) (int64, error) {
 	tx, err := m.DB.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() {
 		if err != nil {
@@ -117,30 +129,42 @@ func (m *ContractModel) Legacy(cid int, form url.Values) error {
 		_ = tx.Commit()
 	}()
 
-	capital, err := strconv.ParseFloat(form.Get("capital"), 32)
-	rate, err := strconv.ParseFloat(form.Get("rate"), 32)
-	installments, err := strconv.Atoi(form.Get("installments"))
-	installmentInterval, err := strconv.Atoi(form.Get("installment_interval"))
-	method := form.Get("method")
-	initiationDate := form.Get("initiation_date")
+	terms, err := answeredTerms(map[string]string{
+		questionCapital:             form.Get("capital"),
+		questionRate:                form.Get("rate"),
+		questionInstallments:        form.Get("installments"),
+		questionInstallmentInterval: form.Get("installment_interval"),
+		questionInitiationDate:      form.Get("initiation_date"),
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	marketedSchedule, _, err := loan.Create(capital, rate, installments, installmentInterval, 0, initiationDate, method)
+	contractTypeID, err := strconv.Atoi(form.Get("contract_type_id"))
 	if err != nil {
-		return err
+		return 0, models.NewFieldError(map[string]string{"contract_type_id": "must be a whole number"})
+	}
+
+	terms.Calendar = m.Calendar
+	marketedSchedule, _, err := loan.Create(loan.Method(form.Get("method")), terms)
+	if err != nil {
+		err = scheduleError(err)
+		return 0, err
+	}
+
+	cid, err := insertContract(tx, "Active", contractTypeID, rparams, oparams, form)
+	if err != nil {
+		return 0, err
 	}
 
 	var citid int
 	err = tx.QueryRow(queries.INSTALLMENT_INSTALLMENT_TYPE_ID).Scan(&citid)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return 0, err
 	}
 
-	capitalAmount := 0.0
-	interestAmount := 0.0
+	capitalAmount := money.Amount(0)
+	interestAmount := money.Amount(0)
 	for _, inst := range marketedSchedule {
 		capitalAmount += inst.Capital
 		interestAmount += inst.Interest
@@ -151,8 +175,7 @@ func (m *ContractModel) Legacy(cid int, form url.Values) error {
 			Tx:        tx,
 		})
 		if err != nil {
-			tx.Rollback()
-			return err
+			return 0, err
 		}
 	}
 	fullRecievables := capitalAmount + interestAmount
@@ -164,23 +187,21 @@ func (m *ContractModel) Legacy(cid int, form url.Values) error {
 		Tx:        tx,
 	})
 	if err != nil {
-		tx.Rollback()
-		return err
+		return 0, err
 	}
 
 	journalEntries := []smodels.JournalEntry{
-		{fmt.Sprintf("%d", 95), "", fmt.Sprintf("%f", capital)},
-		{fmt.Sprintf("%d", 78), "", fmt.Sprintf("%f", interestAmount)},
-		{fmt.Sprintf("%d", 25), fmt.Sprintf("%f", fullRecievables), ""},
+		{fmt.Sprintf("%d", 95), "", capitalAmount.String()},
+		{fmt.Sprintf("%d", 78), "", interestAmount.String()},
+		{fmt.Sprintf("%d", 25), fullRecievables.String(), ""},
 	}
 
 	err = scribe.IssueJournalEntries(tx, tid, journalEntries)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return 0, err
 	}
 
-	return nil
+	return cid, nil
 }
 
 // WorkDocuments returns documents to be completed at the current stage of the contract
@@ -503,24 +524,21 @@ func (m *ContractModel) MicroLoanDetails(cid int) ([]models.Question, error) {
 		details[param.ID] = param.Name
 	}
 
-	capital, err := strconv.ParseFloat(details["Capital"], 32)
-	rate, err := strconv.ParseFloat(details["Interest Rate"], 32)
-	installments, err := strconv.Atoi(details["Installments"])
-	installmentInterval, err := strconv.Atoi(details["Installment Interval"])
-	method := details["Interest Method"]
-	initiationDate, err := time.Parse("2006-01-02", details["Initiation Date"])
-	structuredMonthlyRental, err := strconv.Atoi(details["Structured Monthly Rental"])
+	terms, err := answeredTerms(details)
 	if err != nil {
 		return nil, err
 	}
 
-	_, financialSchedule, err := loan.Create(capital, rate, installments, installmentInterval, structuredMonthlyRental, initiationDate.Format("2006-01-02"), method)
+	// The agreement documents the terms already initiated, so they are not
+	// validated against the product again
+	terms.Calendar = m.Calendar
+	_, financialSchedule, err := loan.Create(loan.Method(details[questionMethod]), terms)
 	if err != nil {
 		return nil, err
 	}
 
 	intstallment := financialSchedule[0].Capital + financialSchedule[0].Interest
-	installmentStr := strconv.FormatFloat(intstallment, 'f', -1, 64)
+	installmentStr := strconv.FormatFloat(intstallment.Float64(), 'f', -1, 64)
 
 	res = append(res, models.Question{
 		Question: "Installment",
@@ -662,28 +680,28 @@ func (m *ContractModel) Timeline(cid int) ([]models.TimelineRow, error) {
 		}
 	}
 
-	due := 0.0
-	payments := 0.0
+	due := money.Amount(0)
+	payments := money.Amount(0)
 
 	var returnLines []models.TimelineRow
 
 	if lines[0].Type == "Receipt" {
-		payments = math.Round((payments+lines[0].Amount)*100) / 100
+		payments = payments + lines[0].Amount
 	} else {
-		due = math.Round((due+lines[0].Amount)*100) / 100
+		due = due + lines[0].Amount
 	}
 
 	returnLines = append(returnLines, lines[0])
 
 	cumulativeArrears := 0
-	prevArrears := 0.0
+	prevArrears := money.Amount(0)
 
 	for i := 1; i < len(lines); i++ {
 		if lines[i-1].Grouping == lines[i].Grouping {
 			if lines[i].Type == "Receipt" {
-				payments = math.Round((payments+lines[i].Amount)*100) / 100
+				payments = payments + lines[i].Amount
 			} else {
-				due = math.Round((due+lines[i].Amount)*100) / 100
+				due = due + lines[i].Amount
 			}
 			//fmt.Println(lines[i])
 			returnLines = append(returnLines, lines[i])
@@ -691,11 +709,11 @@ func (m *ContractModel) Timeline(cid int) ([]models.TimelineRow, error) {
 			duration := lines[i].Date.Sub(lines[i-1].Date)
 			days := int(duration.Hours() / 24)
 
-			balance := math.Round((due-payments)*100) / 100
+			balance := due - payments
 
 			if balance > 0 {
 				cumulativeArrears += days
-				arrearsChange := math.Round((balance-prevArrears)*100) / 100
+				arrearsChange := balance - prevArrears
 				returnLines = append(returnLines, models.TimelineRow{
 					Grouping:       0,
 					ContractID:     lines[i].ContractID,
@@ -740,9 +758,9 @@ func (m *ContractModel) Timeline(cid int) ([]models.TimelineRow, error) {
 			}
 
 			if lines[i].Type == "Receipt" {
-				payments = math.Round((payments+lines[i].Amount)*100) / 100
+				payments = payments + lines[i].Amount
 			} else {
-				due = math.Round((due+lines[i].Amount)*100) / 100
+				due = due + lines[i].Amount
 			}
 
 			returnLines = append(returnLines, lines[i])
@@ -805,7 +823,7 @@ func (m *ContractModel) DashboardCommitmentsByOfficer(ctype, officer string) ([]
 	} else if ctype == "upcoming" {
 		results, err = m.DB.Query(queries.UPCOMING_COMMITMENTS_BY_OFFICER, officer)
 	} else {
-		return nil, errors.New("Invalid commitment type")
+		return nil, models.ErrInvalidCommitmentType
 	}
 	if err != nil {
 		return nil, err
@@ -833,7 +851,7 @@ func (m *ContractModel) DashboardCommitments(ctype string) ([]models.DashboardCo
 	} else if ctype == "upcoming" {
 		results, err = m.DB.Query(queries.UPCOMING_COMMITMENTS)
 	} else {
-		return nil, errors.New("Invalid commitment type")
+		return nil, models.ErrInvalidCommitmentType
 	}
 	if err != nil {
 		return nil, err
@@ -972,7 +990,7 @@ func (m *ContractModel) RequestName(request int) (string, error) {
 }
 
 // CreditWorthinessApproved sends SMS message to customer, liaison upon credit worthiness approval
-func (m *ContractModel) CreditWorthinessApproved(user, request int, aAPIKey string) error {
+func (m *ContractModel) CreditWorthinessApproved(user, request int) error {
 	tx, err := m.DB.Begin()
 	if err != nil {
 		return err
@@ -994,26 +1012,16 @@ func (m *ContractModel) CreditWorthinessApproved(user, request int, aAPIKey stri
 	}
 
 	if !liaisonContact.Valid {
-		return errors.New("Liaison contact not provided")
+		return models.ErrLiaisonContactMissing
 	}
 
 	message := fmt.Sprintf("Customer %s bearing contract number %d has obtained credit worthiness approval.", customerName, cid)
-	var telephone string
+	var liaison string
 	if liaisonContact.Int32 > 100000000 && liaisonContact.Int32 < 999999999 {
-		telephone = fmt.Sprintf("%d,768237192,703524330,703524420,775607777,703524300,703524333,703524408", liaisonContact.Int32)
-	} else {
-		telephone = "768237192,703524330,703524420,775607777,703524300,703524333,703524408"
+		liaison = fmt.Sprintf("%d", liaisonContact.Int32)
 	}
-	requestURL := fmt.Sprintf("https://richcommunication.dialog.lk/api/sms/inline/send.php?destination=%s&q=%s&message=%s", telephone, aAPIKey, url.QueryEscape(message))
-	resp, err := http.Get(requestURL)
-	if err != nil {
-
-	}
-	defer resp.Body.Close()
-	if err != nil {
-		return nil
-	}
-	return nil
+	err = enqueueNotification(tx, cid, notify.GatewayApproval, m.Recipients.For([]string{liaison}, m.Recipients.Approval), message)
+	return err
 }
 
 // InitiateContract initiates the financials in of a contract in the system
@@ -1053,26 +1061,31 @@ func (m *ContractModel) InitiateContract(user, request int) error {
 		details[param.ID] = param.Name
 	}
 
-	capital, err := strconv.ParseFloat(details["Capital"], 32)
-	rate, err := strconv.ParseFloat(details["Interest Rate"], 32)
-	installments, err := strconv.Atoi(details["Installments"])
-	installmentInterval, err := strconv.Atoi(details["Installment Interval"])
-	method := details["Interest Method"]
-	initiationDate, err := time.Parse("2006-01-02", details["Initiation Date"])
-	structuredMonthlyRental, err := strconv.Atoi(details["Structured Monthly Rental"])
+	terms, err := answeredTerms(details)
 	if err != nil {
 		return err
 	}
 
-	marketedSchedule, financialSchedule, err := loan.Create(capital, rate, installments, installmentInterval, structuredMonthlyRental, initiationDate.Format("2006-01-02"), method)
+	var cid int
+	err = tx.QueryRow(queries.CONTRACT_ID_FROM_REUQEST, request).Scan(&cid)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	var cid int
-	err = tx.QueryRow(queries.CONTRACT_ID_FROM_REUQEST, request).Scan(&cid)
+	var contractTypeID int
+	err = tx.QueryRow(queries.ContractTypeID, cid).Scan(&contractTypeID)
+	if err != nil {
+		return err
+	}
+
+	product, err := loanProduct(tx, contractTypeID, details[questionMethod])
+	if err != nil {
+		return err
+	}
+
+	marketedSchedule, financialSchedule, err := m.createSchedule(product, terms)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
@@ -1083,8 +1096,8 @@ func (m *ContractModel) InitiateContract(user, request int) error {
 		return err
 	}
 
-	capitalAmount := 0.0
-	interestAmount := 0.0
+	capitalAmount := money.Amount(0)
+	interestAmount := money.Amount(0)
 	for _, inst := range financialSchedule {
 		capitalAmount += inst.Capital
 		interestAmount += inst.Interest
@@ -1105,7 +1118,7 @@ func (m *ContractModel) InitiateContract(user, request int) error {
 		Table: mysequel.Table{
 			TableName: "contract_financial",
 			Columns:   []string{"payment", "agreed_capital", "agreed_interest", "financial_schedule_start_date", "financial_schedule_end_date", "marketed_schedule_start_date", "marketed_schedule_end_date", "payment_interval", "payments"},
-			Vals:      []interface{}{financialSchedule[0].Capital + financialSchedule[0].Interest, capitalAmount, interestAmount, financialSchedule[0].MonthlyDate, financialSchedule[len(financialSchedule)-1].MonthlyDate, marketedSchedule[0].DueDate, marketedSchedule[len(marketedSchedule)-1].DueDate, installmentInterval, installments},
+			Vals:      []interface{}{financialSchedule[0].Capital + financialSchedule[0].Interest, capitalAmount, interestAmount, financialSchedule[0].MonthlyDate, financialSchedule[len(financialSchedule)-1].MonthlyDate, marketedSchedule[0].DueDate, marketedSchedule[len(marketedSchedule)-1].DueDate, terms.InstallmentInterval, len(marketedSchedule)},
 			Tx:        tx,
 		},
 		WColumns: []string{"contract_id"},
@@ -1139,9 +1152,9 @@ func (m *ContractModel) InitiateContract(user, request int) error {
 	}
 
 	journalEntries := []smodels.JournalEntry{
-		{fmt.Sprintf("%d", receivableAccount), fmt.Sprintf("%f", fullRecievables), ""},
-		{fmt.Sprintf("%d", payableAccount), "", fmt.Sprintf("%f", capital)},
-		{fmt.Sprintf("%d", unearnedInterestAccount), "", fmt.Sprintf("%f", interestAmount)},
+		{fmt.Sprintf("%d", receivableAccount), fullRecievables.String(), ""},
+		{fmt.Sprintf("%d", payableAccount), "", capitalAmount.String()},
+		{fmt.Sprintf("%d", unearnedInterestAccount), "", interestAmount.String()},
 	}
 
 	err = scribe.IssueJournalEntries(tx, tid, journalEntries)
@@ -1373,7 +1386,7 @@ func (m *ContractModel) SetTemporaryOfficer(rparams, oparams []string, form url.
 }
 
 // Commitment adds a commitment
-func (m *ContractModel) Commitment(rparams, oparams []string, form url.Values, specialMessage, aAPIKey string) (int64, error) {
+func (m *ContractModel) Commitment(rparams, oparams []string, form url.Values, specialMessage string) (int64, error) {
 	tx, err := m.DB.Begin()
 	if err != nil {
 		return 0, err
@@ -1406,13 +1419,11 @@ func (m *ContractModel) Commitment(rparams, oparams []string, form url.Values, s
 		err = tx.QueryRow(queries.SENDER_MOBILE, form.Get("contract_id")).Scan(&senderMobile)
 
 		message := fmt.Sprintf("%s left a special comment on your contract %s", officerName, form.Get("contract_id"))
-
-		requestURL := fmt.Sprintf("https://cpsolutions.dialog.lk/index.php/cbs/sms/send?destination=%s&q=%s&message=%s", senderMobile, aAPIKey, url.QueryEscape(message))
-
-		resp, err := http.Get(requestURL)
-
-		if err == nil {
-			defer resp.Body.Close()
+		cid, _ := strconv.Atoi(form.Get("contract_id"))
+		err = enqueueNotification(tx, cid, notify.GatewayOfficer, m.Recipients.For([]string{senderMobile}, nil), message)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
 		}
 	}
 
@@ -1669,7 +1680,7 @@ func (m *ContractModel) DebitNoteWithtTx(tx *sql.Tx, rparams, oparams []string,
 	return dnid, nil
 }
 
-func (m *ContractModel) LKAS17Rebate(userID, cid int, amount float64) (int64, error) {
+func (m *ContractModel) LKAS17Rebate(userID, cid int, amount money.Amount) (int64, error) {
 	tx, err := m.DB.Begin()
 	if err != nil {
 		return 0, err
@@ -1682,8 +1693,16 @@ func (m *ContractModel) LKAS17Rebate(userID, cid int, amount float64) (int64, er
 		_ = tx.Commit()
 	}()
 
-	fBalance := amount
+	rid, err := m.lkas17Rebate(tx, userID, cid, amount)
+	if err != nil {
+		return 0, err
+	}
 
+	return rid, nil
+}
+
+// lkas17Rebate issues an LKAS 17 rebate within the given transaction
+func (m *ContractModel) lkas17Rebate(tx *sql.Tx, userID, cid int, amount money.Amount) (int64, error) {
 	rid, err := mysequel.Insert(mysequel.Table{
 		TableName: "contract_receipt",
 		Columns:   []string{"lkas_17", "contract_receipt_type_id", "user_id", "contract_id", "datetime", "amount"},
@@ -1701,17 +1720,14 @@ func (m *ContractModel) LKAS17Rebate(userID, cid int, amount float64) (int64, er
 		return 0, err
 	}
 
-	var fInts []models.ContractPayment
-
-	if len(fInterestPayables) > 0 && fBalance != 0 {
-		fInts = payments("I", rid, &fBalance, fInterestPayables, fInts)
-	}
+	fLines, fBalance := allocation.Allocate(amount, contractPayables(fInterestPayables, allocation.Interest), allocation.Waterfall)
+	fInts, _ := contractPayments(rid, fLines)
 
 	if fBalance != 0 {
-		return 0, errors.New("Error: Payment exceeds payables")
+		return 0, models.ErrPaymentExceedsPayables
 	}
 
-	fIntPaid := float64(0)
+	fIntPaid := money.Amount(0)
 	for _, intPayment := range fInts {
 		fIntPaid = fIntPaid + intPayment.Amount
 		_, err := mysequel.Insert(mysequel.Table{
@@ -1730,27 +1746,17 @@ func (m *ContractModel) LKAS17Rebate(userID, cid int, amount float64) (int64, er
 		}
 	}
 
-	mBalance := amount
-
 	var mPayables []models.ContractPayable
 	err = mysequel.QueryToStructs(&mPayables, tx, queries.MARKETED_PAYABLES_FOR_REBATE, cid)
 	if err != nil {
 		return 0, err
 	}
 
-	var mInts []models.ContractPayment
-	var mCaps []models.ContractPayment
-
-	if mBalance != 0 {
-		mInts = payments("I", rid, &mBalance, mPayables, mInts)
-	}
-
-	if mBalance != 0 {
-		mCaps = payments("C", rid, &mBalance, mPayables, mCaps)
-	}
+	mLines, mBalance := allocation.Allocate(amount, contractPayables(mPayables, allocation.Interest, allocation.Capital), allocation.Waterfall)
+	mInts, mCaps := contractPayments(rid, mLines)
 
 	if mBalance != 0 {
-		return 0, errors.New("Error: Payment exceeds payables")
+		return 0, models.ErrPaymentExceedsPayables
 	}
 
 	for _, intPayment := range mInts {
@@ -1811,12 +1817,12 @@ func (m *ContractModel) LKAS17Rebate(userID, cid int, amount float64) (int64, er
 	}
 
 	rebateJEs := []smodels.JournalEntry{
-		{Account: fmt.Sprintf("%d", RebateExpenseAccount), Debit: fmt.Sprintf("%f", amount), Credit: ""},
-		{Account: fmt.Sprintf("%d", ReceivableArrearsAccount), Debit: "", Credit: fmt.Sprintf("%f", amount)},
+		{Account: fmt.Sprintf("%d", RebateExpenseAccount), Debit: amount.String(), Credit: ""},
+		{Account: fmt.Sprintf("%d", ReceivableArrearsAccount), Debit: "", Credit: amount.String()},
 	}
 
 	arrears := cF.CapitalArrears + cF.InterestArrears
-	nAge := arrears / cF.Payment
+	nAge := arrears.Float64() / cF.Payment.Float64()
 
 	if nAge <= 0 && cF.Doubtful == 0 {
 		m.ReceiptLogger.Printf("REBATE RID %d \t %s", rid, "nAge <= 0 && cF.Doubtful == 0")
@@ -1850,12 +1856,12 @@ func (m *ContractModel) LKAS17Rebate(userID, cid int, amount float64) (int64, er
 		rebateJEs = append(rebateJEs, bdJEs...)
 	} else if cF.RecoveryStatus == RecoveryStatusBDP && nAge < 12 {
 		m.ReceiptLogger.Printf("REBATE RID %d \t %s", rid, "cF.RecoveryStatus == RecoveryStatusBDP && nAge < 12")
-		var capitalProvision float64
+		var capitalProvision money.Amount
 		err = tx.QueryRow(queries.NplCapitalProvision, cid).Scan(&capitalProvision)
 		if err != nil {
 			return 0, err
 		}
-		capitalProvisionRemoval := math.Round((cF.CapitalProvisioned-capitalProvision)*100) / 100
+		capitalProvisionRemoval := cF.CapitalProvisioned - capitalProvision
 
 		// db_txn, txn_id, interest, capital_provisioned
 		rebateJEs, err = addBadDebtJEsUpdateStatus(tx, int64(cid), tid, fIntPaid, capitalProvisionRemoval, rebateJEs, `UPDATE contract_financial SET recovery_status_id = ? WHERE contract_id = ?`, RecoveryStatusNPL, cid)
@@ -1874,7 +1880,7 @@ func (m *ContractModel) LKAS17Rebate(userID, cid int, amount float64) (int64, er
 }
 
 // LegacyRebate issues a legacy rebate
-func (m *ContractModel) LegacyRebate(userID, cid int, amount float64) (int64, error) {
+func (m *ContractModel) LegacyRebate(userID, cid int, amount money.Amount) (int64, error) {
 	tx, err := m.DB.Begin()
 	if err != nil {
 		return 0, err
@@ -1887,13 +1893,18 @@ func (m *ContractModel) LegacyRebate(userID, cid int, amount float64) (int64, er
 		_ = tx.Commit()
 	}()
 
-	balance := amount
+	rid, err := m.legacyRebate(tx, userID, cid, amount)
+	if err != nil {
+		return 0, err
+	}
 
-	var intPayments []models.ContractPayment
+	return rid, nil
+}
 
+// legacyRebate issues a legacy rebate within the given transaction
+func (m *ContractModel) legacyRebate(tx *sql.Tx, userID, cid int, amount money.Amount) (int64, error) {
 	results, err := tx.Query(queries.LEGACY_PAYMENTS, cid)
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
@@ -1914,25 +1925,19 @@ func (m *ContractModel) LegacyRebate(userID, cid int, amount float64) (int64, er
 		Tx:        tx,
 	})
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
-	for i := len(payables); i > 0; i-- {
-		if payables[i-1].InterestPayable != 0 && balance != 0 {
-			if balance-payables[i-1].InterestPayable >= 0 {
-				intPayments = append(intPayments, models.ContractPayment{payables[i-1].InstallmentID, rid, payables[i-1].InterestPayable})
-				balance = math.Round((balance-payables[i-1].InterestPayable)*100) / 100
-			} else {
-				intPayments = append(intPayments, models.ContractPayment{payables[i-1].InstallmentID, rid, balance})
-				balance = 0
-			}
-		}
+	// Rebates settle interest from the last installment backwards
+	latestFirst := make([]models.ContractPayable, len(payables))
+	for i, p := range payables {
+		latestFirst[len(payables)-1-i] = p
 	}
+	lines, balance := allocation.Allocate(amount, contractPayables(latestFirst, allocation.Interest), allocation.Waterfall)
+	intPayments, _ := contractPayments(rid, lines)
 
 	if balance != 0 {
-		tx.Rollback()
-		return 0, errors.New("Rebate exceeds payable interest")
+		return 0, models.ErrRebateExceedsInterest
 	}
 
 	for _, intPayment := range intPayments {
@@ -1943,7 +1948,6 @@ func (m *ContractModel) LegacyRebate(userID, cid int, amount float64) (int64, er
 			Tx:        tx,
 		})
 		if err != nil {
-			tx.Rollback()
 			return 0, err
 		}
 	}
@@ -1955,24 +1959,20 @@ func (m *ContractModel) LegacyRebate(userID, cid int, amount float64) (int64, er
 		Tx:        tx,
 	})
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
 	journalEntries := []smodels.JournalEntry{
-		{fmt.Sprintf("%d", 78), fmt.Sprintf("%f", amount), ""},
-		{fmt.Sprintf("%d", 25), "", fmt.Sprintf("%f", amount)},
+		{fmt.Sprintf("%d", 78), amount.String(), ""},
+		{fmt.Sprintf("%d", 25), "", amount.String()},
 	}
 
 	err = scribe.IssueJournalEntries(tx, tid, journalEntries)
-
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
 
 	return rid, nil
-
 }
 
 // PerformanceReview returns contract performance review
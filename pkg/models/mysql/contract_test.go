@@ -0,0 +1,123 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/models"
+)
+
+var (
+	legacyRequired = []string{"user_id", "recovery_officer_id", "contract_type_id", "institute_dealer_id", "contract_batch_id", "model_id", "chassis_number", "customer_nic", "customer_name", "customer_address", "customer_contact", "price"}
+	legacyOptional = []string{"institute_id", "liaison_name", "liaison_contact", "liaison_comment", "downpayment"}
+)
+
+func legacyForm(method, rate string) url.Values {
+	return url.Values{
+		"user_id":              {"1"},
+		"recovery_officer_id":  {"2"},
+		"contract_type_id":     {"1"},
+		"institute_dealer_id":  {"3"},
+		"contract_batch_id":    {"4"},
+		"model_id":             {"5"},
+		"chassis_number":       {"CH-1"},
+		"customer_nic":         {"901234567V"},
+		"customer_name":        {"Amal Bandara"},
+		"customer_address":     {"Kandy"},
+		"customer_contact":     {"0771234567"},
+		"liaison_contact":      {"0112345678"},
+		"price":                {"150000"},
+		"capital":              {"120000"},
+		"rate":                 {rate},
+		"installments":         {"12"},
+		"installment_interval": {"1"},
+		"method":               {method},
+		"initiation_date":      {"2019-03-05"},
+	}
+}
+
+// legacyDB answers the statements of a legacy contract, failing the insert
+// of installments when failInstallments is set
+func legacyDB(failInstallments bool) func(query string, args []driver.Value) fakeResult {
+	return func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT S.id FROM state"), strings.HasPrefix(query, "SELECT CIT.id"):
+			return fakeResult{Columns: []string{"id"}, Rows: [][]driver.Value{{int64(1)}}}
+		case strings.HasPrefix(query, "INSERT INTO `contract_installment`") && failInstallments:
+			return fakeResult{Err: errors.New("connection lost")}
+		}
+		return fakeResult{}
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	tests := []struct {
+		name             string
+		form             url.Values
+		failInstallments bool
+		err              error
+		installments     int
+	}{
+		{
+			name:         "terms outside the current product",
+			form:         legacyForm("S", "72"),
+			installments: 12,
+		},
+		{
+			name: "unknown method",
+			form: legacyForm("X", "24"),
+			err:  models.ErrUnsupportedMethod,
+		},
+		{
+			name:             "schedule fails",
+			form:             legacyForm("R", "24"),
+			failInstallments: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := openFakeDB(t, legacyDB(tt.failInstallments))
+			m := &ContractModel{DB: db}
+
+			cid, err := m.Legacy(legacyRequired, legacyOptional, tt.form)
+			if tt.failInstallments {
+				if err == nil {
+					t.Fatal("Legacy() error = nil, want the failed insert")
+				}
+				if len(f.Executed("INSERT INTO `contract`")) != 1 || f.Commits != 0 || f.Rollbacks != 1 {
+					t.Errorf("commits, rollbacks = %d, %d, want the contract rolled back with its schedule", f.Commits, f.Rollbacks)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Legacy() error = %v, want %v", err, tt.err)
+			}
+
+			for _, s := range f.Statements {
+				if strings.Contains(s.Query, "loan_product") {
+					t.Errorf("terms validated against the loan product: %s", s.Query)
+				}
+			}
+			if tt.err != nil {
+				if len(f.Executed("INSERT")) != 0 || f.Commits != 0 {
+					t.Errorf("statements = %v, want no contract", f.Statements)
+				}
+				return
+			}
+
+			if cid != 1 {
+				t.Errorf("contract = %d, want 1", cid)
+			}
+			if got := len(f.Executed("INSERT INTO `contract_installment`")); got != tt.installments {
+				t.Errorf("installments = %d, want %d", got, tt.installments)
+			}
+			if f.Commits != 1 {
+				t.Errorf("commits = %d, want 1", f.Commits)
+			}
+		})
+	}
+}
@@ -2,16 +2,16 @@ package mysql
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
-	"math"
-	"net/http"
 	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/ssrdive/cidium/pkg/allocation"
 	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/notify"
 	"github.com/ssrdive/cidium/pkg/sql/queries"
 	"github.com/ssrdive/mysequel"
 	"github.com/ssrdive/scribe"
@@ -38,6 +38,10 @@ const (
 	// RebateExpenseAccount holds account database id
 	RebateExpenseAccount = 316
 
+	// DefaultDebitType holds the installment type database id of debit
+	// notes raised from default interest
+	DefaultDebitType = 9
+
 	// RecoveryStatusActive holds status database id
 	RecoveryStatusActive = 1
 	// RecoveryStatusArrears holds status database id
@@ -54,18 +58,24 @@ type ContractFinancial struct {
 	Active             int
 	RecoveryStatus     int
 	Doubtful           int
-	Payment            float64
-	CapitalArrears     float64
-	InterestArrears    float64
-	CapitalProvisioned float64
+	Payment            money.Amount
+	CapitalArrears     money.Amount
+	InterestArrears    money.Amount
+	CapitalProvisioned money.Amount
 	ScheduleEndDate    string
 }
 
 // Receipt issues a receipt
-func (m *ContractModel) Receipt(userID, cid int, amount float64, notes, dueDate, rAPIKey, aAPIKey, aAPIPass, runtimeEnv, checksum string) (int64, error) {
+func (m *ContractModel) Receipt(userID, cid int, amount money.Amount, notes, dueDate, checksum string) (int64, error) {
+	rid, _, err := m.issueReceipt(userID, cid, amount, notes, dueDate, checksum)
+	return rid, err
+}
+
+// issueReceipt issues a receipt and reports whether it was posted to float
+func (m *ContractModel) issueReceipt(userID, cid int, amount money.Amount, notes, dueDate, checksum string) (int64, bool, error) {
 	tx, err := m.DB.Begin()
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
 	defer func() {
 		if err != nil {
@@ -76,7 +86,7 @@ func (m *ContractModel) Receipt(userID, cid int, amount float64, notes, dueDate,
 	}()
 
 	if receiptChecksumExists(tx, checksum) {
-		return 0, nil
+		return 0, false, nil
 	}
 
 	if checksum != "" {
@@ -88,13 +98,13 @@ func (m *ContractModel) Receipt(userID, cid int, amount float64, notes, dueDate,
 		})
 		if err != nil {
 			tx.Rollback()
-			return 0, err
+			return 0, false, err
 		}
 	}
 
 	if amount <= 0 {
 		tx.Rollback()
-		return 0, err
+		return 0, false, err
 	}
 
 	var managedByAgrivest int
@@ -103,109 +113,85 @@ func (m *ContractModel) Receipt(userID, cid int, amount float64, notes, dueDate,
 	err = tx.QueryRow(queries.MANAGED_BY_AGRIVEST_LKAS17_COMPLIANT, cid).Scan(&lkas17Compliant, &managedByAgrivest, &telephone)
 	if err != nil {
 		tx.Rollback()
-		return 0, err
+		return 0, false, err
 	}
 
-	message := fmt.Sprintf("Hithawath paribhogikaya, obage giwisum anka %d wetha gewu mudala Rs. %s. Sthuthiyi.", cid, humanize.Comma(int64(amount)))
-	if runtimeEnv == "dev" {
-		telephone = "94768237192"
+	message := fmt.Sprintf("Hithawath paribhogikaya, obage giwisum anka %d wetha gewu mudala Rs. %s. Sthuthiyi.", cid, humanize.Comma(int64(amount/100)))
+	if len(telephone) == 9 {
+		telephone = fmt.Sprintf("94%s", telephone)
 	} else {
-		if len(telephone) == 9 {
-			telephone = fmt.Sprintf("94%s,94768237192,94703524281,94768724555,94703524271,94703524420,94775607777,", telephone)
-		} else {
-			telephone = "94768237192,94703524281,94768724555,94703524271,94703524420,94775607777"
-		}
+		telephone = ""
 	}
+	recipients := m.Recipients.For([]string{telephone}, m.Recipients.Receipt)
 
-	requestURL := ""
-	if managedByAgrivest == 0 {
-		requestURL = fmt.Sprintf("https://richcommunication.dialog.lk/api/sms/inline/send.php?destination=%s&q=%s&message=%s", telephone, rAPIKey, url.QueryEscape(message))
-	} else {
-		requestURL = fmt.Sprintf("https://msmsenterpriseapi.mobitel.lk/EnterpriseSMSV3/esmsproxy.php?m=%s&r=%s&a=AGRIVEST&u=%s&p=%s&t=0", url.QueryEscape(message), telephone, aAPIKey, aAPIPass)
+	gateway := notify.GatewayRandeepa
+	if managedByAgrivest == 1 {
+		gateway = notify.GatewayAgrivest
 	}
 
-	var holdDefault int
-	tx.QueryRow("SELECT hold_default FROM contract WHERE id = ?", cid).Scan(&holdDefault)
+	rid, float, err := m.receipt(tx, userID, cid, lkas17Compliant == 1, amount, notes, dueDate)
 	if err != nil {
-		tx.Rollback()
-		return 0, err
+		return 0, false, err
+	}
+
+	err = enqueueNotification(tx, cid, gateway, recipients, message)
+	if err != nil {
+		return 0, false, err
 	}
 
-	if holdDefault == 0 {
-		var defaultEntryPresent int32
-		err = tx.QueryRow("SELECT COUNT(*) AS entry_present FROM contract_default WHERE contract_id = ?", cid).Scan(&defaultEntryPresent)
+	return rid, float, nil
+}
+
+// receipt posts a payment within the given transaction. Payments exceeding the
+// contract payable are posted to float. Returns the receipt or float receipt id
+// and whether the payment was floated
+func (m *ContractModel) receipt(tx *sql.Tx, userID, cid int, lkas17 bool, amount money.Amount, notes, dueDate string) (int64, bool, error) {
+	// A debit note raised from the pending default is recorded against an
+	// LKAS 17 receipt so that reversing the receipt restores the default
+	var defaultNote int64
+	defaultNoteAmount, err := pendingDefault(tx, cid, amount)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if defaultNoteAmount != 0 {
+		_, err = tx.Exec("UPDATE contract_default SET amount = amount - ? WHERE contract_id = ?", defaultNoteAmount, cid)
 		if err != nil {
-			tx.Rollback()
-			return 0, err
+			return 0, false, err
 		}
 
-		if defaultEntryPresent == 1 {
-			var currentDefault float64
-			err = tx.QueryRow("SELECT amount FROM contract_default WHERE contract_id = ?", cid).Scan(&currentDefault)
-			if err != nil {
-				tx.Rollback()
-				return 0, err
-			}
-
-			var defaultForCurrentReceipt float64
-			defaultForCurrentReceipt = 0
-
-			if amount > currentDefault || amount == currentDefault {
-				defaultForCurrentReceipt = currentDefault
-
-				_, err = tx.Exec("UPDATE contract_default SET amount = 0 WHERE contract_id = ?", cid)
-				if err != nil {
-					tx.Rollback()
-					return 0, err
-				}
-			} else if amount < currentDefault {
-				defaultForCurrentReceipt = amount
-
-				_, err = tx.Exec("UPDATE contract_default SET amount = amount - ? WHERE contract_id = ?", amount, cid)
-				if err != nil {
-					tx.Rollback()
-					return 0, err
-				}
-			}
+		var form url.Values
+		form = make(url.Values)
+		form.Set("user_id", "1")
+		form.Set("contract_id", strconv.Itoa(cid))
+		form.Set("capital", fmt.Sprintf("%v", defaultNoteAmount))
+		form.Set("contract_installment_type_id", strconv.Itoa(DefaultDebitType))
+		form.Set("due_date", time.Now().Format("2006-01-02 15:04:05"))
 
-			if defaultForCurrentReceipt != 0 {
-				var form url.Values
-				form = make(url.Values)
-				form.Set("user_id", "1")
-				form.Set("contract_id", strconv.Itoa(cid))
-				form.Set("capital", fmt.Sprintf("%v", defaultForCurrentReceipt))
-				form.Set("contract_installment_type_id", "9")
-				form.Set("due_date", time.Now().Format("2006-01-02 15:04:05"))
-
-				_, err = m.DebitNoteWithtTx(tx, []string{"contract_id", "contract_installment_type_id", "capital"}, []string{"due_date"}, form)
-				if err != nil {
-					tx.Rollback()
-					return 0, err
-				}
-			}
+		defaultNote, err = m.DebitNoteWithtTx(tx, []string{"contract_id", "contract_installment_type_id", "capital"}, []string{"due_date"}, form)
+		if err != nil {
+			return 0, false, err
 		}
 	}
 
-	var contractTotalPayable float64
-	if lkas17Compliant == 1 {
+	var contractTotalPayable money.Amount
+	if lkas17 {
 		err = tx.QueryRow(queries.CONTRACT_PAYABLE_LKAS_17, cid).Scan(&contractTotalPayable)
 	} else {
 		err = tx.QueryRow(queries.CONTRACT_PAYABLE, cid).Scan(&contractTotalPayable)
 	}
 	if err != nil {
-		tx.Rollback()
-		return 0, err
+		return 0, false, err
 	}
 
 	var officerAccountID int
 	err = tx.QueryRow(queries.OFFICER_ACC_NO, userID).Scan(&officerAccountID)
 	if err != nil {
-		tx.Rollback()
-		return 0, err
+		return 0, false, err
 	}
 
 	// Issue receipt to float
-	if contractTotalPayable < (float64(int(amount*100)) / 100) {
+	if contractTotalPayable < amount {
 		frid, err := mysequel.Insert(mysequel.Table{
 			TableName: "contract_receipt_float",
 			Columns:   []string{"user_id", "contract_id", "datetime", "amount"},
@@ -213,13 +199,6 @@ func (m *ContractModel) Receipt(userID, cid int, amount float64, notes, dueDate,
 			Tx:        tx,
 		})
 
-		resp, err := http.Get(requestURL)
-		if err != nil {
-			return frid, nil
-		}
-
-		defer resp.Body.Close()
-
 		tid, err := mysequel.Insert(mysequel.Table{
 			TableName: "transaction",
 			Columns:   []string{"user_id", "datetime", "posting_date", "contract_id", "remark"},
@@ -227,312 +206,457 @@ func (m *ContractModel) Receipt(userID, cid int, amount float64, notes, dueDate,
 			Tx:        tx,
 		})
 		if err != nil {
-			tx.Rollback()
-			return 0, err
+			return 0, false, err
 		}
 
 		journalEntries := []smodels.JournalEntry{
-			{Account: fmt.Sprintf("%d", officerAccountID), Debit: fmt.Sprintf("%f", amount), Credit: ""},
-			{Account: fmt.Sprintf("%d", 144), Debit: "", Credit: fmt.Sprintf("%f", amount)},
+			{Account: fmt.Sprintf("%d", officerAccountID), Debit: amount.String(), Credit: ""},
+			{Account: fmt.Sprintf("%d", 144), Debit: "", Credit: amount.String()},
 		}
 
 		err = scribe.IssueJournalEntries(tx, tid, journalEntries)
 		if err != nil {
-			tx.Rollback()
-			return 0, err
+			return 0, false, err
 		}
 
-		return frid, err
+		return frid, true, nil
 	}
 
-	var rid int64
-	if lkas17Compliant == 1 {
-		lkas17Rid, err := m.IssueLKAS17Receipt(tx, userID, cid, amount, notes, dueDate, "REGULAR", time.Now())
-		if err != nil {
-			tx.Rollback()
-			return 0, err
+	if lkas17 {
+		rid, err := m.IssueLKAS17Receipt(tx, userID, cid, amount, notes, dueDate, "REGULAR", time.Now())
+		if err != nil || defaultNote == 0 {
+			return rid, false, err
 		}
-		rid = lkas17Rid
-	} else {
-		var debits []models.DebitPayable
-		err = mysequel.QueryToStructs(&debits, tx, queries.DEBITS, cid)
-		if err != nil {
-			tx.Rollback()
-			return 0, err
-		}
-
-		var intPayments []models.ContractPayment
-		var capPayments []models.ContractPayment
-		var debitPayments []models.DebitPayment
 
-		balance := amount
-
-		legacyRid, err := mysequel.Insert(mysequel.Table{
-			TableName: "contract_receipt",
-			Columns:   []string{"user_id", "contract_id", "datetime", "amount", "notes", "due_date"},
-			Vals:      []interface{}{userID, cid, time.Now().Format("2006-01-02 15:04:05"), amount, notes, dueDate},
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "contract_receipt_default",
+			Columns:   []string{"contract_receipt_id", "contract_schedule_id", "amount"},
+			Vals:      []interface{}{rid, defaultNote, defaultNoteAmount},
 			Tx:        tx,
 		})
-		if err != nil {
-			tx.Rollback()
-			return 0, err
-		}
+		return rid, false, err
+	}
 
-		if balance != 0 {
-			for _, p := range debits {
-				if p.CapitalPayable != 0 && balance != 0 {
-					if balance-p.CapitalPayable >= 0 {
-						debitPayments = append(debitPayments, models.DebitPayment{ContractInstallmentID: p.InstallmentID, ContractReceiptID: legacyRid, Amount: p.CapitalPayable, UnearnedAccountID: p.UnearnedAccountID, IncomeAccountID: p.IncomeAccountID})
-						balance = math.Round((balance-p.CapitalPayable)*100) / 100
-					} else {
-						debitPayments = append(debitPayments, models.DebitPayment{ContractInstallmentID: p.InstallmentID, ContractReceiptID: legacyRid, Amount: balance, UnearnedAccountID: p.UnearnedAccountID, IncomeAccountID: p.IncomeAccountID})
-						balance = 0
-					}
-				}
-			}
-		}
+	rid, err := issueLegacyReceipt(tx, userID, cid, officerAccountID, amount, notes, dueDate)
+	return rid, false, err
+}
+
+// pendingDefault returns the default interest of a contract that a receipt
+// of amount settles with a debit note. Held defaults are not settled
+func pendingDefault(tx *sql.Tx, cid int, amount money.Amount) (money.Amount, error) {
+	var holdDefault int
+	err := tx.QueryRow("SELECT hold_default FROM contract WHERE id = ?", cid).Scan(&holdDefault)
+	if err != nil || holdDefault != 0 {
+		return 0, err
+	}
+
+	var defaultEntryPresent int32
+	err = tx.QueryRow("SELECT COUNT(*) AS entry_present FROM contract_default WHERE contract_id = ?", cid).Scan(&defaultEntryPresent)
+	if err != nil || defaultEntryPresent != 1 {
+		return 0, err
+	}
+
+	var currentDefault money.Amount
+	err = tx.QueryRow("SELECT amount FROM contract_default WHERE contract_id = ?", cid).Scan(&currentDefault)
+	if err != nil {
+		return 0, err
+	}
+
+	if amount < currentDefault {
+		return amount, nil
+	}
+	return currentDefault, nil
+}
+
+// legacyReceiptPlan is the allocation of a receipt over the installments of
+// a contract that is not compliant with LKAS 17
+type legacyReceiptPlan struct {
+	Debits       []models.DebitPayment
+	Interest     []models.ContractPayment
+	Capital      []models.ContractPayment
+	InterestPaid money.Amount
+}
+
+// planLegacyReceipt allocates a receipt without writing. Pending debits not
+// yet recorded against the contract are settled after its recorded debits
+func planLegacyReceipt(tx *sql.Tx, rid int64, cid int, amount money.Amount, pending ...models.DebitPayable) (legacyReceiptPlan, error) {
+	var plan legacyReceiptPlan
+
+	var debits []models.DebitPayable
+	err := mysequel.QueryToStructs(&debits, tx, queries.DEBITS, cid)
+	if err != nil {
+		return plan, err
+	}
+	debits = append(debits, pending...)
+
+	debitLines, balance := allocation.Allocate(amount, debitPayables(debits), allocation.Waterfall)
+	for _, l := range debitLines {
+		plan.Debits = append(plan.Debits, models.DebitPayment{ContractInstallmentID: l.ID, ContractReceiptID: rid, Amount: l.Amount, UnearnedAccountID: debits[l.Index].UnearnedAccountID, IncomeAccountID: debits[l.Index].IncomeAccountID})
+	}
+
+	var payables []models.ContractPayable
+	err = mysequel.QueryToStructs(&payables, tx, queries.OVERDUE_INSTALLMENTS, cid, time.Now().Format("2006-01-02"))
+	if err != nil {
+		return plan, err
+	}
+
+	lines, balance := allocation.Allocate(balance, contractPayables(payables, allocation.Interest, allocation.Capital), allocation.Waterfall)
+	plan.Interest, plan.Capital = contractPayments(rid, lines)
 
-		var payables []models.ContractPayable
-		err = mysequel.QueryToStructs(&payables, tx, queries.OVERDUE_INSTALLMENTS, cid, time.Now().Format("2006-01-02"))
+	if balance != 0 {
+		var upcoming []models.ContractPayable
+		err = mysequel.QueryToStructs(&upcoming, tx, queries.UPCOMING_INSTALLMENTS, cid, time.Now().Format("2006-01-02"))
 		if err != nil {
-			tx.Rollback()
-			return 0, err
+			return plan, err
 		}
 
-		if balance != 0 {
-			intPayments = payments("I", legacyRid, &balance, payables, intPayments)
-		}
+		lines, balance = allocation.Allocate(balance, contractPayables(upcoming, allocation.Interest, allocation.Capital), allocation.OldestFirst)
+		ints, caps := contractPayments(rid, lines)
+		plan.Interest = append(plan.Interest, ints...)
+		plan.Capital = append(plan.Capital, caps...)
+	}
 
-		if balance != 0 {
-			capPayments = payments("C", legacyRid, &balance, payables, capPayments)
-		}
+	if balance != 0 {
+		return plan, models.ErrPaymentExceedsPayables
+	}
 
-		if balance != 0 {
-			var upcoming []models.ContractPayable
-			err = mysequel.QueryToStructs(&upcoming, tx, queries.UPCOMING_INSTALLMENTS, cid, time.Now().Format("2006-01-02"))
-			if err != nil {
-				tx.Rollback()
-				return 0, err
-			}
+	for _, intPayment := range plan.Interest {
+		plan.InterestPaid += intPayment.Amount
+	}
+	return plan, nil
+}
 
-			for _, p := range upcoming {
-				intPayments = payments("I", legacyRid, &balance, []models.ContractPayable{p}, intPayments)
-				capPayments = payments("C", legacyRid, &balance, []models.ContractPayable{p}, capPayments)
-			}
-		}
+// legacyReceiptJEs returns the journal entries of a planned receipt, debit
+// payments moving unearned income to income first
+func legacyReceiptJEs(officerAccountID int, amount money.Amount, plan legacyReceiptPlan) []smodels.JournalEntry {
+	journalEntries := []smodels.JournalEntry{}
+	for _, debPayment := range plan.Debits {
+		journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", debPayment.UnearnedAccountID), Debit: debPayment.Amount.String(), Credit: ""},
+			smodels.JournalEntry{Account: fmt.Sprintf("%d", debPayment.IncomeAccountID), Debit: "", Credit: debPayment.Amount.String()})
+	}
 
-		if balance != 0 {
-			tx.Rollback()
-			return 0, errors.New("Error: Payment exceeds payables")
-		}
-
-		interestAmount := 0.0
-
-		for _, intPayment := range intPayments {
-			interestAmount += intPayment.Amount
-			_, err := mysequel.Insert(mysequel.Table{
-				TableName: "contract_interest_payment",
-				Columns:   []string{"contract_installment_id", "contract_receipt_id", "amount"},
-				Vals:      []interface{}{intPayment.ContractInstallmentID, intPayment.ContractReceiptID, intPayment.Amount},
-				Tx:        tx,
-			})
-			if err != nil {
-				tx.Rollback()
-				return 0, err
-			}
-		}
+	return append(journalEntries,
+		smodels.JournalEntry{Account: fmt.Sprintf("%d", officerAccountID), Debit: amount.String(), Credit: ""},
+		smodels.JournalEntry{Account: fmt.Sprintf("%d", 25), Debit: "", Credit: amount.String()},
+		smodels.JournalEntry{Account: fmt.Sprintf("%d", 46), Debit: "", Credit: plan.InterestPaid.String()},
+		smodels.JournalEntry{Account: fmt.Sprintf("%d", 78), Debit: plan.InterestPaid.String(), Credit: ""},
+	)
+}
 
-		for _, capPayment := range capPayments {
-			_, err := mysequel.Insert(mysequel.Table{
-				TableName: "contract_capital_payment",
-				Columns:   []string{"contract_installment_id", "contract_receipt_id", "amount"},
-				Vals:      []interface{}{capPayment.ContractInstallmentID, capPayment.ContractReceiptID, capPayment.Amount},
-				Tx:        tx,
-			})
-			if err != nil {
-				tx.Rollback()
-				return 0, err
-			}
-		}
+// issueLegacyReceipt issues receipts for contracts that are not compliant with LKAS 17
+func issueLegacyReceipt(tx *sql.Tx, userID, cid, officerAccountID int, amount money.Amount, notes, dueDate string) (int64, error) {
+	rid, err := mysequel.Insert(mysequel.Table{
+		TableName: "contract_receipt",
+		Columns:   []string{"user_id", "contract_id", "datetime", "amount", "notes", "due_date"},
+		Vals:      []interface{}{userID, cid, time.Now().Format("2006-01-02 15:04:05"), amount, notes, dueDate},
+		Tx:        tx,
+	})
+	if err != nil {
+		return 0, err
+	}
 
-		tid, err := mysequel.Insert(mysequel.Table{
-			TableName: "transaction",
-			Columns:   []string{"user_id", "datetime", "posting_date", "contract_id", "remark"},
-			Vals:      []interface{}{userID, time.Now().Format("2006-01-02 15:04:05"), time.Now().Format("2006-01-02"), cid, fmt.Sprintf("RECEIPT %d", legacyRid)},
+	plan, err := planLegacyReceipt(tx, rid, cid, amount)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, intPayment := range plan.Interest {
+		_, err := mysequel.Insert(mysequel.Table{
+			TableName: "contract_interest_payment",
+			Columns:   []string{"contract_installment_id", "contract_receipt_id", "amount"},
+			Vals:      []interface{}{intPayment.ContractInstallmentID, intPayment.ContractReceiptID, intPayment.Amount},
 			Tx:        tx,
 		})
 		if err != nil {
-			tx.Rollback()
 			return 0, err
 		}
+	}
 
-		for _, capPayment := range debitPayments {
-			_, err := mysequel.Insert(mysequel.Table{
-				TableName: "account_transaction",
-				Columns:   []string{"transaction_id", "account_id", "type", "amount"},
-				Vals:      []interface{}{tid, capPayment.UnearnedAccountID, "DR", capPayment.Amount},
-				Tx:        tx,
-			})
-			if err != nil {
-				tx.Rollback()
-				return 0, err
-			}
-			_, err = mysequel.Insert(mysequel.Table{
-				TableName: "account_transaction",
-				Columns:   []string{"transaction_id", "account_id", "type", "amount"},
-				Vals:      []interface{}{tid, capPayment.IncomeAccountID, "CR", capPayment.Amount},
-				Tx:        tx,
-			})
-			if err != nil {
-				tx.Rollback()
-				return 0, err
-			}
-			_, err = mysequel.Insert(mysequel.Table{
-				TableName: "contract_capital_payment",
-				Columns:   []string{"contract_installment_id", "contract_receipt_id", "amount"},
-				Vals:      []interface{}{capPayment.ContractInstallmentID, capPayment.ContractReceiptID, capPayment.Amount},
-				Tx:        tx,
-			})
-			if err != nil {
-				tx.Rollback()
-				return 0, err
-			}
+	for _, capPayment := range plan.Capital {
+		_, err := mysequel.Insert(mysequel.Table{
+			TableName: "contract_capital_payment",
+			Columns:   []string{"contract_installment_id", "contract_receipt_id", "amount"},
+			Vals:      []interface{}{capPayment.ContractInstallmentID, capPayment.ContractReceiptID, capPayment.Amount},
+			Tx:        tx,
+		})
+		if err != nil {
+			return 0, err
 		}
+	}
 
-		journalEntries := []smodels.JournalEntry{
-			{Account: fmt.Sprintf("%d", officerAccountID), Debit: fmt.Sprintf("%f", amount), Credit: ""},
-			{Account: fmt.Sprintf("%d", 25), Debit: "", Credit: fmt.Sprintf("%f", amount)},
-			{Account: fmt.Sprintf("%d", 46), Debit: "", Credit: fmt.Sprintf("%f", interestAmount)},
-			{Account: fmt.Sprintf("%d", 78), Debit: fmt.Sprintf("%f", interestAmount), Credit: ""},
+	for _, debPayment := range plan.Debits {
+		_, err := mysequel.Insert(mysequel.Table{
+			TableName: "contract_capital_payment",
+			Columns:   []string{"contract_installment_id", "contract_receipt_id", "amount"},
+			Vals:      []interface{}{debPayment.ContractInstallmentID, debPayment.ContractReceiptID, debPayment.Amount},
+			Tx:        tx,
+		})
+		if err != nil {
+			return 0, err
 		}
-
-		err = scribe.IssueJournalEntries(tx, tid, journalEntries)
-
-		rid = legacyRid
 	}
 
+	tid, err := mysequel.Insert(mysequel.Table{
+		TableName: "transaction",
+		Columns:   []string{"user_id", "datetime", "posting_date", "contract_id", "remark"},
+		Vals:      []interface{}{userID, time.Now().Format("2006-01-02 15:04:05"), time.Now().Format("2006-01-02"), cid, fmt.Sprintf("RECEIPT %d", rid)},
+		Tx:        tx,
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	resp, err := http.Get(requestURL)
+	err = scribe.IssueJournalEntries(tx, tid, legacyReceiptJEs(officerAccountID, amount, plan))
 	if err != nil {
-		return rid, nil
+		return 0, err
 	}
 
-	defer resp.Body.Close()
-
 	return rid, nil
 }
 
-func payments(payablesType string, rid int64, balance *float64, payables []models.ContractPayable, payments []models.ContractPayment) []models.ContractPayment {
-	for _, p := range payables {
-		var payableValue float64
-		if payablesType == "C" {
-			payableValue = p.CapitalPayable
-		} else {
-			payableValue = p.InterestPayable
-		}
-
-		if payableValue != 0 && *balance != 0 {
-			if *balance-payableValue >= 0 {
-				payments = append(payments, models.ContractPayment{ContractInstallmentID: p.InstallmentID, ContractReceiptID: rid, Amount: payableValue})
-				*balance = math.Round((*balance-payableValue)*100) / 100
-			} else {
-				payments = append(payments, models.ContractPayment{ContractInstallmentID: p.InstallmentID, ContractReceiptID: rid, Amount: *balance})
-				*balance = 0
+// contractPayables converts contract payables for allocation,
+// keeping only the given components
+func contractPayables(payables []models.ContractPayable, components ...allocation.Component) []allocation.Payable {
+	ps := make([]allocation.Payable, len(payables))
+	for i, p := range payables {
+		ps[i].ID = p.InstallmentID
+		for _, c := range components {
+			switch c {
+			case allocation.Interest:
+				ps[i].Interest = p.InterestPayable
+			case allocation.Capital:
+				ps[i].Capital = p.CapitalPayable
 			}
 		}
 	}
-	return payments
+	return ps
 }
 
-func debitPayments(rid int64, balance *float64, payables []models.DebitPayableLKAS17, payments []models.DebitPaymentLKAS17) []models.DebitPaymentLKAS17 {
-	for _, p := range payables {
-		if p.CapitalPayable != 0 && *balance != 0 {
-			if *balance-p.CapitalPayable >= 0 {
-				payments = append(payments, models.DebitPaymentLKAS17{ContractInstallmentID: p.InstallmentID, ContractReceiptID: rid, Amount: p.CapitalPayable, ExpenseAccountID: p.ExpenseAccountID, ReceivableAccountID: p.ReceivableAccountID})
-				*balance = math.Round((*balance-p.CapitalPayable)*100) / 100
-			} else {
-				payments = append(payments, models.DebitPaymentLKAS17{ContractInstallmentID: p.InstallmentID, ContractReceiptID: rid, Amount: *balance, ExpenseAccountID: p.ExpenseAccountID, ReceivableAccountID: p.ReceivableAccountID})
-				*balance = 0
-			}
-		}
+// debitPayables converts legacy debit payables for allocation
+func debitPayables(payables []models.DebitPayable) []allocation.Payable {
+	ps := make([]allocation.Payable, len(payables))
+	for i, p := range payables {
+		ps[i] = allocation.Payable{ID: p.InstallmentID, Debit: p.CapitalPayable}
 	}
-	return payments
+	return ps
 }
 
-// IssueLKAS17Receipt issues receipts for contracts that are compliant with LKAS 17
-func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount float64, notes, dueDate, rType string, date time.Time) (int64, error) {
-	fBalance := amount
+// lkas17DebitPayables converts LKAS 17 debit payables for allocation
+func lkas17DebitPayables(payables []models.DebitPayableLKAS17) []allocation.Payable {
+	ps := make([]allocation.Payable, len(payables))
+	for i, p := range payables {
+		ps[i] = allocation.Payable{ID: p.InstallmentID, Debit: p.CapitalPayable}
+	}
+	return ps
+}
 
-	rid, err := mysequel.Insert(mysequel.Table{
-		TableName: "contract_receipt",
-		Columns:   []string{"lkas_17", "user_id", "contract_id", "datetime", "amount", "notes", "due_date"},
-		Vals:      []interface{}{1, userID, cid, date.Format("2006-01-02 15:04:05"), amount, notes, dueDate},
-		Tx:        tx,
-	})
-	if err != nil {
-		return 0, err
+// contractPayments splits allocated lines into interest and capital payments
+func contractPayments(rid int64, lines []allocation.Line) ([]models.ContractPayment, []models.ContractPayment) {
+	var ints []models.ContractPayment
+	var caps []models.ContractPayment
+	for _, l := range lines {
+		p := models.ContractPayment{ContractInstallmentID: l.ID, ContractReceiptID: rid, Amount: l.Amount}
+		if l.Component == allocation.Interest {
+			ints = append(ints, p)
+		} else {
+			caps = append(caps, p)
+		}
 	}
-	m.ReceiptLogger.Printf("RID %d", rid)
+	return ints, caps
+}
+
+// lkas17ReceiptPlan is the allocation of an LKAS 17 receipt over the
+// financial and marketed schedules of a contract and the recovery status it
+// moves the contract to, planned before anything is written
+type lkas17ReceiptPlan struct {
+	Debits     []models.DebitPaymentLKAS17
+	FInts      []models.ContractPayment
+	FCaps      []models.ContractPayment
+	MInts      []models.ContractPayment
+	MCaps      []models.ContractPayment
+	DebitsPaid money.Amount
+	FIntPaid   money.Amount
+	FCapPaid   money.Amount
+	Financial  ContractFinancial
+	Recovery   receiptRecovery
+}
+
+// planLKAS17Receipt allocates an LKAS 17 receipt without writing. Pending
+// debits not yet recorded against the contract are settled after its
+// recorded debits
+func planLKAS17Receipt(tx *sql.Tx, rid int64, cid int, amount money.Amount, pending ...models.DebitPayableLKAS17) (lkas17ReceiptPlan, error) {
+	var plan lkas17ReceiptPlan
 
 	// Loading debit payables
 	var debits []models.DebitPayableLKAS17
-	err = mysequel.QueryToStructs(&debits, tx, queries.DEBITS_LKAS_17, cid)
+	err := mysequel.QueryToStructs(&debits, tx, queries.DEBITS_LKAS_17, cid)
 	if err != nil {
-		return 0, err
+		return plan, err
 	}
+	debits = append(debits, pending...)
 
 	// Calculating debit payments
-	var debitPymnts []models.DebitPaymentLKAS17
-	if len(debits) != 0 {
-		debitPymnts = debitPayments(rid, &fBalance, debits, debitPymnts)
+	debitLines, fBalance := allocation.Allocate(amount, lkas17DebitPayables(debits), allocation.Waterfall)
+	for _, l := range debitLines {
+		plan.DebitsPaid += l.Amount
+		plan.Debits = append(plan.Debits, models.DebitPaymentLKAS17{ContractInstallmentID: l.ID, ContractReceiptID: rid, Amount: l.Amount, ExpenseAccountID: debits[l.Index].ExpenseAccountID, ReceivableAccountID: debits[l.Index].ReceivableAccountID})
 	}
 
 	// Loading financial arrears payables
 	var fArrears []models.ContractPayable
 	err = mysequel.QueryToStructs(&fArrears, tx, queries.FINANCIAL_OVERDUE_INSTALLMENTS_LKAS_17, cid)
 	if err != nil {
-		return 0, err
+		return plan, err
 	}
 
-	var fInts []models.ContractPayment
-	var fCaps []models.ContractPayment
-
 	// Calculate financial arrears interest and capital payments
-	if len(fArrears) > 0 {
-		if fBalance != 0 {
-			fInts = payments("I", rid, &fBalance, fArrears, fInts)
-		}
-
-		if fBalance != 0 {
-			fCaps = payments("C", rid, &fBalance, fArrears, fCaps)
-		}
-	}
+	fLines, fBalance := allocation.Allocate(fBalance, contractPayables(fArrears, allocation.Interest, allocation.Capital), allocation.Waterfall)
+	plan.FInts, plan.FCaps = contractPayments(rid, fLines)
 
 	if fBalance != 0 {
 		// Loading financial upcoming payables
 		var fUpcoming []models.ContractPayable
 		err = mysequel.QueryToStructs(&fUpcoming, tx, queries.FINANCIAL_UPCOMING_INSTALLMENTS_LKAS_17, cid)
 		if err != nil {
-			return 0, err
+			return plan, err
 		}
 
 		// Calculating financial upcoming payments
-		for _, p := range fUpcoming {
-			fInts = payments("I", rid, &fBalance, []models.ContractPayable{p}, fInts)
-			fCaps = payments("C", rid, &fBalance, []models.ContractPayable{p}, fCaps)
-		}
+		fLines, fBalance = allocation.Allocate(fBalance, contractPayables(fUpcoming, allocation.Interest, allocation.Capital), allocation.OldestFirst)
+		ints, caps := contractPayments(rid, fLines)
+		plan.FInts = append(plan.FInts, ints...)
+		plan.FCaps = append(plan.FCaps, caps...)
 	}
 
 	if fBalance != 0 {
-		return 0, errors.New("Error: Payment exceeds payables")
+		return plan, models.ErrPaymentExceedsPayables
+	}
+
+	for _, intPayment := range plan.FInts {
+		plan.FIntPaid += intPayment.Amount
+	}
+	for _, capPayment := range plan.FCaps {
+		plan.FCapPaid += capPayment.Amount
+	}
+
+	var mArrears []models.ContractPayable
+	err = mysequel.QueryToStructs(&mArrears, tx, queries.MARKETED_OVERDUE_INSTALLMENTS_LKAS_17, cid)
+	if err != nil {
+		return plan, err
+	}
+
+	mLines, mBalance := allocation.Allocate(amount-plan.DebitsPaid, contractPayables(mArrears, allocation.Interest, allocation.Capital), allocation.Waterfall)
+	plan.MInts, plan.MCaps = contractPayments(rid, mLines)
+
+	if mBalance != 0 {
+		var mUpcoming []models.ContractPayable
+		err = mysequel.QueryToStructs(&mUpcoming, tx, queries.MARKETED_UPCOMING_INSTALLMENTS_LKAS_17, cid)
+		if err != nil {
+			return plan, err
+		}
+
+		mLines, mBalance = allocation.Allocate(mBalance, contractPayables(mUpcoming, allocation.Interest, allocation.Capital), allocation.OldestFirst)
+		ints, caps := contractPayments(rid, mLines)
+		plan.MInts = append(plan.MInts, ints...)
+		plan.MCaps = append(plan.MCaps, caps...)
+	}
+
+	if mBalance != 0 {
+		return plan, models.ErrPaymentExceedsPayables
+	}
+
+	// Obtain active / period over, arrears status, last installment date
+	cF := &plan.Financial
+	err = tx.QueryRow(queries.ContractFinancial, cid).Scan(&cF.Active, &cF.RecoveryStatus, &cF.Doubtful, &cF.Payment, &cF.CapitalArrears, &cF.InterestArrears, &cF.CapitalProvisioned, &cF.ScheduleEndDate)
+	if err != nil {
+		return plan, err
 	}
 
-	fIntPaid := float64(0)
-	for _, intPayment := range fInts {
-		fIntPaid = fIntPaid + intPayment.Amount
+	var nplProvision money.Amount
+	if cF.RecoveryStatus == RecoveryStatusBDP {
+		err = tx.QueryRow(queries.NplCapitalProvisionAfterPayment, plan.FCapPaid, cid).Scan(&nplProvision)
+		if err != nil {
+			return plan, err
+		}
+	}
+
+	plan.Recovery = recoverReceipt(*cF, amount-plan.DebitsPaid, plan.FIntPaid, plan.FCapPaid, nplProvision)
+	return plan, nil
+}
+
+// receiptRecovery is the recovery status a receipt moves a contract to and
+// the suspended interest and provisioned capital it releases
+type receiptRecovery struct {
+	// Status is zero when the recovery status is unchanged
+	Status   int
+	Doubtful int
+	Interest money.Amount
+	Capital  money.Amount
+	// Reason is the rule applied, written to the receipt log
+	Reason string
+}
+
+// recoverReceipt decides how a receipt paying paid towards the arrears of a
+// contract changes its recovery status. nplProvision is the capital
+// provision of a non performing contract after the receipt
+func recoverReceipt(cF ContractFinancial, paid, fIntPaid, fCapPaid, nplProvision money.Amount) receiptRecovery {
+	arrears := cF.CapitalArrears + cF.InterestArrears
+	nAge := (arrears - paid).Float64() / cF.Payment.Float64()
+
+	if nAge <= 0 && cF.Doubtful == 0 {
+		return receiptRecovery{Status: RecoveryStatusActive, Doubtful: 0, Interest: 0, Capital: cF.CapitalProvisioned,
+			Reason: "nAge <= 0 && cF.Doubtful == 0"}
+	} else if nAge <= 0 && cF.Doubtful == 1 {
+		return receiptRecovery{Status: RecoveryStatusActive, Doubtful: 0, Interest: cF.InterestArrears, Capital: cF.CapitalProvisioned,
+			Reason: "nAge <= 0 && cF.Doubtful == 1"}
+	} else if (cF.RecoveryStatus == RecoveryStatusArrears && nAge > 0 && cF.Doubtful == 1) || (cF.RecoveryStatus == RecoveryStatusNPL && nAge < 6) ||
+		(cF.RecoveryStatus == RecoveryStatusBDP && nAge < 6) {
+		return receiptRecovery{Status: RecoveryStatusArrears, Doubtful: cF.Doubtful, Interest: fIntPaid, Capital: cF.CapitalProvisioned,
+			Reason: `(cF.RecoveryStatus == RecoveryStatusArrears && nAge > 0 && cF.Doubtful == 1) || (cF.RecoveryStatus == RecoveryStatusNPL && nAge < 6) ||
+		(cF.RecoveryStatus == RecoveryStatusBDP && nAge < 6)`}
+	} else if (cF.RecoveryStatus == RecoveryStatusNPL && nAge >= 6) || (cF.RecoveryStatus == RecoveryStatusBDP && nAge >= 12) {
+		return receiptRecovery{Doubtful: cF.Doubtful, Interest: fIntPaid, Capital: fCapPaid,
+			Reason: "nAge >= 6 || nAge >= 12"}
+	} else if cF.RecoveryStatus == RecoveryStatusBDP && nAge < 12 {
+		return receiptRecovery{Status: RecoveryStatusNPL, Doubtful: cF.Doubtful, Interest: fIntPaid, Capital: cF.CapitalProvisioned - nplProvision,
+			Reason: "cF.RecoveryStatus == RecoveryStatusBDP && nAge < 12"}
+	}
+	return receiptRecovery{Doubtful: cF.Doubtful}
+}
+
+// lkas17ReceiptJEs returns the journal entries of a planned LKAS 17 receipt
+func lkas17ReceiptJEs(tx *sql.Tx, userID int, amount money.Amount, rType string, plan lkas17ReceiptPlan) ([]smodels.JournalEntry, error) {
+	debitJEs := []smodels.JournalEntry{}
+	for _, debPayment := range plan.Debits {
+		debitJEs = append(debitJEs, smodels.JournalEntry{Account: fmt.Sprintf("%d", debPayment.ExpenseAccountID), Debit: "", Credit: debPayment.Amount.String()})
+	}
+
+	receiptJEs, err := cashInHandJE(tx, int64(userID), amount, amount-plan.DebitsPaid, debitJEs, rType)
+	if err != nil {
+		return nil, err
+	}
+	return append(receiptJEs, badDebtJEs(plan.Recovery.Interest, plan.Recovery.Capital)...), nil
+}
+
+// IssueLKAS17Receipt issues receipts for contracts that are compliant with LKAS 17
+func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount money.Amount, notes, dueDate, rType string, date time.Time) (int64, error) {
+	rid, err := mysequel.Insert(mysequel.Table{
+		TableName: "contract_receipt",
+		Columns:   []string{"lkas_17", "user_id", "contract_id", "datetime", "amount", "notes", "due_date"},
+		Vals:      []interface{}{1, userID, cid, date.Format("2006-01-02 15:04:05"), amount, notes, dueDate},
+		Tx:        tx,
+	})
+	if err != nil {
+		return 0, err
+	}
+	m.ReceiptLogger.Printf("RID %d", rid)
+
+	plan, err := planLKAS17Receipt(tx, rid, cid, amount)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, intPayment := range plan.FInts {
 		_, err := mysequel.Insert(mysequel.Table{
 			TableName: "contract_financial_payment",
 			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
@@ -549,9 +673,7 @@ func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount f
 		}
 	}
 
-	fCapPaid := float64(0)
-	for _, capPayment := range fCaps {
-		fCapPaid = fCapPaid + capPayment.Amount
+	for _, capPayment := range plan.FCaps {
 		_, err := mysequel.Insert(mysequel.Table{
 			TableName: "contract_financial_payment",
 			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
@@ -568,20 +690,16 @@ func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount f
 		}
 	}
 
-	debitJEs := []smodels.JournalEntry{}
-
-	debitsPaid := float64(0)
-	for _, debPayment := range debitPymnts {
-		debitsPaid = debitsPaid + debPayment.Amount
-
-		debitJEs = append(debitJEs, smodels.JournalEntry{Account: fmt.Sprintf("%d", debPayment.ExpenseAccountID), Debit: "", Credit: fmt.Sprintf("%f", debPayment.Amount)})
-
+	for _, debPayment := range plan.Debits {
 		_, err := mysequel.Insert(mysequel.Table{
 			TableName: "contract_financial_payment",
 			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
 			Vals:      []interface{}{3, debPayment.ContractInstallmentID, debPayment.ContractReceiptID, debPayment.Amount},
 			Tx:        tx,
 		})
+		if err != nil {
+			return 0, err
+		}
 		_, err = mysequel.Insert(mysequel.Table{
 			TableName: "contract_marketed_payment",
 			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
@@ -598,43 +716,7 @@ func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount f
 		}
 	}
 
-	mBalance := amount - debitsPaid
-
-	var mArrears []models.ContractPayable
-	err = mysequel.QueryToStructs(&mArrears, tx, queries.MARKETED_OVERDUE_INSTALLMENTS_LKAS_17, cid)
-	if err != nil {
-		return 0, err
-	}
-
-	var mInts []models.ContractPayment
-	var mCaps []models.ContractPayment
-
-	if mBalance != 0 {
-		mInts = payments("I", rid, &mBalance, mArrears, mInts)
-	}
-
-	if mBalance != 0 {
-		mCaps = payments("C", rid, &mBalance, mArrears, mCaps)
-	}
-
-	if mBalance != 0 {
-		var mUpcoming []models.ContractPayable
-		err = mysequel.QueryToStructs(&mUpcoming, tx, queries.MARKETED_UPCOMING_INSTALLMENTS_LKAS_17, cid)
-		if err != nil {
-			return 0, err
-		}
-
-		for _, p := range mUpcoming {
-			mInts = payments("I", rid, &mBalance, []models.ContractPayable{p}, mInts)
-			mCaps = payments("C", rid, &mBalance, []models.ContractPayable{p}, mCaps)
-		}
-	}
-
-	if mBalance != 0 {
-		return 0, errors.New("Error: Payment exceeds payables")
-	}
-
-	for _, intPayment := range mInts {
+	for _, intPayment := range plan.MInts {
 		_, err := mysequel.Insert(mysequel.Table{
 			TableName: "contract_marketed_payment",
 			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
@@ -651,7 +733,7 @@ func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount f
 		}
 	}
 
-	for _, capPayment := range mCaps {
+	for _, capPayment := range plan.MCaps {
 		_, err := mysequel.Insert(mysequel.Table{
 			TableName: "contract_marketed_payment",
 			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
@@ -668,15 +750,21 @@ func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount f
 		}
 	}
 
-	// Obtain active / period over, arrears status, last installment date
-	var cF ContractFinancial
-	err = tx.QueryRow(queries.ContractFinancial, cid).Scan(&cF.Active, &cF.RecoveryStatus, &cF.Doubtful, &cF.Payment, &cF.CapitalArrears, &cF.InterestArrears, &cF.CapitalProvisioned, &cF.ScheduleEndDate)
+	cF := plan.Financial
+	m.ReceiptLogger.Printf("RID %d \t %+v", rid, cF)
+
+	// Snapshot recovery status and provisioning so that the receipt can be reversed
+	_, err = mysequel.Insert(mysequel.Table{
+		TableName: "contract_receipt_financial",
+		Columns:   []string{"contract_receipt_id", "recovery_status_id", "doubtful", "capital_provisioned"},
+		Vals:      []interface{}{rid, cF.RecoveryStatus, cF.Doubtful, cF.CapitalProvisioned},
+		Tx:        tx,
+	})
 	if err != nil {
 		return 0, err
 	}
-	m.ReceiptLogger.Printf("RID %d \t %+v", rid, cF)
 
-	_, err = tx.Exec("UPDATE contract_financial SET capital_paid = capital_paid + ?, interest_paid = interest_paid + ?, charges_debits_paid = charges_debits_paid + ?, capital_arrears = capital_arrears - ?, interest_arrears = interest_arrears - ?, charges_debits_arrears = charges_debits_arrears - ? WHERE contract_id = ?", fCapPaid, fIntPaid, debitsPaid, fCapPaid, fIntPaid, debitsPaid, cid)
+	_, err = tx.Exec("UPDATE contract_financial SET capital_paid = capital_paid + ?, interest_paid = interest_paid + ?, charges_debits_paid = charges_debits_paid + ?, capital_arrears = capital_arrears - ?, interest_arrears = interest_arrears - ?, charges_debits_arrears = charges_debits_arrears - ? WHERE contract_id = ?", plan.FCapPaid, plan.FIntPaid, plan.DebitsPaid, plan.FCapPaid, plan.FIntPaid, plan.DebitsPaid, cid)
 	if err != nil {
 		return 0, err
 	}
@@ -691,58 +779,23 @@ func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount f
 		return 0, err
 	}
 
-	receiptJEs := []smodels.JournalEntry{}
-
-	cashJEs, err := cashInHandJE(tx, int64(userID), amount, amount-debitsPaid, debitJEs, rType)
+	receiptJEs, err := lkas17ReceiptJEs(tx, userID, amount, rType, plan)
 	if err != nil {
 		return 0, err
 	}
-	receiptJEs = append(receiptJEs, cashJEs...)
-
-	arrears := cF.CapitalArrears + cF.InterestArrears
-	nAge := (arrears - (amount - debitsPaid)) / cF.Payment
 
-	if nAge <= 0 && cF.Doubtful == 0 {
-		m.ReceiptLogger.Printf("RID %d \t %s", rid, "nAge <= 0 && cF.Doubtful == 0")
-		// db_txn, txn_id, interest, capital_provisioned
-		receiptJEs, err = addBadDebtJEsUpdateStatus(tx, int64(cid), tid, 0, cF.CapitalProvisioned, receiptJEs, `UPDATE contract_financial SET recovery_status_id = ?, doubtful = ? WHERE contract_id = ?`, RecoveryStatusActive, 0, cid)
-		if err != nil {
-			return 0, err
-		}
-	} else if nAge <= 0 && cF.Doubtful == 1 {
-		m.ReceiptLogger.Printf("RID %d \t %s", rid, "nAge <= 0 && cF.Doubtful == 1")
-		// db_txn, txn_id, interest, capital_provisioned
-		receiptJEs, err = addBadDebtJEsUpdateStatus(tx, int64(cid), tid, cF.InterestArrears, cF.CapitalProvisioned, receiptJEs, `UPDATE contract_financial SET recovery_status_id = ?, doubtful = ? WHERE contract_id = ?`, RecoveryStatusActive, 0, cid)
-		if err != nil {
-			return 0, err
-		}
-	} else if (cF.RecoveryStatus == RecoveryStatusArrears && nAge > 0 && cF.Doubtful == 1) || (cF.RecoveryStatus == RecoveryStatusNPL && nAge < 6) ||
-		(cF.RecoveryStatus == RecoveryStatusBDP && nAge < 6) {
-		m.ReceiptLogger.Printf("RID %d \t %s", rid, `(cF.RecoveryStatus == RecoveryStatusArrears && nAge > 0 && cF.Doubtful == 1) || (cF.RecoveryStatus == RecoveryStatusNPL && nAge < 6) ||
-		(cF.RecoveryStatus == RecoveryStatusBDP && nAge < 6)`)
-		// db_txn, txn_id, interest, capital_provisioned
-		receiptJEs, err = addBadDebtJEsUpdateStatus(tx, int64(cid), tid, fIntPaid, cF.CapitalProvisioned, receiptJEs, `UPDATE contract_financial SET recovery_status_id = ? WHERE contract_id = ?`, RecoveryStatusArrears, cid)
-		if err != nil {
-			return 0, err
-		}
-	} else if (cF.RecoveryStatus == RecoveryStatusNPL && nAge >= 6) || (cF.RecoveryStatus == RecoveryStatusBDP && nAge >= 12) {
-		m.ReceiptLogger.Printf("RID %d \t %s", rid, "nAge >= 6 || nAge >= 12")
-		bdJEs, err := badDebtReceiptJEProvision(tx, int64(cid), tid, fIntPaid, fCapPaid)
-		if err != nil {
-			return 0, err
-		}
-		receiptJEs = append(receiptJEs, bdJEs...)
-	} else if cF.RecoveryStatus == RecoveryStatusBDP && nAge < 12 {
-		m.ReceiptLogger.Printf("RID %d \t %s", rid, "cF.RecoveryStatus == RecoveryStatusBDP && nAge < 12")
-		var capitalProvision float64
-		err = tx.QueryRow(queries.NplCapitalProvision, cid).Scan(&capitalProvision)
+	rec := plan.Recovery
+	if rec.Reason != "" {
+		m.ReceiptLogger.Printf("RID %d \t %s", rid, rec.Reason)
+	}
+	if rec.Capital != 0 {
+		_, err = tx.Exec(`UPDATE contract_financial SET capital_provisioned = capital_provisioned - ? WHERE contract_id = ?`, rec.Capital, cid)
 		if err != nil {
 			return 0, err
 		}
-		capitalProvisionRemoval := math.Round((cF.CapitalProvisioned-capitalProvision)*100) / 100
-
-		// db_txn, txn_id, interest, capital_provisioned
-		receiptJEs, err = addBadDebtJEsUpdateStatus(tx, int64(cid), tid, fIntPaid, capitalProvisionRemoval, receiptJEs, `UPDATE contract_financial SET recovery_status_id = ? WHERE contract_id = ?`, RecoveryStatusNPL, cid)
+	}
+	if rec.Status != 0 {
+		_, err = tx.Exec(`UPDATE contract_financial SET recovery_status_id = ?, doubtful = ? WHERE contract_id = ?`, rec.Status, rec.Doubtful, cid)
 		if err != nil {
 			return 0, err
 		}
@@ -757,7 +810,7 @@ func (m *ContractModel) IssueLKAS17Receipt(tx *sql.Tx, userID, cid int, amount f
 	return rid, err
 }
 
-func addBadDebtJEsUpdateStatus(tx *sql.Tx, cid, tid int64, interest, capitalProvisioned float64, receiptJEs []smodels.JournalEntry, query string, queryArgs ...interface{}) ([]smodels.JournalEntry, error) {
+func addBadDebtJEsUpdateStatus(tx *sql.Tx, cid, tid int64, interest, capitalProvisioned money.Amount, receiptJEs []smodels.JournalEntry, query string, queryArgs ...interface{}) ([]smodels.JournalEntry, error) {
 	bdJEs, err := badDebtReceiptJEProvision(tx, int64(cid), tid, interest, capitalProvisioned)
 	if err != nil {
 		return nil, err
@@ -770,26 +823,33 @@ func addBadDebtJEsUpdateStatus(tx *sql.Tx, cid, tid int64, interest, capitalProv
 	return receiptJEs, nil
 }
 
-func badDebtReceiptJEProvision(tx *sql.Tx, cid, tid int64, interest, capital float64) ([]smodels.JournalEntry, error) {
-	journalEntries := []smodels.JournalEntry{}
-	if interest != 0 {
-		journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", SuspenseInterestAccount), Debit: fmt.Sprintf("%f", interest), Credit: ""},
-			smodels.JournalEntry{Account: fmt.Sprintf("%d", InterestIncomeAccount), Debit: "", Credit: fmt.Sprintf("%f", interest)})
-	}
+func badDebtReceiptJEProvision(tx *sql.Tx, cid, tid int64, interest, capital money.Amount) ([]smodels.JournalEntry, error) {
 	if capital != 0 {
-		// Reverse capital provisioned
-		journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", ProvisionForBadDebtAccount), Debit: fmt.Sprintf("%f", capital), Credit: ""},
-			smodels.JournalEntry{Account: fmt.Sprintf("%d", BadDebtProvisionAccount), Debit: "", Credit: fmt.Sprintf("%f", capital)})
-
 		_, err := tx.Exec(`UPDATE contract_financial SET capital_provisioned = capital_provisioned - ? WHERE contract_id = ?`, capital, cid)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return journalEntries, nil
+	return badDebtJEs(interest, capital), nil
+}
+
+// badDebtJEs returns the journal entries releasing suspended interest and
+// provisioned capital
+func badDebtJEs(interest, capital money.Amount) []smodels.JournalEntry {
+	journalEntries := []smodels.JournalEntry{}
+	if interest != 0 {
+		journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", SuspenseInterestAccount), Debit: interest.String(), Credit: ""},
+			smodels.JournalEntry{Account: fmt.Sprintf("%d", InterestIncomeAccount), Debit: "", Credit: interest.String()})
+	}
+	if capital != 0 {
+		// Reverse capital provisioned
+		journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", ProvisionForBadDebtAccount), Debit: capital.String(), Credit: ""},
+			smodels.JournalEntry{Account: fmt.Sprintf("%d", BadDebtProvisionAccount), Debit: "", Credit: capital.String()})
+	}
+	return journalEntries
 }
 
-func cashInHandJE(tx *sql.Tx, userID int64, receiptAmount, arrearsDeduction float64, debits []smodels.JournalEntry, rType string) ([]smodels.JournalEntry, error) {
+func cashInHandJE(tx *sql.Tx, userID int64, receiptAmount, arrearsDeduction money.Amount, debits []smodels.JournalEntry, rType string) ([]smodels.JournalEntry, error) {
 	var cashAccountID int
 	if rType == "REGULAR" {
 		err := tx.QueryRow(queries.OFFICER_ACC_NO, userID).Scan(&cashAccountID)
@@ -801,7 +861,7 @@ func cashInHandJE(tx *sql.Tx, userID int64, receiptAmount, arrearsDeduction floa
 	}
 
 	journalEntries := []smodels.JournalEntry{
-		{Account: fmt.Sprintf("%d", cashAccountID), Debit: fmt.Sprintf("%f", receiptAmount), Credit: ""},
+		{Account: fmt.Sprintf("%d", cashAccountID), Debit: receiptAmount.String(), Credit: ""},
 	}
 
 	if len(debits) > 0 {
@@ -811,7 +871,7 @@ func cashInHandJE(tx *sql.Tx, userID int64, receiptAmount, arrearsDeduction floa
 	}
 
 	if arrearsDeduction > 0 {
-		journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", ReceivableArrearsAccount), Debit: "", Credit: fmt.Sprintf("%f", arrearsDeduction)})
+		journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", ReceivableArrearsAccount), Debit: "", Credit: arrearsDeduction.String()})
 	}
 
 	return journalEntries, nil
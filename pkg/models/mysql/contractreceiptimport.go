@@ -0,0 +1,187 @@
+package mysql
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+)
+
+// Receipt import row statuses
+const (
+	ImportPosted    = "POSTED"
+	ImportFloat     = "FLOAT"
+	ImportDuplicate = "DUPLICATE"
+	ImportUnmatched = "UNMATCHED"
+	ImportFailed    = "FAILED"
+)
+
+// contractReference matches references that are only a contract number,
+// optionally prefixed such as C-1234 or Contract 1234
+var contractReference = regexp.MustCompile(`(?i)^(?:contract|con|c)?[\s#:/-]*(\d+)$`)
+
+// ImportReceipts posts receipts from a CSV file. The first row is a header naming
+// the columns: amount and either contract_id or reference are required, date,
+// notes and transaction_id are optional. Rows are matched to the contract named by
+// contract_id or by a reference that is a contract number. Rows naming no contract or
+// several contracts are left unmatched. Each row is posted through Receipt with a
+// checksum of the bank transaction id, or of the row content, so that a file can be
+// imported again, or alongside a statement covering the same days, without
+// duplicating receipts. Payments exceeding the contract payable are reported as
+// float
+func (m *ContractModel) ImportReceipts(userID int, file io.Reader) ([]models.ReceiptImportResult, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	_, hasAmount := columns["amount"]
+	_, hasContract := columns["contract_id"]
+	_, hasReference := columns["reference"]
+	if !hasAmount || (!hasContract && !hasReference) {
+		return nil, models.ErrImportHeader
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	// seen counts identical rows so that repeated payments each get a checksum
+	seen := make(map[string]int)
+	results := []models.ReceiptImportResult{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, err
+		}
+
+		result := models.ReceiptImportResult{Row: row, Reference: field(record, "reference")}
+
+		amount, err := money.Parse(strings.Replace(field(record, "amount"), ",", "", -1))
+		if err != nil || amount <= 0 {
+			result.Status = ImportFailed
+			result.Error = "Invalid amount"
+			results = append(results, result)
+			continue
+		}
+		result.Amount = amount
+
+		content := []string{field(record, "date"), field(record, "contract_id"), result.Reference, amount.String(), field(record, "notes")}
+		key := strings.Join(content, ",")
+		seen[key]++
+		checksum := importChecksum(field(record, "transaction_id"), content, seen[key])
+
+		cids, err := m.matchContracts(field(record, "contract_id"), result.Reference)
+		if err != nil {
+			result.Status = ImportFailed
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		if len(cids) != 1 {
+			result.Status = ImportUnmatched
+			result.Error = "No contract matches the row"
+			if len(cids) > 1 {
+				result.Error = "Several contracts match the row"
+			}
+			results = append(results, result)
+			continue
+		}
+		cid := cids[0]
+		result.ContractID = cid
+
+		notes := field(record, "notes")
+		if notes == "" {
+			notes = result.Reference
+		}
+
+		rid, float, err := m.issueReceipt(userID, cid, amount, notes, "", checksum)
+		if err != nil {
+			result.Status = ImportFailed
+			result.Error = err.Error()
+		} else if rid == 0 {
+			result.Status = ImportDuplicate
+		} else if float {
+			result.Status = ImportFloat
+			result.ReceiptID = rid
+		} else {
+			result.Status = ImportPosted
+			result.ReceiptID = rid
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// importChecksum identifies an import row by its bank transaction id or, without
+// one, by its content and how many identical rows came before it in the file.
+// The checksum does not depend on the position of the row, so rows added to or
+// removed from a statement do not change the checksums of the others
+func importChecksum(transactionID string, content []string, occurrence int) string {
+	key := fmt.Sprintf("row,%d,%s", occurrence, strings.Join(content, ","))
+	if transactionID != "" {
+		key = "transaction_id," + transactionID
+	}
+	sum := md5.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// matchContracts returns the distinct contracts named by the contract_id and
+// reference of an import row. A row naming a contract that does not exist
+// matches none
+func (m *ContractModel) matchContracts(contractID, reference string) ([]int, error) {
+	var candidates []string
+	if contractID != "" {
+		candidates = append(candidates, contractID)
+	}
+	if match := contractReference.FindStringSubmatch(reference); match != nil {
+		candidates = append(candidates, match[1])
+	}
+
+	var cids []int
+	for _, c := range candidates {
+		cid, err := strconv.Atoi(c)
+		if err != nil {
+			return nil, nil
+		}
+
+		var id int
+		err = m.DB.QueryRow(queries.ContractExists, cid).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(cids) == 0 || cids[0] != id {
+			cids = append(cids, id)
+		}
+	}
+
+	return cids, nil
+}
@@ -0,0 +1,55 @@
+package mysql
+
+import "testing"
+
+func TestImportChecksum(t *testing.T) {
+	payment := []string{"2026-03-02", "1234", "C-1234", "5000.00", ""}
+	other := []string{"2026-03-02", "1234", "C-1234", "5000.00", "Second payment"}
+
+	tests := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{
+			name:  "same row in another file",
+			a:     importChecksum("", payment, 1),
+			b:     importChecksum("", payment, 1),
+			equal: true,
+		},
+		{
+			name: "repeated payment in the same file",
+			a:    importChecksum("", payment, 1),
+			b:    importChecksum("", payment, 2),
+		},
+		{
+			name: "different content",
+			a:    importChecksum("", payment, 1),
+			b:    importChecksum("", other, 1),
+		},
+		{
+			name: "another value date",
+			a:    importChecksum("", payment, 1),
+			b:    importChecksum("", []string{"2026-03-03", "1234", "C-1234", "5000.00", ""}, 1),
+		},
+		{
+			name:  "transaction id ignores the content",
+			a:     importChecksum("TX-99", payment, 1),
+			b:     importChecksum("TX-99", other, 2),
+			equal: true,
+		},
+		{
+			name: "transaction ids differ",
+			a:    importChecksum("TX-99", payment, 1),
+			b:    importChecksum("TX-100", payment, 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.a == tt.b) != tt.equal {
+				t.Errorf("checksums %s and %s equal = %v, want %v", tt.a, tt.b, tt.a == tt.b, tt.equal)
+			}
+		})
+	}
+}
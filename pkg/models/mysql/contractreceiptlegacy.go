@@ -1,18 +1,18 @@
 package mysql
 
 import (
-	"errors"
 	"fmt"
-	"math"
 	"time"
 
+	"github.com/ssrdive/cidium/pkg/allocation"
 	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
 	"github.com/ssrdive/cidium/pkg/sql/queries"
 	"github.com/ssrdive/mysequel"
 )
 
 // LegacyReceipt issues a legacy receipt
-func (m *ContractModel) LegacyReceipt(userID, cid int, amount float64, notes string) (int64, error) {
+func (m *ContractModel) LegacyReceipt(userID, cid int, amount money.Amount, notes string) (int64, error) {
 	tx, err := m.DB.Begin()
 	if err != nil {
 		return 0, err
@@ -44,10 +44,6 @@ func (m *ContractModel) LegacyReceipt(userID, cid int, amount float64, notes str
 	var diUpdates []models.ContractDefaultInterestUpdate
 	var diLogs []models.ContractDefaultInterestChangeHistory
 	var diPayments []models.ContractPayment
-	var intPayments []models.ContractPayment
-	var capPayments []models.ContractPayment
-
-	balance := amount
 
 	rid, err := mysequel.Insert(mysequel.Table{
 		TableName: "contract_receipt",
@@ -60,19 +56,8 @@ func (m *ContractModel) LegacyReceipt(userID, cid int, amount float64, notes str
 		return 0, err
 	}
 
-	if balance != 0 {
-		for _, p := range debits {
-			if p.CapitalPayable != 0 && balance != 0 {
-				if balance-p.CapitalPayable >= 0 {
-					capPayments = append(capPayments, models.ContractPayment{p.InstallmentID, rid, p.CapitalPayable})
-					balance = math.Round((balance-p.CapitalPayable)*100) / 100
-				} else {
-					capPayments = append(capPayments, models.ContractPayment{p.InstallmentID, rid, balance})
-					balance = 0
-				}
-			}
-		}
-	}
+	lines, balance := allocation.Allocate(amount, contractPayables(debits, allocation.Capital), allocation.Waterfall)
+	intPayments, capPayments := contractPayments(rid, lines)
 
 	if balance != 0 {
 		results, err = tx.Query(queries.LEGACY_PAYMENTS, cid)
@@ -91,31 +76,15 @@ func (m *ContractModel) LegacyReceipt(userID, cid int, amount float64, notes str
 			upcoming = append(upcoming, u)
 		}
 
-		for _, p := range upcoming {
-			if p.InterestPayable != 0 && balance != 0 {
-				if balance-p.InterestPayable >= 0 {
-					intPayments = append(intPayments, models.ContractPayment{p.InstallmentID, rid, p.InterestPayable})
-					balance = math.Round((balance-p.InterestPayable)*100) / 100
-				} else {
-					intPayments = append(intPayments, models.ContractPayment{p.InstallmentID, rid, balance})
-					balance = 0
-				}
-			}
-			if p.CapitalPayable != 0 && balance != 0 {
-				if balance-p.CapitalPayable >= 0 {
-					capPayments = append(capPayments, models.ContractPayment{p.InstallmentID, rid, p.CapitalPayable})
-					balance = math.Round((balance-p.CapitalPayable)*100) / 100
-				} else {
-					capPayments = append(capPayments, models.ContractPayment{p.InstallmentID, rid, balance})
-					balance = 0
-				}
-			}
-		}
+		lines, balance = allocation.Allocate(balance, contractPayables(upcoming, allocation.Interest, allocation.Capital), allocation.OldestFirst)
+		ints, caps := contractPayments(rid, lines)
+		intPayments = append(intPayments, ints...)
+		capPayments = append(capPayments, caps...)
 	}
 
 	if balance != 0 {
 		tx.Rollback()
-		return 0, errors.New("Error: Payment exceeds payables")
+		return 0, models.ErrPaymentExceedsPayables
 	}
 
 	for _, diUpdate := range diUpdates {
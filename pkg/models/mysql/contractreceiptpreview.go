@@ -0,0 +1,187 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+	smodels "github.com/ssrdive/scribe/models"
+)
+
+// ReceiptPreview plans a receipt with the same allocation as Receipt over
+// the payables of a contract, and returns the planned allocation, the
+// resulting recovery status and the journal entries. Nothing is written, so
+// previews take no locks and use no receipt numbers
+func (m *ContractModel) ReceiptPreview(userID, cid int, amount money.Amount) (models.ReceiptPreview, error) {
+	preview := models.ReceiptPreview{Allocations: []models.ReceiptPreviewAllocation{}, JournalEntries: []models.TransactionEntry{}}
+
+	tx, err := m.DB.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return preview, err
+	}
+	defer tx.Rollback()
+
+	var managedByAgrivest int
+	var lkas17Compliant int
+	var telephone string
+	err = tx.QueryRow(queries.MANAGED_BY_AGRIVEST_LKAS17_COMPLIANT, cid).Scan(&lkas17Compliant, &managedByAgrivest, &telephone)
+	if err != nil {
+		return preview, err
+	}
+
+	// The receipt raises a debit note for the default it settles
+	pending, err := pendingDefault(tx, cid, amount)
+	if err != nil {
+		return preview, err
+	}
+
+	var contractTotalPayable money.Amount
+	if lkas17Compliant == 1 {
+		err = tx.QueryRow(queries.CONTRACT_PAYABLE_LKAS_17, cid).Scan(&contractTotalPayable)
+	} else {
+		err = tx.QueryRow(queries.CONTRACT_PAYABLE, cid).Scan(&contractTotalPayable)
+	}
+	if err != nil {
+		return preview, err
+	}
+
+	var officerAccountID int
+	err = tx.QueryRow(queries.OFFICER_ACC_NO, userID).Scan(&officerAccountID)
+	if err != nil {
+		return preview, err
+	}
+
+	var journalEntries []smodels.JournalEntry
+	if contractTotalPayable+pending < amount {
+		preview.Float = true
+		journalEntries = []smodels.JournalEntry{
+			{Account: fmt.Sprintf("%d", officerAccountID), Debit: amount.String(), Credit: ""},
+			{Account: fmt.Sprintf("%d", 144), Debit: "", Credit: amount.String()},
+		}
+	} else if lkas17Compliant == 1 {
+		journalEntries, err = previewLKAS17Receipt(tx, &preview, userID, cid, amount, pending)
+	} else {
+		journalEntries, err = previewLegacyReceipt(tx, &preview, officerAccountID, cid, amount, pending)
+	}
+	if err != nil {
+		return preview, err
+	}
+
+	preview.JournalEntries, err = transactionEntries(journalEntries)
+	if err != nil {
+		return preview, err
+	}
+
+	return preview, nil
+}
+
+// previewLKAS17Receipt plans an LKAS 17 receipt into a preview and returns
+// its journal entries
+func previewLKAS17Receipt(tx *sql.Tx, preview *models.ReceiptPreview, userID, cid int, amount, pending money.Amount) ([]smodels.JournalEntry, error) {
+	var pendingDebits []models.DebitPayableLKAS17
+	if pending != 0 {
+		debit := models.DebitPayableLKAS17{ContractID: cid, CapitalPayable: pending}
+		err := tx.QueryRow(queries.GET_DEBIT_TYPE_EXPENSE_RECEIVABLE_ACCOUNT, DefaultDebitType).Scan(&debit.ExpenseAccountID, &debit.ReceivableAccountID)
+		if err != nil {
+			return nil, err
+		}
+		pendingDebits = append(pendingDebits, debit)
+	}
+
+	plan, err := planLKAS17Receipt(tx, 0, cid, amount, pendingDebits...)
+	if err != nil {
+		return nil, err
+	}
+
+	preview.Allocations = append(preview.Allocations, previewAllocations("FINANCIAL", "Interest", plan.FInts)...)
+	preview.Allocations = append(preview.Allocations, previewAllocations("FINANCIAL", "Capital", plan.FCaps)...)
+	for _, debPayment := range plan.Debits {
+		preview.Allocations = append(preview.Allocations, models.ReceiptPreviewAllocation{Schedule: "FINANCIAL", PaymentType: "Debit", ScheduleID: debPayment.ContractInstallmentID, Amount: debPayment.Amount})
+	}
+	for _, debPayment := range plan.Debits {
+		preview.Allocations = append(preview.Allocations, models.ReceiptPreviewAllocation{Schedule: "MARKETED", PaymentType: "Debit", ScheduleID: debPayment.ContractInstallmentID, Amount: debPayment.Amount})
+	}
+	preview.Allocations = append(preview.Allocations, previewAllocations("MARKETED", "Interest", plan.MInts)...)
+	preview.Allocations = append(preview.Allocations, previewAllocations("MARKETED", "Capital", plan.MCaps)...)
+
+	cF, rec := plan.Financial, plan.Recovery
+	recoveryStatus := cF.RecoveryStatus
+	if rec.Status != 0 {
+		recoveryStatus = rec.Status
+	}
+	status := models.ReceiptPreviewStatus{
+		Doubtful:           rec.Doubtful,
+		CapitalArrears:     cF.CapitalArrears - plan.FCapPaid,
+		InterestArrears:    cF.InterestArrears - plan.FIntPaid,
+		CapitalProvisioned: cF.CapitalProvisioned - rec.Capital,
+	}
+	err = tx.QueryRow(queries.RecoveryStatusName, recoveryStatus).Scan(&status.RecoveryStatus)
+	if err != nil {
+		return nil, err
+	}
+	preview.Status = &status
+
+	return lkas17ReceiptJEs(tx, userID, amount, "REGULAR", plan)
+}
+
+// previewLegacyReceipt plans a receipt of a contract that is not compliant
+// with LKAS 17 into a preview and returns its journal entries
+func previewLegacyReceipt(tx *sql.Tx, preview *models.ReceiptPreview, officerAccountID, cid int, amount, pending money.Amount) ([]smodels.JournalEntry, error) {
+	var pendingDebits []models.DebitPayable
+	if pending != 0 {
+		debit := models.DebitPayable{ContractID: cid, CapitalPayable: pending}
+		err := tx.QueryRow(queries.DebitTypeUnearnedIncomeAccount, DefaultDebitType).Scan(&debit.UnearnedAccountID, &debit.IncomeAccountID)
+		if err != nil {
+			return nil, err
+		}
+		pendingDebits = append(pendingDebits, debit)
+	}
+
+	plan, err := planLegacyReceipt(tx, 0, cid, amount, pendingDebits...)
+	if err != nil {
+		return nil, err
+	}
+
+	preview.Allocations = append(preview.Allocations, previewAllocations("LEGACY", "Interest", plan.Interest)...)
+	preview.Allocations = append(preview.Allocations, previewAllocations("LEGACY", "Capital", plan.Capital)...)
+	for _, debPayment := range plan.Debits {
+		preview.Allocations = append(preview.Allocations, models.ReceiptPreviewAllocation{Schedule: "LEGACY", PaymentType: "Debit", ScheduleID: debPayment.ContractInstallmentID, Amount: debPayment.Amount})
+	}
+
+	return legacyReceiptJEs(officerAccountID, amount, plan), nil
+}
+
+func previewAllocations(schedule, paymentType string, payments []models.ContractPayment) []models.ReceiptPreviewAllocation {
+	allocations := make([]models.ReceiptPreviewAllocation, len(payments))
+	for i, p := range payments {
+		allocations[i] = models.ReceiptPreviewAllocation{Schedule: schedule, PaymentType: paymentType, ScheduleID: p.ContractInstallmentID, Amount: p.Amount}
+	}
+	return allocations
+}
+
+// transactionEntries lists journal entries as the account transactions
+// scribe records for them
+func transactionEntries(journalEntries []smodels.JournalEntry) ([]models.TransactionEntry, error) {
+	entries := []models.TransactionEntry{}
+	for _, je := range journalEntries {
+		accountID, err := strconv.Atoi(je.Account)
+		if err != nil {
+			return nil, err
+		}
+		for _, side := range []struct{ Type, Amount string }{{"DR", je.Debit}, {"CR", je.Credit}} {
+			if len(side.Amount) == 0 {
+				continue
+			}
+			amount, err := money.Parse(side.Amount)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, models.TransactionEntry{AccountID: accountID, Type: side.Type, Amount: amount})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,223 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+	"github.com/ssrdive/mysequel"
+	"github.com/ssrdive/scribe"
+	smodels "github.com/ssrdive/scribe/models"
+)
+
+// ReverseReceipt cancels an LKAS 17 receipt. Payments allocated by the receipt are
+// offset, schedule and financial balances are restored, the receipt journal entries
+// are reversed and the recovery status and provisioning are returned to their state
+// before the receipt. Debit notes raised from the default interest pending when
+// the receipt was issued are cancelled and the default is restored. Only the
+// latest receipt of a contract can be reversed and only if nothing else has been
+// posted to the contract since
+func (m *ContractModel) ReverseReceipt(userID, rid int, reason string) (int64, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	var target models.ReceiptReversalTarget
+	err = tx.QueryRow(queries.ReceiptReversalTarget, rid).Scan(&target.ContractID, &target.LKAS17, &target.Reversed, &target.Latest, &target.Snapshot)
+	if err == sql.ErrNoRows {
+		err = models.ErrNoRecord
+		return 0, err
+	} else if err != nil {
+		return 0, err
+	}
+	if target.LKAS17 != 1 || target.Reversed != 0 || target.Latest != 1 || target.Snapshot != 1 {
+		err = models.ErrReceiptNotReversible
+		return 0, err
+	}
+	cid := target.ContractID
+
+	var receiptTid int64
+	err = tx.QueryRow(queries.TransactionByRemark, cid, fmt.Sprintf("RECEIPT %d [%d]", rid, cid)).Scan(&receiptTid)
+	if err != nil {
+		return 0, err
+	}
+
+	var later int
+	err = tx.QueryRow(queries.LaterContractTransactions, cid, receiptTid).Scan(&later)
+	if err != nil {
+		return 0, err
+	}
+	if later != 0 {
+		err = models.ErrReceiptNotReversible
+		return 0, err
+	}
+
+	var fPayments []models.ReceiptAllocation
+	err = mysequel.QueryToStructs(&fPayments, tx, queries.ReceiptFinancialPayments, rid)
+	if err != nil {
+		return 0, err
+	}
+
+	var mPayments []models.ReceiptAllocation
+	err = mysequel.QueryToStructs(&mPayments, tx, queries.ReceiptMarketedPayments, rid)
+	if err != nil {
+		return 0, err
+	}
+
+	var fCapPaid, fIntPaid, debitsPaid money.Amount
+	for _, p := range fPayments {
+		var query string
+		switch p.PaymentTypeID {
+		case 1:
+			fCapPaid = fCapPaid + p.Amount
+			query = "UPDATE contract_schedule SET capital_paid = capital_paid - ?, installment_paid = installment_paid - ? WHERE id = ?"
+		case 2:
+			fIntPaid = fIntPaid + p.Amount
+			query = "UPDATE contract_schedule SET interest_paid = interest_paid - ?, installment_paid = installment_paid - ? WHERE id = ?"
+		case 3:
+			debitsPaid = debitsPaid + p.Amount
+			query = "UPDATE contract_schedule SET capital_paid = capital_paid - ?, installment_paid = installment_paid - ?, marketed_capital_paid = marketed_capital_paid - ? WHERE id = ?"
+		}
+
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "contract_financial_payment",
+			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
+			Vals:      []interface{}{p.PaymentTypeID, p.ScheduleID, rid, -p.Amount},
+			Tx:        tx,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		if p.PaymentTypeID == 3 {
+			_, err = tx.Exec(query, p.Amount, p.Amount, p.Amount, p.ScheduleID)
+		} else {
+			_, err = tx.Exec(query, p.Amount, p.Amount, p.ScheduleID)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, p := range mPayments {
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "contract_marketed_payment",
+			Columns:   []string{"contract_payment_type_id", "contract_schedule_id", "contract_receipt_id", "amount"},
+			Vals:      []interface{}{p.PaymentTypeID, p.ScheduleID, rid, -p.Amount},
+			Tx:        tx,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		// Debit payments restore the marketed capital with the financial payment
+		switch p.PaymentTypeID {
+		case 1:
+			_, err = tx.Exec("UPDATE contract_schedule SET marketed_capital_paid = marketed_capital_paid - ? WHERE id = ?", p.Amount, p.ScheduleID)
+		case 2:
+			_, err = tx.Exec("UPDATE contract_schedule SET marketed_interest_paid = marketed_interest_paid - ? WHERE id = ?", p.Amount, p.ScheduleID)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var snapshot ContractFinancial
+	err = tx.QueryRow(queries.ReceiptFinancialSnapshot, rid).Scan(&snapshot.RecoveryStatus, &snapshot.Doubtful, &snapshot.CapitalProvisioned)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE contract_financial SET capital_paid = capital_paid - ?, interest_paid = interest_paid - ?, charges_debits_paid = charges_debits_paid - ?, capital_arrears = capital_arrears + ?, interest_arrears = interest_arrears + ?, charges_debits_arrears = charges_debits_arrears + ?, recovery_status_id = ?, doubtful = ?, capital_provisioned = ? WHERE contract_id = ?", fCapPaid, fIntPaid, debitsPaid, fCapPaid, fIntPaid, debitsPaid, snapshot.RecoveryStatus, snapshot.Doubtful, snapshot.CapitalProvisioned, cid)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []models.TransactionEntry
+	err = mysequel.QueryToStructs(&entries, tx, queries.TransactionEntries, receiptTid)
+	if err != nil {
+		return 0, err
+	}
+
+	var notes []models.ReceiptDefaultDebitNote
+	err = mysequel.QueryToStructs(&notes, tx, queries.ReceiptDefaultDebitNotes, rid)
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range notes {
+		// The payments of the receipt to the debit note were offset above,
+		// leaving it unpaid
+		_, err = tx.Exec("UPDATE contract_schedule SET capital = 0, installment = 0, marketed_capital = 0 WHERE id = ?", n.ScheduleID)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec("UPDATE contract_financial SET charges_debits_arrears = charges_debits_arrears - ? WHERE contract_id = ?", n.Amount, cid)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec("UPDATE contract_default SET amount = amount + ? WHERE contract_id = ?", n.Amount, cid)
+		if err != nil {
+			return 0, err
+		}
+
+		var noteTid int64
+		err = tx.QueryRow(queries.TransactionByRemark, cid, fmt.Sprintf("DEBIT NOTE %d [%d]", n.ScheduleID, cid)).Scan(&noteTid)
+		if err != nil {
+			return 0, err
+		}
+		var noteEntries []models.TransactionEntry
+		err = mysequel.QueryToStructs(&noteEntries, tx, queries.TransactionEntries, noteTid)
+		if err != nil {
+			return 0, err
+		}
+		entries = append(entries, noteEntries...)
+	}
+
+	tid, err := mysequel.Insert(mysequel.Table{
+		TableName: "transaction",
+		Columns:   []string{"user_id", "datetime", "posting_date", "contract_id", "remark"},
+		Vals:      []interface{}{userID, time.Now().Format("2006-01-02 15:04:05"), time.Now().Format("2006-01-02"), cid, fmt.Sprintf("RECEIPT REVERSAL %d [%d]", rid, cid)},
+		Tx:        tx,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	journalEntries := []smodels.JournalEntry{}
+	for _, e := range entries {
+		if e.Type == "DR" {
+			journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", e.AccountID), Debit: "", Credit: e.Amount.String()})
+		} else {
+			journalEntries = append(journalEntries, smodels.JournalEntry{Account: fmt.Sprintf("%d", e.AccountID), Debit: e.Amount.String(), Credit: ""})
+		}
+	}
+
+	err = scribe.IssueJournalEntries(tx, tid, journalEntries)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = mysequel.Insert(mysequel.Table{
+		TableName: "contract_receipt_reversal",
+		Columns:   []string{"contract_receipt_id", "user_id", "transaction_id", "datetime", "reason"},
+		Vals:      []interface{}{rid, userID, tid, time.Now().Format("2006-01-02 15:04:05"), reason},
+		Tx:        tx,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	m.ReceiptLogger.Printf("RID %d \t REVERSED TID %d", rid, tid)
+	return tid, nil
+}
@@ -0,0 +1,193 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/loan"
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+	"github.com/ssrdive/mysequel"
+	"github.com/ssrdive/scribe"
+	smodels "github.com/ssrdive/scribe/models"
+)
+
+// Reschedule restructures an LKAS 17 contract. Installments that have not fallen
+// due are closed at the amounts already paid on them and their original amounts
+// are kept in contract_reschedule_schedule. The outstanding capital of the closed
+// installments is rescheduled with loan.Create at the new rate, tenure and method.
+// Installments in arrears are not affected
+func (m *ContractModel) Reschedule(userID, cid int, rate float64, installments, installmentInterval int, method, initiationDate string) (int64, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	var c settlementContract
+	err = tx.QueryRow(queries.SettlementContract, cid).Scan(&c.LKAS17, &c.ContractTypeID, &c.ContractStateID, &c.State)
+	if err == sql.ErrNoRows {
+		err = models.ErrNoRecord
+		return 0, err
+	} else if err != nil {
+		return 0, err
+	}
+	if c.State == SettledState {
+		err = models.ErrContractSettled
+		return 0, err
+	}
+	if c.LKAS17 != 1 {
+		err = models.ErrRescheduleNotAllowed
+		return 0, err
+	}
+
+	var closing []models.RescheduleInstallment
+	err = mysequel.QueryToStructs(&closing, tx, queries.RescheduleInstallments, cid)
+	if err != nil {
+		return 0, err
+	}
+
+	var capital, closedInterest money.Amount
+	for _, inst := range closing {
+		capital += inst.Capital - inst.CapitalPaid
+		closedInterest += inst.Interest - inst.InterestPaid
+	}
+	if capital <= 0 {
+		err = models.ErrRescheduleNotAllowed
+		return 0, err
+	}
+
+	// A restructure may go beyond the terms offered by the product of the
+	// contract, so the new terms are only checked for being well formed
+	marketedSchedule, financialSchedule, err := m.createSchedule(loan.Product{Method: loan.Method(method)}, loan.Terms{
+		Capital:             capital.Float64(),
+		Rate:                rate,
+		Installments:        installments,
+		InstallmentInterval: installmentInterval,
+		InitiationDate:      initiationDate,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(financialSchedule) == 0 || financialSchedule[0].MonthlyDate == "" {
+		err = models.ErrUnsupportedMethod
+		return 0, err
+	}
+
+	// Carry rounding differences to the last installment so that the new
+	// schedule settles exactly the rescheduled capital
+	var scheduledCapital, scheduledMarketedCapital money.Amount
+	lastMarketed := 0
+	for i, inst := range financialSchedule {
+		scheduledCapital += inst.Capital
+		if inst.MarketedInstallment == 1 {
+			scheduledMarketedCapital += inst.MarketedCapital
+			lastMarketed = i
+		}
+	}
+	financialSchedule[len(financialSchedule)-1].Capital += capital - scheduledCapital
+	financialSchedule[lastMarketed].MarketedCapital += capital - scheduledMarketedCapital
+
+	interest := money.Amount(0)
+	for _, inst := range financialSchedule {
+		interest += inst.Interest
+	}
+
+	tid, err := mysequel.Insert(mysequel.Table{
+		TableName: "transaction",
+		Columns:   []string{"user_id", "datetime", "posting_date", "contract_id", "remark"},
+		Vals:      []interface{}{userID, time.Now().Format("2006-01-02 15:04:05"), time.Now().Format("2006-01-02"), cid, fmt.Sprintf("RESCHEDULE [%d]", cid)},
+		Tx:        tx,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rsid, err := mysequel.Insert(mysequel.Table{
+		TableName: "contract_reschedule",
+		Columns:   []string{"contract_id", "user_id", "transaction_id", "datetime", "capital", "closed_interest", "interest", "rate", "installments", "installment_interval", "method", "initiation_date"},
+		Vals:      []interface{}{cid, userID, tid, time.Now().Format("2006-01-02 15:04:05"), capital, closedInterest, interest, rate, installments, installmentInterval, method, initiationDate},
+		Tx:        tx,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, inst := range closing {
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "contract_reschedule_schedule",
+			Columns:   []string{"contract_reschedule_id", "contract_schedule_id", "capital", "interest", "installment", "marketed_capital", "marketed_interest"},
+			Vals:      []interface{}{rsid, inst.ID, inst.Capital, inst.Interest, inst.Installment, inst.MarketedCapital, inst.MarketedInterest},
+			Tx:        tx,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec("UPDATE contract_schedule SET capital = capital_paid, interest = interest_paid, installment = installment_paid, marketed_capital = marketed_capital_paid, marketed_interest = marketed_interest_paid WHERE id = ?", inst.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Installments that fell due or were paid before the reschedule stay on
+	// the contract and count towards its payments with the new schedule
+	var payments int
+	err = tx.QueryRow(queries.RescheduleKeptPayments, cid).Scan(&payments)
+	if err != nil {
+		return 0, err
+	}
+	payments += len(marketedSchedule)
+
+	var citid int
+	err = tx.QueryRow(queries.INSTALLMENT_INSTALLMENT_TYPE_ID).Scan(&citid)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, inst := range financialSchedule {
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "contract_schedule",
+			Columns:   []string{"contract_id", "contract_installment_type_id", "capital", "interest", "installment", "monthly_date", "marketed_installment", "marketed_capital", "marketed_interest", "marketed_due_date"},
+			Vals:      []interface{}{cid, citid, inst.Capital, inst.Interest, inst.Capital + inst.Interest, inst.MonthlyDate, inst.MarketedInstallment, inst.MarketedCapital, inst.MarketedInterest, inst.MarketedDueDate},
+			Tx:        tx,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE contract_financial SET payment = ?, agreed_interest = agreed_interest - ? + ?, financial_schedule_end_date = ?, marketed_schedule_end_date = ?, payment_interval = ?, payments = ? WHERE contract_id = ?", financialSchedule[0].Capital+financialSchedule[0].Interest, closedInterest, interest, financialSchedule[len(financialSchedule)-1].MonthlyDate, marketedSchedule[len(marketedSchedule)-1].DueDate, installmentInterval, payments, cid)
+	if err != nil {
+		return 0, err
+	}
+
+	// Unearned interest of the closed installments is reversed and
+	// the interest of the new schedule is recognised as unearned
+	journalEntries := []smodels.JournalEntry{}
+	if closedInterest > 0 {
+		journalEntries = append(journalEntries,
+			smodels.JournalEntry{Account: fmt.Sprintf("%d", UnearnedInterestAccount), Debit: closedInterest.String(), Credit: ""},
+			smodels.JournalEntry{Account: fmt.Sprintf("%d", ReceivableAccount), Debit: "", Credit: closedInterest.String()})
+	}
+	if interest > 0 {
+		journalEntries = append(journalEntries,
+			smodels.JournalEntry{Account: fmt.Sprintf("%d", ReceivableAccount), Debit: interest.String(), Credit: ""},
+			smodels.JournalEntry{Account: fmt.Sprintf("%d", UnearnedInterestAccount), Debit: "", Credit: interest.String()})
+	}
+
+	err = scribe.IssueJournalEntries(tx, tid, journalEntries)
+	if err != nil {
+		return 0, err
+	}
+
+	return rsid, nil
+}
@@ -0,0 +1,196 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+	"github.com/ssrdive/mysequel"
+)
+
+// SettledState is the state a contract moves to once fully settled
+const SettledState = "Settled"
+
+// settlementContract holds the contract details needed to settle
+type settlementContract struct {
+	LKAS17          int
+	ContractTypeID  int
+	ContractStateID int
+	State           string
+}
+
+// SettlementQuote returns the amount required to settle a contract on the given
+// date. Interest on installments falling due after the date is rebated
+func (m *ContractModel) SettlementQuote(cid int, date string) (models.SettlementQuote, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return models.SettlementQuote{}, err
+	}
+	defer tx.Rollback()
+
+	quote, _, err := settlementQuote(tx, cid, date)
+	return quote, err
+}
+
+// Settle closes a contract by issuing the settlement rebate and a receipt for the
+// quoted settlement amount within one transaction and moving the contract to the
+// settled state. The amount must match the quotation for the current date
+func (m *ContractModel) Settle(userID, cid int, amount money.Amount) (models.Settlement, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return models.Settlement{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	quote, c, err := settlementQuote(tx, cid, time.Now().Format("2006-01-02"))
+	if err != nil {
+		return models.Settlement{}, err
+	}
+	if c.State == SettledState {
+		err = models.ErrContractSettled
+		return models.Settlement{}, err
+	}
+	if amount != quote.SettlementAmount {
+		err = models.ErrSettlementChanged
+		return models.Settlement{}, err
+	}
+
+	var settlement models.Settlement
+	if quote.Rebate > 0 {
+		if quote.LKAS17 {
+			settlement.RebateID, err = m.lkas17Rebate(tx, userID, cid, quote.Rebate)
+		} else {
+			settlement.RebateID, err = m.legacyRebate(tx, userID, cid, quote.Rebate)
+		}
+		if err != nil {
+			return models.Settlement{}, err
+		}
+	}
+
+	if amount > 0 {
+		var float bool
+		settlement.ReceiptID, float, err = m.receipt(tx, userID, cid, quote.LKAS17, amount, "SETTLEMENT", "")
+		if err != nil {
+			return models.Settlement{}, err
+		}
+		if float {
+			err = models.ErrPaymentExceedsPayables
+			return models.Settlement{}, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE contract_financial SET active = 0 WHERE contract_id = ?", cid)
+	if err != nil {
+		return models.Settlement{}, err
+	}
+
+	var ssid int
+	err = tx.QueryRow(queries.STATE_ID_FROM_STATE, SettledState, c.ContractTypeID).Scan(&ssid)
+	if err != nil {
+		return models.Settlement{}, err
+	}
+
+	sid, err := mysequel.Insert(mysequel.Table{
+		TableName: "contract_state",
+		Columns:   []string{"contract_id", "state_id"},
+		Vals:      []interface{}{cid, ssid},
+		Tx:        tx,
+	})
+	if err != nil {
+		return models.Settlement{}, err
+	}
+
+	_, err = mysequel.Insert(mysequel.Table{
+		TableName: "contract_state_transition",
+		Columns:   []string{"from_contract_state_id", "to_contract_state_id", "transition_date"},
+		Vals:      []interface{}{c.ContractStateID, sid, time.Now().Format("2006-01-02 15:04:05")},
+		Tx:        tx,
+	})
+	if err != nil {
+		return models.Settlement{}, err
+	}
+
+	_, err = tx.Exec("UPDATE contract SET contract_state_id = ? WHERE id = ?", sid, cid)
+	if err != nil {
+		return models.Settlement{}, err
+	}
+
+	m.ReceiptLogger.Printf("SETTLEMENT CID %d \t RID %d \t REBATE RID %d", cid, settlement.ReceiptID, settlement.RebateID)
+	return settlement, nil
+}
+
+// settlementInstallment holds the amounts outstanding on an installment of a
+// contract that is not compliant with LKAS 17
+type settlementInstallment struct {
+	Chargeable      int
+	DueDate         string
+	Capital         money.Amount
+	Interest        money.Amount
+	DefaultInterest money.Amount
+}
+
+// legacySettlement totals the installments of a contract that is not compliant
+// with LKAS 17 into a quote. Default interest on installments is left out as
+// legacy receipts do not collect it, so a receipt for the quote never exceeds
+// the contract payables
+func legacySettlement(quote *models.SettlementQuote, installments []settlementInstallment) {
+	for _, i := range installments {
+		if i.Chargeable == 0 {
+			quote.ChargesDebits += i.Capital + i.Interest
+			continue
+		}
+		quote.CapitalOutstanding += i.Capital
+		if i.DueDate <= quote.SettlementDate {
+			quote.CapitalArrears += i.Capital
+			quote.InterestArrears += i.Interest
+		} else {
+			quote.UnearnedInterest += i.Interest
+		}
+	}
+}
+
+// settlementQuote computes the settlement of a contract within the given transaction
+func settlementQuote(tx *sql.Tx, cid int, date string) (models.SettlementQuote, settlementContract, error) {
+	quote := models.SettlementQuote{ContractID: cid, SettlementDate: date}
+
+	var c settlementContract
+	err := tx.QueryRow(queries.SettlementContract, cid).Scan(&c.LKAS17, &c.ContractTypeID, &c.ContractStateID, &c.State)
+	if err == sql.ErrNoRows {
+		return quote, c, models.ErrNoRecord
+	} else if err != nil {
+		return quote, c, err
+	}
+	quote.LKAS17 = c.LKAS17 == 1
+
+	if quote.LKAS17 {
+		err = tx.QueryRow(queries.SettlementQuoteLKAS17, date, date, date, cid).Scan(&quote.CapitalOutstanding, &quote.CapitalArrears, &quote.InterestArrears, &quote.ChargesDebits, &quote.DefaultInterest, &quote.UnearnedInterest)
+	} else {
+		var installments []settlementInstallment
+		err = mysequel.QueryToStructs(&installments, tx, queries.SettlementInstallmentsLegacy, cid)
+		legacySettlement(&quote, installments)
+	}
+	if err != nil {
+		return quote, c, err
+	}
+
+	// Default charges not yet posted are added as a debit note by the receipt
+	var pendingDefault money.Amount
+	err = tx.QueryRow(queries.SettlementPendingDefault, cid).Scan(&pendingDefault)
+	if err != nil {
+		return quote, c, err
+	}
+	quote.DefaultInterest = quote.DefaultInterest + pendingDefault
+
+	quote.Rebate = quote.UnearnedInterest
+	quote.SettlementAmount = quote.CapitalOutstanding + quote.InterestArrears + quote.ChargesDebits + quote.DefaultInterest
+
+	return quote, c, nil
+}
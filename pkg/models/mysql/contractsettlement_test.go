@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/allocation"
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+func TestLegacySettlement(t *testing.T) {
+	installments := []settlementInstallment{
+		{Chargeable: 1, DueDate: "2026-01-15", Capital: 400000, Interest: 100000, DefaultInterest: 12500},
+		{Chargeable: 1, DueDate: "2026-02-15", Capital: 410000, Interest: 90000, DefaultInterest: 4000},
+		{Chargeable: 1, DueDate: "2026-03-15", Capital: 420000, Interest: 80000},
+		{Chargeable: 1, DueDate: "2026-04-15", Capital: 430000, Interest: 70000},
+		{Chargeable: 0, DueDate: "2026-02-01", Capital: 25000},
+	}
+
+	quote := models.SettlementQuote{SettlementDate: "2026-02-15"}
+	legacySettlement(&quote, installments)
+
+	want := models.SettlementQuote{
+		SettlementDate:     "2026-02-15",
+		CapitalOutstanding: 1660000,
+		CapitalArrears:     810000,
+		InterestArrears:    190000,
+		ChargesDebits:      25000,
+		UnearnedInterest:   150000,
+	}
+	if quote != want {
+		t.Errorf("quote = %+v, want %+v", quote, want)
+	}
+
+	// The receipt for the quote allocates debits, interest left after the
+	// rebate and capital. Default interest on installments is not collected,
+	// so a quote including it would leave a balance and fail the settlement
+	amount := quote.CapitalOutstanding + quote.InterestArrears + quote.ChargesDebits + quote.DefaultInterest
+	payables := []allocation.Payable{}
+	for i, inst := range installments {
+		p := allocation.Payable{ID: i, Capital: inst.Capital, Interest: inst.Interest}
+		if inst.Chargeable == 0 {
+			p = allocation.Payable{ID: i, Debit: inst.Capital + inst.Interest}
+		} else if inst.DueDate > quote.SettlementDate {
+			p.Interest = 0
+		}
+		payables = append(payables, p)
+	}
+
+	if _, balance := allocation.Allocate(amount, payables, allocation.Waterfall); balance != 0 {
+		t.Errorf("balance = %v, want 0", balance)
+	}
+	if _, balance := allocation.Allocate(amount+money.Amount(16500), payables, allocation.Waterfall); balance != 16500 {
+		t.Errorf("balance with default interest = %v, want 16500", balance)
+	}
+}
@@ -3,92 +3,234 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ssrdive/cidium/pkg/models"
 )
 
-// ModelModel struct holds methods to query user table
+// dropdownSource describes a table that may be listed as a dropdown
+type dropdownSource struct {
+	Table string
+	ID    string
+	Name  string
+	// Account is the account number column of chart of accounts tables
+	Account string
+	// Filters are the columns dropdowns of the table may be filtered by
+	Filters []string
+}
+
+// dropdownSources holds the tables that may be listed as dropdowns by name.
+// Only the tables and columns registered here reach SQL
+var dropdownSources = map[string]dropdownSource{
+	"user":                      {Table: "user", ID: "id", Name: "name", Filters: []string{"group_id", "type"}},
+	"model":                     {Table: "model", ID: "id", Name: "name"},
+	"contract_type":             {Table: "contract_type", ID: "id", Name: "name"},
+	"contract_batch":            {Table: "contract_batch", ID: "id", Name: "name", Filters: []string{"contract_type_id"}},
+	"contract_installment_type": {Table: "contract_installment_type", ID: "id", Name: "name"},
+	"institute":                 {Table: "institute", ID: "id", Name: "name"},
+	"institute_dealer":          {Table: "institute_dealer", ID: "id", Name: "name", Filters: []string{"institute_id"}},
+	"state":                     {Table: "state", ID: "id", Name: "name", Filters: []string{"contract_type_id"}},
+	"question":                  {Table: "question", ID: "id", Name: "name"},
+	"document":                  {Table: "document", ID: "id", Name: "name"},
+	"recovery_status":           {Table: "recovery_status", ID: "id", Name: "name"},
+	"main_account":              {Table: "main_account", ID: "id", Name: "name", Account: "account_id"},
+	"sub_account":               {Table: "sub_account", ID: "id", Name: "name", Account: "account_id", Filters: []string{"main_account_id"}},
+	"account_category":          {Table: "account_category", ID: "id", Name: "name", Account: "account_id", Filters: []string{"sub_account_id"}},
+	"account":                   {Table: "account", ID: "id", Name: "name", Account: "account_id", Filters: []string{"account_category_id"}},
+}
+
+// DropdownCacheSize is the number of dropdowns cached when no size is set
+const DropdownCacheSize = 256
+
+// DropdownModel struct holds methods to query dropdown sources
 type DropdownModel struct {
 	DB *sql.DB
+	// CacheTTL is how long dropdowns are cached. Caching is disabled when zero.
+	// The cache is not invalidated on writes, so changes to dropdown tables
+	// show once the cached lists expire
+	CacheTTL time.Duration
+	// CacheSize caps the number of cached dropdowns, DropdownCacheSize when zero
+	CacheSize int
+
+	mu    sync.Mutex
+	cache map[string]dropdownEntry
 }
 
-func (m *DropdownModel) Get(name string) ([]*models.Dropdown, error) {
-	stmt := fmt.Sprintf(`SELECT id, name FROM %s ORDER BY name ASC`, name)
+type dropdownEntry struct {
+	items   interface{}
+	expires time.Time
+}
 
-	rows, err := m.DB.Query(stmt)
+// Get returns the items of a dropdown
+func (m *DropdownModel) Get(name string, q models.DropdownQuery) ([]*models.Dropdown, error) {
+	items, err := m.list(name, "", "", q, false)
 	if err != nil {
 		return nil, err
 	}
+	return items.([]*models.Dropdown), nil
+}
 
-	defer rows.Close()
+// ConditionGet returns the items of a dropdown filtered by a column
+func (m *DropdownModel) ConditionGet(name, where, value string, q models.DropdownQuery) ([]*models.Dropdown, error) {
+	items, err := m.list(name, where, value, q, false)
+	if err != nil {
+		return nil, err
+	}
+	return items.([]*models.Dropdown), nil
+}
+
+// ConditionAccountsGet returns the items of a chart of accounts dropdown
+// filtered by a column
+func (m *DropdownModel) ConditionAccountsGet(name, where, value string, q models.DropdownQuery) ([]*models.DropdownAccount, error) {
+	items, err := m.list(name, where, value, q, true)
+	if err != nil {
+		return nil, err
+	}
+	return items.([]*models.DropdownAccount), nil
+}
 
-	items := []*models.Dropdown{}
-	for rows.Next() {
-		i := &models.Dropdown{}
+func (m *DropdownModel) list(name, where, value string, q models.DropdownQuery, account bool) (interface{}, error) {
+	src, ok := dropdownSources[name]
+	if !ok || (account && src.Account == "") {
+		return nil, models.ErrNoRecord
+	}
 
-		err = rows.Scan(&i.ID, &i.Name)
-		if err != nil {
-			return nil, err
+	// Searches are not cached as each search term would take an entry
+	key := fmt.Sprintf("%s|%s|%s|%d|%d|%t", name, where, value, q.Limit, q.Offset, account)
+	if q.Search == "" {
+		if items, ok := m.cached(key); ok {
+			return items, nil
 		}
+	}
 
-		items = append(items, i)
+	columns := fmt.Sprintf("%s, %s", src.ID, src.Name)
+	if account {
+		columns = fmt.Sprintf("%s, %s, %s", src.ID, src.Account, src.Name)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+
+	conditions := []string{}
+	args := []interface{}{}
+	if where != "" {
+		if !src.filters(where) {
+			return nil, models.ErrDropdownFilter
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = ?", where))
+		args = append(args, value)
+	}
+	if q.Search != "" {
+		conditions = append(conditions, fmt.Sprintf("%s LIKE ?", src.Name))
+		args = append(args, "%"+q.Search+"%")
 	}
-	return items, nil
-}
 
-func (m *DropdownModel) ConditionAccountsGet(name, where, value string) ([]*models.DropdownAccount, error) {
-	stmt := fmt.Sprintf(`SELECT id, account_id, name FROM %s WHERE %s = %s ORDER BY name ASC`, name, where, value)
+	stmt := fmt.Sprintf("SELECT %s FROM %s", columns, src.Table)
+	if len(conditions) > 0 {
+		stmt += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	stmt += fmt.Sprintf(" ORDER BY %s ASC", src.Name)
+	if q.Limit > 0 {
+		stmt += " LIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Offset)
+	}
 
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	items := []*models.DropdownAccount{}
-	for rows.Next() {
-		i := &models.DropdownAccount{}
+	var items interface{}
+	if account {
+		accounts := []*models.DropdownAccount{}
+		for rows.Next() {
+			i := &models.DropdownAccount{}
 
-		err = rows.Scan(&i.ID, &i.AccountID, &i.Name)
-		if err != nil {
-			return nil, err
-		}
+			err = rows.Scan(&i.ID, &i.AccountID, &i.Name)
+			if err != nil {
+				return nil, err
+			}
 
-		items = append(items, i)
+			accounts = append(accounts, i)
+		}
+		items = accounts
+	} else {
+		dropdown := []*models.Dropdown{}
+		for rows.Next() {
+			i := &models.Dropdown{}
+
+			err = rows.Scan(&i.ID, &i.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			dropdown = append(dropdown, i)
+		}
+		items = dropdown
 	}
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+
+	if q.Search == "" {
+		m.store(key, items)
+	}
 	return items, nil
 }
 
-func (m *DropdownModel) ConditionGet(name, where, value string) ([]*models.Dropdown, error) {
-	stmt := fmt.Sprintf(`SELECT id, name FROM %s WHERE %s = %s ORDER BY name ASC`, name, where, value)
+func (m *DropdownModel) cached(key string) (interface{}, bool) {
+	if m.CacheTTL <= 0 {
+		return nil, false
+	}
 
-	rows, err := m.DB.Query(stmt)
-	if err != nil {
-		return nil, err
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.cache[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
 	}
+	return e.items, true
+}
 
-	defer rows.Close()
+func (m *DropdownModel) store(key string, items interface{}) {
+	if m.CacheTTL <= 0 {
+		return
+	}
 
-	items := []*models.Dropdown{}
-	for rows.Next() {
-		i := &models.Dropdown{}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		err = rows.Scan(&i.ID, &i.Name)
-		if err != nil {
-			return nil, err
-		}
+	if m.cache == nil {
+		m.cache = map[string]dropdownEntry{}
+	}
 
-		items = append(items, i)
+	size := m.CacheSize
+	if size <= 0 {
+		size = DropdownCacheSize
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+
+	now := time.Now()
+	oldest := ""
+	for k, e := range m.cache {
+		if now.After(e.expires) {
+			delete(m.cache, k)
+		} else if oldest == "" || e.expires.Before(m.cache[oldest].expires) {
+			oldest = k
+		}
 	}
-	return items, nil
+	if _, ok := m.cache[key]; !ok && len(m.cache) >= size {
+		delete(m.cache, oldest)
+	}
+	m.cache[key] = dropdownEntry{items: items, expires: now.Add(m.CacheTTL)}
+}
+
+func (s dropdownSource) filters(column string) bool {
+	for _, f := range s.Filters {
+		if f == column {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,103 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+)
+
+func dropdownDB(query string, args []driver.Value) fakeResult {
+	return fakeResult{Columns: []string{"id", "name"}, Rows: [][]driver.Value{{int64(1), "Tractor"}, {int64(2), "Trailer"}}}
+}
+
+func TestDropdownCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		size    int
+		queries []models.DropdownQuery
+		// run is the number of queries reaching the database
+		run    int
+		cached int
+	}{
+		{
+			name:    "caching disabled",
+			queries: []models.DropdownQuery{{}, {}},
+			run:     2,
+		},
+		{
+			name:    "repeated list",
+			ttl:     time.Minute,
+			queries: []models.DropdownQuery{{}, {}, {}},
+			run:     1,
+			cached:  1,
+		},
+		{
+			name:    "searches are not cached",
+			ttl:     time.Minute,
+			queries: []models.DropdownQuery{{Search: "Tra"}, {Search: "Tra"}, {Search: "Trac"}},
+			run:     3,
+		},
+		{
+			name:    "pages are cached apart",
+			ttl:     time.Minute,
+			queries: []models.DropdownQuery{{Limit: 10}, {Limit: 10, Offset: 10}, {Limit: 10}},
+			run:     2,
+			cached:  2,
+		},
+		{
+			name:    "size caps the cache",
+			ttl:     time.Minute,
+			size:    2,
+			queries: []models.DropdownQuery{{Limit: 10}, {Limit: 10, Offset: 10}, {Limit: 10, Offset: 20}, {Limit: 10, Offset: 20}},
+			run:     3,
+			cached:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := openFakeDB(t, dropdownDB)
+			m := &DropdownModel{DB: db, CacheTTL: tt.ttl, CacheSize: tt.size}
+
+			for _, q := range tt.queries {
+				items, err := m.Get("model", q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(items) != 2 || items[0].Name != "Tractor" {
+					t.Fatalf("items = %v, want Tractor and Trailer", items)
+				}
+			}
+
+			if got := len(f.Executed("SELECT")); got != tt.run {
+				t.Errorf("queries = %d, want %d", got, tt.run)
+			}
+			if got := len(m.cache); got != tt.cached {
+				t.Errorf("cached = %d, want %d", got, tt.cached)
+			}
+		})
+	}
+}
+
+func TestDropdownCacheExpiry(t *testing.T) {
+	db, f := openFakeDB(t, dropdownDB)
+	m := &DropdownModel{DB: db, CacheTTL: time.Minute}
+
+	if _, err := m.Get("model", models.DropdownQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	for k, e := range m.cache {
+		e.expires = time.Now().Add(-time.Second)
+		m.cache[k] = e
+	}
+	if _, err := m.Get("model", models.DropdownQuery{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(f.Executed("SELECT")); got != 2 {
+		t.Errorf("queries = %d, want 2 after the cached list expired", got)
+	}
+}
@@ -0,0 +1,282 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+	"github.com/ssrdive/mysequel"
+	"github.com/ssrdive/sprinter"
+)
+
+// Day-end run statuses
+const (
+	EODPending   = "PENDING"
+	EODRunning   = "RUNNING"
+	EODCompleted = "COMPLETED"
+	EODFailed    = "FAILED"
+)
+
+// EODModel struct holds database instance and day-end settings
+type EODModel struct {
+	DB *sql.DB
+	// DefaultRate is the annual default interest rate charged on arrears
+	// of LKAS 17 contracts. Default interest is not accrued when zero
+	DefaultRate float64
+}
+
+// Run runs the day-end program for all contracts for a date. Rentals falling due
+// are posted through sprinter, which also ages recovery status and issues the
+// provisioning entries, and default interest is accrued on arrears. Each step is
+// committed with its completion flag so that a failed run can be restarted for
+// the same date without posting twice. Completed runs are returned as they are.
+// A run is claimed before any step so that only one day-end runs for a date;
+// ErrEODRunning is returned while another holds it. A run left running by a
+// stopped server is released by setting its status to FAILED
+func (m *EODModel) Run(date string) (models.EODRun, error) {
+	_, err := m.DB.Exec("INSERT IGNORE INTO eod_run (run_date, status) VALUES (?, ?)", date, EODPending)
+	if err != nil {
+		return models.EODRun{}, err
+	}
+
+	run, err := m.Get(date)
+	if err != nil || run.Status == EODCompleted {
+		return run, err
+	}
+
+	res, err := m.DB.Exec("UPDATE eod_run SET status = ?, last_error = NULL WHERE id = ? AND status IN (?, ?)", EODRunning, run.ID, EODPending, EODFailed)
+	if err != nil {
+		return run, err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return run, err
+	}
+	if claimed == 0 {
+		run, err = m.Get(date)
+		if err != nil || run.Status == EODCompleted {
+			return run, err
+		}
+		return run, models.ErrEODRunning
+	}
+
+	// Steps completed by an earlier attempt are read after the claim
+	run, err = m.Get(date)
+	if err != nil {
+		return run, err
+	}
+
+	if run.RentalsDone == 0 {
+		err = m.rentals(run.ID, date)
+		if err != nil {
+			return m.failed(date, run.ID, err)
+		}
+	}
+
+	if run.DefaultsDone == 0 {
+		err = m.defaults(run.ID, date)
+		if err != nil {
+			return m.failed(date, run.ID, err)
+		}
+	}
+
+	_, err = m.DB.Exec("UPDATE eod_run SET status = ?, completed_at = NOW() WHERE id = ?", EODCompleted, run.ID)
+	if err != nil {
+		return run, err
+	}
+
+	return m.Get(date)
+}
+
+// Get returns the day-end run of a date
+func (m *EODModel) Get(date string) (models.EODRun, error) {
+	var r models.EODRun
+	err := m.DB.QueryRow(queries.EODRun, date).Scan(&r.ID, &r.RunDate, &r.Status, &r.RentalsPosted, &r.StatusChanges, &r.DefaultsAccrued, &r.DefaultAmount, &r.RentalsDone, &r.DefaultsDone, &r.StartedAt, &r.CompletedAt, &r.LastError)
+	if err == sql.ErrNoRows {
+		return r, models.ErrNoRecord
+	}
+	return r, err
+}
+
+// Runs returns the latest day-end runs
+func (m *EODModel) Runs(limit int) ([]models.EODRun, error) {
+	var runs []models.EODRun
+	err := mysequel.QueryToStructs(&runs, m.DB, queries.EODRuns, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// rentals posts the rentals due on or before the date
+func (m *EODModel) rentals(id int, date string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	updated, _, err := sprinter.Run(date, "", false, tx)
+	if err != nil {
+		return err
+	}
+
+	changes := 0
+	for _, c := range updated {
+		if c.RecoveryStatus != c.UpdatedRecoveryStatus {
+			changes++
+		}
+	}
+
+	_, err = tx.Exec("UPDATE eod_run SET rentals_posted = ?, status_changes = ?, rentals_done = 1 WHERE id = ?", len(updated), changes, id)
+	return err
+}
+
+// defaults accrues default interest on the arrears of each contract for the
+// days up to the date
+func (m *EODModel) defaults(id int, date string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	var previousRun string
+	var arrears []models.DefaultInterestArrears
+	if m.DefaultRate > 0 {
+		err = tx.QueryRow(queries.EODPreviousRun, date).Scan(&previousRun)
+		if err != nil {
+			return err
+		}
+
+		err = mysequel.QueryToStructs(&arrears, tx, queries.DefaultInterestArrears, date)
+		if err != nil {
+			return err
+		}
+	}
+
+	accrued := 0
+	total := money.Amount(0)
+	for _, a := range arrears {
+		var days int
+		days, err = accrualDays(date, previousRun, a)
+		if err != nil {
+			return err
+		}
+		amount := defaultInterest(a.Arrears, m.DefaultRate, days)
+		if amount <= 0 {
+			continue
+		}
+
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "contract_default_accrual",
+			Columns:   []string{"eod_run_id", "contract_id", "arrears", "days", "amount"},
+			Vals:      []interface{}{id, a.ContractID, a.Arrears, days, amount},
+			Tx:        tx,
+		})
+		if err != nil {
+			return err
+		}
+
+		var res sql.Result
+		res, err = tx.Exec("UPDATE contract_default SET amount = amount + ? WHERE contract_id = ?", amount, a.ContractID)
+		if err != nil {
+			return err
+		}
+		var n int64
+		n, err = res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			_, err = mysequel.Insert(mysequel.Table{
+				TableName: "contract_default",
+				Columns:   []string{"contract_id", "amount"},
+				Vals:      []interface{}{a.ContractID, amount},
+				Tx:        tx,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		accrued++
+		total += amount
+	}
+
+	_, err = tx.Exec("UPDATE eod_run SET defaults_accrued = ?, default_amount = ?, defaults_done = 1 WHERE id = ?", accrued, total, id)
+	return err
+}
+
+// accrualDays returns the days of default interest a contract accrues on a date,
+// counted from the latest of its last accrual, the previous day-end and the due
+// date of its oldest installment in arrears. Without a previous day-end a single
+// day is accrued, so arrears from before the first day-end are not charged
+func accrualDays(date, previousRun string, a models.DefaultInterestArrears) (int, error) {
+	const layout = "2006-01-02"
+	day, err := time.Parse(layout, date)
+	if err != nil {
+		return 0, err
+	}
+
+	from := day.AddDate(0, 0, -1)
+	for i, d := range []string{previousRun, a.ArrearsSince, a.LastAccrual} {
+		if d == "" {
+			continue
+		}
+		t, err := time.Parse(layout, d)
+		if err != nil {
+			return 0, err
+		}
+		// The previous day-end replaces the single day, later dates narrow it
+		if i == 0 || t.After(from) {
+			from = t
+		}
+	}
+
+	days := int(day.Sub(from).Hours() / 24)
+	if days < 0 {
+		return 0, nil
+	}
+	return days, nil
+}
+
+// defaultInterest returns the default interest on arrears for a number of days
+// at an annual rate
+func defaultInterest(arrears money.Amount, rate float64, days int) money.Amount {
+	return arrears.Mul(rate / 100 / 365 * float64(days))
+}
+
+// failed records the error of a day-end run and returns it
+func (m *EODModel) failed(date string, id int, cause error) (models.EODRun, error) {
+	message := cause.Error()
+	if len(message) > 512 {
+		message = message[:512]
+	}
+
+	_, err := m.DB.Exec("UPDATE eod_run SET status = ?, last_error = ? WHERE id = ?", EODFailed, message, id)
+	if err != nil {
+		return models.EODRun{}, err
+	}
+
+	run, err := m.Get(date)
+	if err != nil {
+		return run, err
+	}
+	return run, cause
+}
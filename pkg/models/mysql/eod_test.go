@@ -0,0 +1,64 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+func TestAccrualDays(t *testing.T) {
+	tests := []struct {
+		name         string
+		date         string
+		previousRun  string
+		arrearsSince string
+		lastAccrual  string
+		days         int
+	}{
+		{"daily run", "2026-03-10", "2026-03-09", "2026-02-15", "2026-03-09", 1},
+		{"first day-end accrues a day", "2026-03-10", "", "2025-06-15", "", 1},
+		{"missed day-ends are caught up", "2026-03-10", "2026-03-06", "2026-02-15", "2026-03-06", 4},
+		{"arrears starting after the previous day-end", "2026-03-10", "2026-03-01", "2026-03-07", "", 3},
+		{"installment falling due on the date", "2026-03-10", "2026-03-09", "2026-03-10", "", 0},
+		{"accrual held for some days", "2026-03-10", "2026-03-09", "2026-01-15", "2026-02-20", 1},
+		{"across a month end", "2026-03-02", "2026-02-26", "2026-01-15", "2026-02-26", 4},
+		{"run for an earlier date", "2026-03-08", "2026-03-07", "2026-01-15", "2026-03-09", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, err := accrualDays(tt.date, tt.previousRun, models.DefaultInterestArrears{ArrearsSince: tt.arrearsSince, LastAccrual: tt.lastAccrual})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if days != tt.days {
+				t.Errorf("days = %d, want %d", days, tt.days)
+			}
+		})
+	}
+
+	if _, err := accrualDays("10/03/2026", "", models.DefaultInterestArrears{}); err == nil {
+		t.Error("accrualDays() error = nil for an invalid date")
+	}
+}
+
+func TestDefaultInterest(t *testing.T) {
+	tests := []struct {
+		arrears money.Amount
+		rate    float64
+		days    int
+		want    money.Amount
+	}{
+		{3650000, 36.5, 1, 3650},
+		{3650000, 36.5, 4, 14600},
+		{3650000, 36.5, 0, 0},
+		{1000000, 24, 1, 658},
+	}
+
+	for _, tt := range tests {
+		if got := defaultInterest(tt.arrears, tt.rate, tt.days); got != tt.want {
+			t.Errorf("defaultInterest(%v, %v, %d) = %v, want %v", tt.arrears, tt.rate, tt.days, got, tt.want)
+		}
+	}
+}
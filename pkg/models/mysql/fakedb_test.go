@@ -0,0 +1,186 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeResult is the answer of a fakeDB handler to a statement
+type fakeResult struct {
+	Columns []string
+	Rows    [][]driver.Value
+	// Unchanged reports that a statement changed no rows
+	Unchanged bool
+	Err       error
+}
+
+// fakeStatement is a statement run against a fakeDB
+type fakeStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// fakeDB is a database/sql driver answering statements from a handler and
+// recording every statement run, and whether transactions were committed
+type fakeDB struct {
+	mu         sync.Mutex
+	handler    func(query string, args []driver.Value) fakeResult
+	Statements []fakeStatement
+	Commits    int
+	Rollbacks  int
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+// openFakeDB opens a database answering statements from handler
+func openFakeDB(t *testing.T, handler func(query string, args []driver.Value) fakeResult) (*sql.DB, *fakeDB) {
+	t.Helper()
+
+	f := &fakeDB{handler: handler}
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = f
+	fakeDBsMu.Unlock()
+
+	db, err := sql.Open("fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDBsMu.Lock()
+		delete(fakeDBs, t.Name())
+		fakeDBsMu.Unlock()
+	})
+	return db, f
+}
+
+// Executed returns the statements starting with prefix
+func (f *fakeDB) Executed(prefix string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var statements []fakeStatement
+	for _, s := range f.Statements {
+		if strings.HasPrefix(s.Query, prefix) {
+			statements = append(statements, s)
+		}
+	}
+	return statements
+}
+
+func (f *fakeDB) run(query string, args []driver.Value) fakeResult {
+	query = strings.Join(strings.Fields(query), " ")
+	f.mu.Lock()
+	f.Statements = append(f.Statements, fakeStatement{Query: query, Args: args})
+	f.mu.Unlock()
+	return f.handler(query, args)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+
+	f, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("fake: no database %q", name)
+	}
+	return &fakeConn{db: f}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return &fakeTx{db: c.db}, nil }
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (t *fakeTx) Commit() error {
+	t.db.mu.Lock()
+	t.db.Commits++
+	t.db.mu.Unlock()
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.db.mu.Lock()
+	t.db.Rollbacks++
+	t.db.mu.Unlock()
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res := s.db.run(s.query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	if res.Unchanged {
+		return driver.RowsAffected(0), nil
+	}
+	return fakeExecResult(len(s.db.Statements)), nil
+}
+
+// fakeExecResult changes a single row, identified by the number of
+// statements run
+type fakeExecResult int64
+
+func (r fakeExecResult) LastInsertId() (int64, error) { return int64(r), nil }
+
+func (r fakeExecResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	res := s.db.run(s.query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &fakeRows{columns: res.Columns, rows: res.Rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,180 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/loan"
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+)
+
+// Questions the terms of a contract are answered in
+const (
+	questionCapital                 = "Capital"
+	questionRate                    = "Interest Rate"
+	questionMethod                  = "Interest Method"
+	questionInstallments            = "Installments"
+	questionInstallmentInterval     = "Installment Interval"
+	questionInitiationDate          = "Initiation Date"
+	questionStructuredMonthlyRental = "Structured Monthly Rental"
+	questionGracePeriods            = "Grace Periods"
+	questionGrace                   = "Grace"
+	questionBalloon                 = "Balloon"
+	questionPlan                    = "Repayment Plan"
+)
+
+// Products returns the loan products of every contract type
+func (m *ContractModel) Products() ([]loan.Product, error) {
+	rows, err := m.DB.Query(queries.LoanProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []loan.Product{}
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+
+	return products, rows.Err()
+}
+
+// Calculate creates and discloses the schedules of terms offered by the
+// product of a contract type. Terms calculated without a contract type are
+// not bounded and are not charged fees
+func (m *ContractModel) Calculate(contractTypeID int, method string, t loan.Terms) (loan.Calculation, error) {
+	product := loan.Product{Method: loan.Method(method)}
+	if contractTypeID != 0 {
+		var err error
+		product, err = loanProduct(m.DB, contractTypeID, method)
+		if err != nil {
+			return loan.Calculation{}, err
+		}
+	}
+
+	marketed, financial, err := m.createSchedule(product, t)
+	if err != nil {
+		return loan.Calculation{}, err
+	}
+
+	return product.Calculate(t, marketed, financial), nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanProduct(row scanner) (loan.Product, error) {
+	var p loan.Product
+	err := row.Scan(&p.ID, &p.ContractTypeID, &p.Name, &p.Method, &p.MinRate, &p.MaxRate, &p.MinInstallments, &p.MaxInstallments, &p.InstallmentInterval, &p.MinCapital, &p.MaxCapital, &p.MaxGracePeriods, &p.DocumentFee, &p.ProcessingFeeRate)
+	return p, err
+}
+
+// loanProduct returns the product of a contract type. Contract types without
+// a product are offered the method answered on the contract without bounds.
+// An answered method must match the method of the product
+func loanProduct(q rowQuerier, contractTypeID int, method string) (loan.Product, error) {
+	p, err := scanProduct(q.QueryRow(queries.LoanProduct, contractTypeID))
+	if errors.Is(err, sql.ErrNoRows) {
+		if !loan.Method(method).Valid() {
+			return loan.Product{}, models.ErrUnsupportedMethod
+		}
+		return loan.Product{ContractTypeID: contractTypeID, Method: loan.Method(method)}, nil
+	} else if err != nil {
+		return loan.Product{}, err
+	}
+
+	if method != "" && loan.Method(method) != p.Method {
+		return loan.Product{}, models.NewFieldError(map[string]string{"method": "must be " + string(p.Method) + " for " + p.Name})
+	}
+	return p, nil
+}
+
+// createSchedule validates the terms against the product and creates their
+// schedules on the skip calendar, reporting terms the product does not
+// offer as field errors
+func (m *ContractModel) createSchedule(p loan.Product, t loan.Terms) ([]loan.Installment, []loan.InstallmentSchedule, error) {
+	t.Calendar = m.Calendar
+	marketed, financial, err := p.Create(t)
+	if err != nil {
+		return nil, nil, scheduleError(err)
+	}
+	return marketed, financial, nil
+}
+
+// scheduleError reports terms a schedule cannot be created for as field
+// errors and an unknown method as unsupported
+func scheduleError(err error) error {
+	var terms loan.TermsError
+	if errors.As(err, &terms) {
+		return models.NewFieldError(terms)
+	} else if errors.Is(err, loan.ErrUnknownMethod) {
+		return models.ErrUnsupportedMethod
+	}
+	return err
+}
+
+// answeredTerms reads the terms of a contract from the answers to its
+// questions, keyed by question name
+func answeredTerms(answers map[string]string) (loan.Terms, error) {
+	var t loan.Terms
+	errs := map[string]string{}
+
+	var err error
+	if t.Capital, err = strconv.ParseFloat(answers[questionCapital], 64); err != nil {
+		errs[questionCapital] = "must be a number"
+	}
+	if t.Rate, err = strconv.ParseFloat(answers[questionRate], 64); err != nil {
+		errs[questionRate] = "must be a number"
+	}
+	if t.Installments, err = strconv.Atoi(answers[questionInstallments]); err != nil {
+		errs[questionInstallments] = "must be a whole number"
+	}
+	if t.InstallmentInterval, err = strconv.Atoi(answers[questionInstallmentInterval]); err != nil {
+		errs[questionInstallmentInterval] = "must be a whole number"
+	}
+	if rental := answers[questionStructuredMonthlyRental]; rental != "" {
+		if t.StructuredMonthlyRental, err = strconv.Atoi(rental); err != nil {
+			errs[questionStructuredMonthlyRental] = "must be a whole number"
+		}
+	}
+	if periods := answers[questionGracePeriods]; periods != "" {
+		if t.GracePeriods, err = strconv.Atoi(periods); err != nil {
+			errs[questionGracePeriods] = "must be a whole number"
+		}
+	}
+	t.Grace = loan.Grace(answers[questionGrace])
+	if balloon := answers[questionBalloon]; balloon != "" {
+		if t.Balloon, err = strconv.ParseFloat(balloon, 64); err != nil {
+			errs[questionBalloon] = "must be a number"
+		}
+	}
+	if plan := answers[questionPlan]; plan != "" {
+		if t.Plan, err = loan.ParsePlan(strings.Split(plan, ",")); err != nil {
+			errs[questionPlan] = "must list installments as YYYY-MM-DD:weight"
+		}
+	}
+
+	date, err := time.Parse("2006-01-02", answers[questionInitiationDate])
+	if err != nil {
+		errs[questionInitiationDate] = "must be a date formatted as YYYY-MM-DD"
+	}
+	t.InitiationDate = date.Format("2006-01-02")
+
+	if len(errs) > 0 {
+		return t, models.NewFieldError(errs)
+	}
+	return t, nil
+}
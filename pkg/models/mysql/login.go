@@ -0,0 +1,162 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Login throttle scopes
+const (
+	LoginScopeUsername = "USERNAME"
+	LoginScopeIP       = "IP"
+)
+
+// LoginModel struct holds database instance and login throttling settings
+type LoginModel struct {
+	DB *sql.DB
+	// MaxFailures is the number of consecutive failures of a username after
+	// which it is locked. MaxIPFailures is the same for a client address
+	MaxFailures   int
+	MaxIPFailures int
+	// Delay is the wait after the first failure. It doubles with each further
+	// failure up to Lockout, which is also how long a lockout lasts
+	Delay   time.Duration
+	Lockout time.Duration
+}
+
+// Attempt starts a login attempt as the username. It returns how long the
+// client must wait if either the username or the client address is
+// throttled. Otherwise the attempt is counted as a failure before the
+// password is verified, so that concurrent attempts cannot pass the throttle
+// together, and Record clears it if the attempt succeeds
+func (m *LoginModel) Attempt(username, ip string) (time.Duration, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	wait, err := m.wait(tx, LoginScopeUsername, username, m.MaxFailures)
+	if err != nil {
+		return 0, err
+	}
+
+	ipWait, err := m.wait(tx, LoginScopeIP, ip, m.MaxIPFailures)
+	if err != nil {
+		return 0, err
+	}
+	if ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	err = m.fail(tx, LoginScopeUsername, username, m.MaxFailures)
+	if err != nil {
+		return 0, err
+	}
+	err = m.fail(tx, LoginScopeIP, ip, m.MaxIPFailures)
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// Record records the outcome of an attempt started with Attempt. A success
+// clears the throttle of the username and takes back the failure counted
+// against the client address
+func (m *LoginModel) Record(username, ip string, userID int, success bool) error {
+	uid := sql.NullInt32{Int32: int32(userID), Valid: userID != 0}
+	_, err := m.DB.Exec("INSERT INTO login_attempt (username, ip, user_id, success) VALUES (?, ?, ?, ?)", username, ip, uid, success)
+	if err != nil || !success {
+		return err
+	}
+
+	_, err = m.DB.Exec("DELETE FROM login_throttle WHERE scope = ? AND subject = ?", LoginScopeUsername, username)
+	if err != nil {
+		return err
+	}
+	return m.release(LoginScopeIP, ip, m.MaxIPFailures)
+}
+
+// Release takes back the failures counted by an attempt that verified the
+// password but was challenged for a second factor
+func (m *LoginModel) Release(username, ip string) error {
+	err := m.release(LoginScopeUsername, username, m.MaxFailures)
+	if err != nil {
+		return err
+	}
+	return m.release(LoginScopeIP, ip, m.MaxIPFailures)
+}
+
+// release takes back a failure counted against a subject, lifting a lockout
+// the failure caused. Columns are assigned in order, so the lockout is
+// compared with the reduced count
+func (m *LoginModel) release(scope, subject string, max int) error {
+	_, err := m.DB.Exec("UPDATE login_throttle SET failures = failures - 1, locked_until = IF(failures < ?, NULL, locked_until) WHERE scope = ? AND subject = ? AND failures > 0", max, scope, subject)
+	return err
+}
+
+// wait locks the throttle of a subject and returns its remaining lockout or
+// delay
+func (m *LoginModel) wait(tx *sql.Tx, scope, subject string, max int) (time.Duration, error) {
+	// A first attempt creates the throttle so that concurrent attempts wait
+	// on its lock
+	_, err := tx.Exec("INSERT IGNORE INTO login_throttle (scope, subject, failures, last_failure) VALUES (?, ?, 0, NOW())", scope, subject)
+	if err != nil {
+		return 0, err
+	}
+
+	var failures, sinceFailure int
+	var lockedFor sql.NullInt64
+	err = tx.QueryRow("SELECT failures, TIMESTAMPDIFF(SECOND, last_failure, NOW()), TIMESTAMPDIFF(SECOND, NOW(), locked_until) FROM login_throttle WHERE scope = ? AND subject = ? FOR UPDATE", scope, subject).Scan(&failures, &sinceFailure, &lockedFor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if lockedFor.Valid && lockedFor.Int64 > 0 {
+		return time.Duration(lockedFor.Int64) * time.Second, nil
+	}
+	if failures == 0 || failures >= max {
+		return 0, nil
+	}
+
+	delay := m.Delay
+	for i := 1; i < failures && delay < m.Lockout; i++ {
+		delay *= 2
+	}
+	if delay > m.Lockout {
+		delay = m.Lockout
+	}
+
+	wait := delay - time.Duration(sinceFailure)*time.Second
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, nil
+}
+
+// fail counts a failure against a subject and locks it once max is reached.
+// Failures older than the lockout period are forgotten
+func (m *LoginModel) fail(tx *sql.Tx, scope, subject string, max int) error {
+	lockout := int(m.Lockout.Seconds())
+	_, err := tx.Exec(`INSERT INTO login_throttle (scope, subject, failures, last_failure) VALUES (?, ?, 1, NOW())
+		ON DUPLICATE KEY UPDATE failures = IF(last_failure < NOW() - INTERVAL ? SECOND OR locked_until IS NOT NULL, 1, failures + 1), locked_until = NULL, last_failure = NOW()`, scope, subject, lockout)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE login_throttle SET locked_until = NOW() + INTERVAL ? SECOND WHERE scope = ? AND subject = ? AND failures >= ?", lockout, scope, subject, max)
+	return err
+}
@@ -0,0 +1,182 @@
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/notify"
+	"github.com/ssrdive/cidium/pkg/sql/queries"
+	"github.com/ssrdive/mysequel"
+)
+
+// Notification outbox statuses
+const (
+	NotificationPending = "PENDING"
+	NotificationSending = "SENDING"
+	NotificationSent    = "SENT"
+	NotificationFailed  = "FAILED"
+)
+
+// NotificationModel struct holds database instance and delivery settings
+type NotificationModel struct {
+	DB       *sql.DB
+	Gateways notify.Gateways
+	// MaxAttempts is the number of deliveries tried before a message is marked failed
+	MaxAttempts int
+	// Backoff is the delay after the first failed delivery. It doubles on each retry
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+}
+
+// enqueueNotification writes a message to the outbox within the caller's transaction
+// so that it is only delivered if the transaction commits
+func enqueueNotification(tx *sql.Tx, cid int, gateway string, recipients []string, message string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	_, err := mysequel.Insert(mysequel.Table{
+		TableName: "notification_outbox",
+		Columns:   []string{"contract_id", "gateway", "recipients", "message"},
+		Vals:      []interface{}{cid, gateway, strings.Join(recipients, ","), message},
+		Tx:        tx,
+	})
+	return err
+}
+
+// notificationLease is how long a claimed message stays hidden from other
+// deliveries. A message whose delivery did not finish within the lease, such
+// as when the server stopped while sending, becomes due again
+const notificationLease = 5 * time.Minute
+
+// outbox claims due messages and records delivery outcomes
+type outbox interface {
+	// claim takes the next due message so that no other delivery sends it.
+	// It returns false when no message is due
+	claim() (models.Notification, bool, error)
+	sent(n models.Notification) error
+	retry(n models.Notification, status, lastError string, delay time.Duration) error
+}
+
+// Deliver sends up to limit pending messages that are due and records the outcome.
+// Each message is claimed before it is sent, so concurrent deliveries never send
+// a message twice. It returns the number of messages sent
+func (m *NotificationModel) Deliver(limit int) (int, error) {
+	return m.deliver(sqlOutbox{m.DB}, limit)
+}
+
+func (m *NotificationModel) deliver(o outbox, limit int) (int, error) {
+	sent := 0
+	for i := 0; i < limit; i++ {
+		n, ok, err := o.claim()
+		if err != nil {
+			return sent, err
+		}
+		if !ok {
+			break
+		}
+
+		gateway, err := m.Gateways.Get(n.Gateway)
+		if err == nil {
+			err = gateway.Send(notify.ParseList(n.Recipients), n.Message)
+		}
+		if err != nil {
+			if err := m.failed(o, n, err); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if err := o.sent(n); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// failed records a failed delivery and schedules the next attempt
+// or marks the message failed once the attempts are exhausted.
+// Attempts already counts the failed delivery
+func (m *NotificationModel) failed(o outbox, n models.Notification, reason error) error {
+	status := NotificationPending
+	if n.Attempts >= m.MaxAttempts {
+		status = NotificationFailed
+	}
+
+	delay := m.Backoff
+	for i := 1; i < n.Attempts && delay < m.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > m.MaxBackoff {
+		delay = m.MaxBackoff
+	}
+
+	lastError := reason.Error()
+	if len(lastError) > 512 {
+		lastError = lastError[:512]
+	}
+
+	return o.retry(n, status, lastError, delay)
+}
+
+// sqlOutbox is the outbox kept in the notification_outbox table
+type sqlOutbox struct {
+	DB *sql.DB
+}
+
+func (o sqlOutbox) claim() (n models.Notification, ok bool, err error) {
+	tx, err := o.DB.Begin()
+	if err != nil {
+		return n, false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// SKIP LOCKED passes over messages another delivery is claiming
+	err = tx.QueryRow(queries.DueNotification).Scan(&n.ID, &n.Gateway, &n.Recipients, &n.Message, &n.Attempts)
+	if err == sql.ErrNoRows {
+		return n, false, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+
+	n.Attempts++
+	_, err = tx.Exec("UPDATE notification_outbox SET status = ?, attempts = ?, next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ?", NotificationSending, n.Attempts, int(notificationLease.Seconds()), n.ID)
+	if err != nil {
+		return n, false, err
+	}
+
+	return n, true, nil
+}
+
+func (o sqlOutbox) sent(n models.Notification) error {
+	_, err := o.DB.Exec("UPDATE notification_outbox SET status = ?, last_error = NULL, sent_at = NOW() WHERE id = ?", NotificationSent, n.ID)
+	return err
+}
+
+func (o sqlOutbox) retry(n models.Notification, status, lastError string, delay time.Duration) error {
+	_, err := o.DB.Exec("UPDATE notification_outbox SET status = ?, last_error = ?, next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ?", status, lastError, int(delay.Seconds()), n.ID)
+	return err
+}
+
+// Contract returns the notifications queued for a contract
+func (m *NotificationModel) Contract(cid int) ([]models.ContractNotification, error) {
+	var res []models.ContractNotification
+	err := mysequel.QueryToStructs(&res, m.DB, queries.ContractNotifications, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,116 @@
+package mysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/notify"
+)
+
+type outcome struct {
+	ID        int
+	Status    string
+	LastError string
+	Delay     time.Duration
+}
+
+// memoryOutbox hands out each message once, as claimed rows are hidden
+// from other deliveries
+type memoryOutbox struct {
+	due      []models.Notification
+	outcomes []outcome
+}
+
+func (o *memoryOutbox) claim() (models.Notification, bool, error) {
+	if len(o.due) == 0 {
+		return models.Notification{}, false, nil
+	}
+	n := o.due[0]
+	o.due = o.due[1:]
+	n.Attempts++
+	return n, true, nil
+}
+
+func (o *memoryOutbox) sent(n models.Notification) error {
+	o.outcomes = append(o.outcomes, outcome{ID: n.ID, Status: NotificationSent})
+	return nil
+}
+
+func (o *memoryOutbox) retry(n models.Notification, status, lastError string, delay time.Duration) error {
+	o.outcomes = append(o.outcomes, outcome{ID: n.ID, Status: status, LastError: lastError, Delay: delay})
+	return nil
+}
+
+func TestDeliver(t *testing.T) {
+	randeepa, agrivest := &notify.Recorder{}, &notify.Recorder{Err: errors.New("gateway down")}
+	m := &NotificationModel{
+		Gateways:    notify.Gateways{Randeepa: randeepa, Agrivest: agrivest},
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxBackoff:  10 * time.Minute,
+	}
+
+	o := &memoryOutbox{due: []models.Notification{
+		{ID: 1, Gateway: notify.GatewayRandeepa, Recipients: "94771234567,94770000001", Message: "Receipt 1"},
+		{ID: 2, Gateway: notify.GatewayAgrivest, Recipients: "94771234567", Message: "Receipt 2"},
+		{ID: 3, Gateway: notify.GatewayAgrivest, Recipients: "94771234567", Message: "Receipt 3", Attempts: 2},
+		{ID: 4, Gateway: notify.GatewayAgrivest, Recipients: "94771234567", Message: "Receipt 4", Attempts: 1},
+		{ID: 5, Gateway: "SMTP", Recipients: "94771234567", Message: "Receipt 5"},
+		{ID: 6, Gateway: notify.GatewayRandeepa, Recipients: "94771234567", Message: "Receipt 6"},
+	}}
+
+	sent, err := m.deliver(o, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Errorf("sent = %d, want 1", sent)
+	}
+
+	want := []notify.Message{{Recipients: []string{"94771234567", "94770000001"}, Message: "Receipt 1"}}
+	if got := randeepa.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %v, want %v", got, want)
+	}
+
+	outcomes := []outcome{
+		{ID: 1, Status: NotificationSent},
+		{ID: 2, Status: NotificationPending, LastError: "gateway down", Delay: time.Minute},
+		{ID: 3, Status: NotificationFailed, LastError: "gateway down", Delay: 4 * time.Minute},
+		{ID: 4, Status: NotificationPending, LastError: "gateway down", Delay: 2 * time.Minute},
+		{ID: 5, Status: NotificationPending, LastError: notify.ErrUnknownGateway.Error(), Delay: time.Minute},
+	}
+	if !reflect.DeepEqual(o.outcomes, outcomes) {
+		t.Errorf("outcomes = %+v, want %+v", o.outcomes, outcomes)
+	}
+	if len(o.due) != 1 {
+		t.Errorf("messages left = %d, want 1 beyond the limit", len(o.due))
+	}
+
+	// A second delivery only sees the message the first left unclaimed
+	if sent, err := m.deliver(o, 5); err != nil || sent != 1 {
+		t.Errorf("second deliver = %d, %v, want 1, nil", sent, err)
+	}
+	if got := len(randeepa.Messages()); got != 2 {
+		t.Errorf("len(messages) = %d, want 2", got)
+	}
+}
+
+func TestDeliverBackoffCap(t *testing.T) {
+	m := &NotificationModel{
+		Gateways:    notify.Gateways{Randeepa: &notify.Recorder{Err: errors.New("gateway down")}},
+		MaxAttempts: 20,
+		Backoff:     time.Minute,
+		MaxBackoff:  10 * time.Minute,
+	}
+
+	o := &memoryOutbox{due: []models.Notification{{ID: 1, Gateway: notify.GatewayRandeepa, Recipients: "94771234567", Attempts: 9}}}
+	if _, err := m.deliver(o, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := o.outcomes[0].Delay; got != 10*time.Minute {
+		t.Errorf("delay = %v, want %v", got, 10*time.Minute)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/ssrdive/mysequel"
 
 	"github.com/ssrdive/cidium/pkg/models"
@@ -13,21 +16,55 @@ import (
 // UserModel struct holds methods to query user table
 type UserModel struct {
 	DB *sql.DB
+	// RefreshTTL is the lifetime of a session refresh token
+	RefreshTTL time.Duration
 }
 
-// Insert method insert a user
-func (m *UserModel) Insert(groupID int, firstName, middleName, lastName, commonName, password string) (int, error) {
-	stmt := `INSERT INTO user (group_id, username, password, name, created_at) VALUES (?, ?, ?, ?, NOW())`
+// Insert method inserts a user on behalf of an admin
+func (m *UserModel) Insert(actorID, groupID int, role, firstName, middleName, lastName, commonName, password string) (int, error) {
+	if len(password) < MinPasswordLength {
+		return 0, models.ErrWeakPassword
+	}
 
 	username := fmt.Sprintf("%s.%s%s", commonName, string([]rune(firstName)[0]), string([]rune(lastName)[0]))
-	name := fmt.Sprintf("%s %s %s", firstName, middleName, lastName)
+	name := strings.Join(strings.Fields(fmt.Sprintf("%s %s %s", firstName, middleName, lastName)), " ")
 
 	ps, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return 0, err
 	}
 
-	result, err := m.DB.Exec(stmt, groupID, username, ps, name)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	// Admins may only create users of roles whose permissions they hold
+	permissions, err := rolePermissions(tx, role)
+	if err != nil {
+		return 0, err
+	}
+	if len(permissions) == 0 {
+		err = models.ErrUnknownRole
+		return 0, err
+	}
+	actor, err := userPermissions(tx, actorID)
+	if err != nil {
+		return 0, err
+	}
+	if !covers(actor, permissions) {
+		err = models.ErrRoleAboveActor
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO user (group_id, username, password, name, type, created_at) VALUES (?, ?, ?, ?, ?, NOW())", groupID, username, ps, name, role)
 	if err != nil {
 		return 0, err
 	}
@@ -37,6 +74,11 @@ func (m *UserModel) Insert(groupID int, firstName, middleName, lastName, commonN
 		return 0, err
 	}
 
+	err = auditUser(tx, actorID, int(id), UserCreated, fmt.Sprintf("%s %s", username, role))
+	if err != nil {
+		return 0, err
+	}
+
 	return int(id), nil
 }
 
@@ -58,13 +100,60 @@ func (m *UserModel) Get(username, password string) (*models.JWTUser, error) {
 		return nil, err
 	}
 
-	var accessLevels []models.AccessLevels
-	err = mysequel.QueryToStructs(&accessLevels, m.DB, "SELECT access_type FROM user_access WHERE user_id = ?", u.ID)
+	return u, m.access(u)
+}
+
+// GetByID method retrieves an enabled user by id
+func (m *UserModel) GetByID(id int) (*models.JWTUser, error) {
+	u := &models.JWTUser{}
+
+	err := m.DB.QueryRow("SELECT id, username, name, type FROM user WHERE id = ? AND disabled = 0", id).Scan(&u.ID, &u.Username, &u.Name, &u.Type)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
 		return nil, err
 	}
 
+	return u, m.access(u)
+}
+
+// access loads the access keys and permissions of a user
+func (m *UserModel) access(u *models.JWTUser) error {
+	var accessLevels []models.AccessLevels
+	err := mysequel.QueryToStructs(&accessLevels, m.DB, "SELECT access_type FROM user_access WHERE user_id = ?", u.ID)
+	if err != nil {
+		return err
+	}
+
 	(*u).AccessKeys = accessLevels
 
-	return u, nil
+	(*u).Permissions, err = m.Permissions(u.Type)
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.QueryRow("SELECT COUNT(*) > 0 FROM user_totp WHERE user_id = ? AND enabled = 1", u.ID).Scan(&u.TOTP)
+	return err
+}
+
+// Permissions returns the permissions granted to a role
+func (m *UserModel) Permissions(role string) ([]string, error) {
+	rows, err := m.DB.Query("SELECT permission FROM role_permission WHERE role = ?", role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var p string
+		err = rows.Scan(&p)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+
+	return permissions, rows.Err()
 }
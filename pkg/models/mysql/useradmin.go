@@ -0,0 +1,368 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/mysequel"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted for a user
+const MinPasswordLength = 8
+
+// User audit actions
+const (
+	UserCreated       = "CREATED"
+	UserDisabled      = "DISABLED"
+	UserEnabled       = "ENABLED"
+	UserPasswordReset = "PASSWORD_RESET"
+	UserPasswordSet   = "PASSWORD_CHANGED"
+	UserAccessKeys    = "ACCESS_KEYS"
+	UserGroup         = "GROUP"
+	UserUnlocked      = "UNLOCKED"
+	UserTOTPEnabled   = "TOTP_ENABLED"
+	UserTOTPDisabled  = "TOTP_DISABLED"
+)
+
+// Users returns all users
+func (m *UserModel) Users() ([]models.UserSummary, error) {
+	var users []models.UserSummary
+	err := mysequel.QueryToStructs(&users, m.DB, "SELECT id, group_id, username, name, type, disabled, created_at FROM user ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetDisabled disables or re-enables a user. Disabling a user revokes all
+// of their sessions
+func (m *UserModel) SetDisabled(actorID, userID int, disabled bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	err = updateUser(tx, actorID, userID, "UPDATE user SET disabled = ? WHERE id = ?", disabled, userID)
+	if err != nil {
+		return err
+	}
+
+	action := UserEnabled
+	if disabled {
+		action = UserDisabled
+		err = revokeSessions(tx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = auditUser(tx, actorID, userID, action, "")
+	return err
+}
+
+// ResetPassword sets the password of a user on behalf of an admin and revokes
+// all of their sessions
+func (m *UserModel) ResetPassword(actorID, userID int, password string) error {
+	if len(password) < MinPasswordLength {
+		return models.ErrWeakPassword
+	}
+
+	ps, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	err = updateUser(tx, actorID, userID, "UPDATE user SET password = ? WHERE id = ?", ps, userID)
+	if err != nil {
+		return err
+	}
+
+	err = revokeSessions(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = auditUser(tx, actorID, userID, UserPasswordReset, "")
+	return err
+}
+
+// ChangePassword changes the password of a user after checking the current
+// one. Sessions other than the current one are revoked
+func (m *UserModel) ChangePassword(userID int, sid int64, current, password string) error {
+	if len(password) < MinPasswordLength {
+		return models.ErrWeakPassword
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	var hash string
+	err = tx.QueryRow("SELECT password FROM user WHERE id = ? AND disabled = 0 FOR UPDATE", userID).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = models.ErrNoRecord
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(current))
+	if err != nil {
+		return err
+	}
+
+	ps, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE user SET password = ? WHERE id = ?", ps, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE user_session SET revoked_at = NOW() WHERE user_id = ? AND id <> ? AND revoked_at IS NULL", userID, sid)
+	if err != nil {
+		return err
+	}
+
+	err = auditUser(tx, userID, userID, UserPasswordSet, "")
+	return err
+}
+
+// SetAccessKeys replaces the access keys of a user
+func (m *UserModel) SetAccessKeys(actorID, userID int, keys []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	err = lockManagedUser(tx, actorID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_access WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "user_access",
+			Columns:   []string{"user_id", "access_type"},
+			Vals:      []interface{}{userID, key},
+			Tx:        tx,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = auditUser(tx, actorID, userID, UserAccessKeys, strings.Join(keys, ","))
+	return err
+}
+
+// SetGroup moves a user to a group
+func (m *UserModel) SetGroup(actorID, userID, groupID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	err = updateUser(tx, actorID, userID, "UPDATE user SET group_id = ? WHERE id = ?", groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = auditUser(tx, actorID, userID, UserGroup, fmt.Sprintf("%d", groupID))
+	return err
+}
+
+// Unlock clears the throttle of a user and optionally of a client address
+func (m *UserModel) Unlock(actorID, userID int, ip string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	err = lockManagedUser(tx, actorID, userID)
+	if err != nil {
+		return err
+	}
+
+	var username string
+	err = tx.QueryRow("SELECT username FROM user WHERE id = ?", userID).Scan(&username)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM login_throttle WHERE (scope = ? AND subject = ?) OR (scope = ? AND subject = ?)", LoginScopeUsername, username, LoginScopeIP, ip)
+	if err != nil {
+		return err
+	}
+
+	err = auditUser(tx, actorID, userID, UserUnlocked, ip)
+	return err
+}
+
+// updateUser locks a user an admin may act on and runs an update on it
+func updateUser(tx *sql.Tx, actorID, userID int, query string, args ...interface{}) error {
+	err := lockManagedUser(tx, actorID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// lockManagedUser locks a user and checks that an admin may act on it.
+// Admins may not act on their own user, nor on users whose role holds a
+// permission the admin does not. ErrNoRecord is returned when the user
+// does not exist
+func lockManagedUser(tx *sql.Tx, actorID, userID int) error {
+	err := lockUser(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if actorID == userID {
+		return models.ErrSelfAdministration
+	}
+
+	actor, err := userPermissions(tx, actorID)
+	if err != nil {
+		return err
+	}
+	target, err := userPermissions(tx, userID)
+	if err != nil {
+		return err
+	}
+	if !covers(actor, target) {
+		return models.ErrRoleAboveActor
+	}
+	return nil
+}
+
+// userPermissions returns the permissions granted to the role of a user
+func userPermissions(tx *sql.Tx, userID int) ([]string, error) {
+	var role string
+	err := tx.QueryRow("SELECT type FROM user WHERE id = ?", userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	return rolePermissions(tx, role)
+}
+
+// rolePermissions returns the permissions granted to a role
+func rolePermissions(tx *sql.Tx, role string) ([]string, error) {
+	rows, err := tx.Query("SELECT permission FROM role_permission WHERE role = ?", role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var p string
+		err = rows.Scan(&p)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// covers reports whether the permissions of an admin include every
+// permission of a user
+func covers(admin, user []string) bool {
+	granted := make(map[string]bool, len(admin))
+	for _, p := range admin {
+		granted[p] = true
+	}
+	for _, p := range user {
+		if !granted[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// lockUser locks a user row for the transaction
+func lockUser(tx *sql.Tx, userID int) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM user WHERE id = ? FOR UPDATE", userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrNoRecord
+	}
+	return err
+}
+
+// auditUser records an action taken on a user
+func auditUser(tx *sql.Tx, actorID, userID int, action, detail string) error {
+	_, err := mysequel.Insert(mysequel.Table{
+		TableName: "user_audit",
+		Columns:   []string{"actor_id", "user_id", "action", "detail"},
+		Vals:      []interface{}{actorID, userID, action, detail},
+		Tx:        tx,
+	})
+	return err
+}
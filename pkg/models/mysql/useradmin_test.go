@@ -0,0 +1,214 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ssrdive/cidium/pkg/models"
+)
+
+// userAdminDB answers the statements of user administration for users
+// 1 (manager), 2 (helpdesk), 3 (cashier) and 4 (accountant)
+func userAdminDB(query string, args []driver.Value) fakeResult {
+	roles := map[int64]string{1: "manager", 2: "helpdesk", 3: "cashier", 4: "accountant"}
+	permissions := map[string][]string{
+		"manager":    {"receipts", "rebates", "reporting", "accounting", "user_admin"},
+		"helpdesk":   {"receipts", "user_admin"},
+		"cashier":    {"receipts"},
+		"accountant": {"accounting", "reporting"},
+	}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT id FROM user WHERE id = ?"):
+		if _, ok := roles[args[0].(int64)]; !ok {
+			return fakeResult{Columns: []string{"id"}}
+		}
+		return fakeResult{Columns: []string{"id"}, Rows: [][]driver.Value{{args[0]}}}
+	case strings.HasPrefix(query, "SELECT type FROM user"):
+		role, ok := roles[args[0].(int64)]
+		if !ok {
+			return fakeResult{Columns: []string{"type"}}
+		}
+		return fakeResult{Columns: []string{"type"}, Rows: [][]driver.Value{{role}}}
+	case strings.HasPrefix(query, "SELECT username FROM user"):
+		return fakeResult{Columns: []string{"username"}, Rows: [][]driver.Value{{"cashier.ab"}}}
+	case strings.HasPrefix(query, "SELECT permission FROM role_permission"):
+		res := fakeResult{Columns: []string{"permission"}}
+		for _, p := range permissions[args[0].(string)] {
+			res.Rows = append(res.Rows, []driver.Value{p})
+		}
+		return res
+	}
+	return fakeResult{}
+}
+
+func TestUserAdminAudit(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(m *UserModel) error
+		err  error
+		// audit holds the actor, user, action and detail recorded as
+		// mysequel passes them. A nil user is the user created
+		audit []driver.Value
+	}{
+		{
+			name:  "disable",
+			run:   func(m *UserModel) error { return m.SetDisabled(1, 3, true) },
+			audit: []driver.Value{"1", "3", UserDisabled, nil},
+		},
+		{
+			name:  "enable",
+			run:   func(m *UserModel) error { return m.SetDisabled(2, 3, false) },
+			audit: []driver.Value{"2", "3", UserEnabled, nil},
+		},
+		{
+			name:  "password reset",
+			run:   func(m *UserModel) error { return m.ResetPassword(2, 3, "long enough") },
+			audit: []driver.Value{"2", "3", UserPasswordReset, nil},
+		},
+		{
+			name:  "access keys",
+			run:   func(m *UserModel) error { return m.SetAccessKeys(1, 4, []string{"reports", "journal"}) },
+			audit: []driver.Value{"1", "4", UserAccessKeys, "reports,journal"},
+		},
+		{
+			name:  "group",
+			run:   func(m *UserModel) error { return m.SetGroup(1, 3, 7) },
+			audit: []driver.Value{"1", "3", UserGroup, "7"},
+		},
+		{
+			name:  "unlock",
+			run:   func(m *UserModel) error { return m.Unlock(2, 3, "10.0.0.8") },
+			audit: []driver.Value{"2", "3", UserUnlocked, "10.0.0.8"},
+		},
+		{
+			name:  "two-factor reset",
+			run:   func(m *UserModel) error { return m.ResetTOTP(2, 3) },
+			audit: []driver.Value{"2", "3", UserTOTPDisabled, nil},
+		},
+		{
+			name:  "two-factor disabled by the user",
+			run:   func(m *UserModel) error { return m.DisableTOTP(2) },
+			audit: []driver.Value{"2", "2", UserTOTPDisabled, nil},
+		},
+		{
+			name: "create a user of a role the admin holds",
+			run: func(m *UserModel) error {
+				_, err := m.Insert(2, 1, "cashier", "Amal", "", "Bandara", "amal", "long enough")
+				return err
+			},
+			audit: []driver.Value{"2", nil, UserCreated, "amal.AB cashier"},
+		},
+		{
+			name: "reset a user with permissions the admin lacks",
+			run:  func(m *UserModel) error { return m.ResetPassword(2, 4, "long enough") },
+			err:  models.ErrRoleAboveActor,
+		},
+		{
+			name: "disable a manager",
+			run:  func(m *UserModel) error { return m.SetDisabled(2, 1, true) },
+			err:  models.ErrRoleAboveActor,
+		},
+		{
+			name: "reset two-factor of a manager",
+			run:  func(m *UserModel) error { return m.ResetTOTP(2, 1) },
+			err:  models.ErrRoleAboveActor,
+		},
+		{
+			name: "create a user above the admin",
+			run: func(m *UserModel) error {
+				_, err := m.Insert(2, 1, "manager", "Amal", "", "Bandara", "amal", "long enough")
+				return err
+			},
+			err: models.ErrRoleAboveActor,
+		},
+		{
+			name: "create a user of an unknown role",
+			run: func(m *UserModel) error {
+				_, err := m.Insert(1, 1, "superuser", "Amal", "", "Bandara", "amal", "long enough")
+				return err
+			},
+			err: models.ErrUnknownRole,
+		},
+		{
+			name: "reset own password",
+			run:  func(m *UserModel) error { return m.ResetPassword(1, 1, "long enough") },
+			err:  models.ErrSelfAdministration,
+		},
+		{
+			name: "change own access keys",
+			run:  func(m *UserModel) error { return m.SetAccessKeys(2, 2, []string{"reports"}) },
+			err:  models.ErrSelfAdministration,
+		},
+		{
+			name: "reset own two-factor",
+			run:  func(m *UserModel) error { return m.ResetTOTP(1, 1) },
+			err:  models.ErrSelfAdministration,
+		},
+		{
+			name: "unknown user",
+			run:  func(m *UserModel) error { return m.SetDisabled(1, 9, true) },
+			err:  models.ErrNoRecord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := openFakeDB(t, userAdminDB)
+			m := &UserModel{DB: db}
+
+			err := tt.run(m)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+
+			audits := f.Executed("INSERT INTO `user_audit`")
+			if tt.err != nil {
+				if len(audits) != 0 {
+					t.Errorf("audit = %v, want none", audits)
+				}
+				if f.Commits != 0 {
+					t.Errorf("commits = %d, want 0", f.Commits)
+				}
+				return
+			}
+
+			if len(audits) != 1 {
+				t.Fatalf("audits = %d, want 1", len(audits))
+			}
+			want := append([]driver.Value{}, tt.audit...)
+			if want[1] == nil {
+				want[1] = strconv.Itoa(len(f.Statements) - 1)
+			}
+			if !reflect.DeepEqual(audits[0].Args, want) {
+				t.Errorf("audit = %#v, want %#v", audits[0].Args, want)
+			}
+			if f.Commits != 1 {
+				t.Errorf("commits = %d, want 1", f.Commits)
+			}
+		})
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		admin, user []string
+		want        bool
+	}{
+		{[]string{"receipts", "user_admin"}, []string{"receipts"}, true},
+		{[]string{"receipts", "user_admin"}, []string{"receipts", "user_admin"}, true},
+		{[]string{"receipts", "user_admin"}, nil, true},
+		{[]string{"receipts", "user_admin"}, []string{"receipts", "rebates"}, false},
+		{nil, []string{"reporting"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := covers(tt.admin, tt.user); got != tt.want {
+			t.Errorf("covers(%v, %v) = %v, want %v", tt.admin, tt.user, got, tt.want)
+		}
+	}
+}
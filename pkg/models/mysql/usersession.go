@@ -0,0 +1,156 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/mysequel"
+)
+
+// CreateSession starts a session for a user and returns the session id and
+// refresh token. Only the hash of the refresh token is stored
+func (m *UserModel) CreateSession(userID int) (int64, string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	sid, refreshToken, err := m.createSession(tx, userID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return sid, refreshToken, nil
+}
+
+// RotateSession exchanges a refresh token for a new session. The session of the
+// token is revoked and replaced. A token that was already rotated is treated as
+// stolen and every session of its user is revoked
+func (m *UserModel) RotateSession(refreshToken string) (int, int64, string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer func() {
+		if err != nil && !errors.Is(err, models.ErrInvalidRefreshToken) {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	var id, userID, disabled int
+	var live bool
+	var revokedAt sql.NullTime
+	var replacedBy sql.NullInt64
+	err = tx.QueryRow("SELECT S.id, S.user_id, S.expires_at > NOW(), S.revoked_at, S.replaced_by, U.disabled FROM user_session S LEFT JOIN user U ON U.id = S.user_id WHERE S.refresh_token = ? FOR UPDATE", hashToken(refreshToken)).Scan(&id, &userID, &live, &revokedAt, &replacedBy, &disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = models.ErrInvalidRefreshToken
+		return 0, 0, "", err
+	} else if err != nil {
+		return 0, 0, "", err
+	}
+
+	if replacedBy.Valid {
+		err = revokeSessions(tx, userID)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		err = models.ErrInvalidRefreshToken
+		return 0, 0, "", err
+	}
+	if revokedAt.Valid || disabled == 1 || !live {
+		err = models.ErrInvalidRefreshToken
+		return 0, 0, "", err
+	}
+
+	sid, newToken, err := m.createSession(tx, userID)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	_, err = tx.Exec("UPDATE user_session SET revoked_at = NOW(), replaced_by = ? WHERE id = ?", sid, id)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	return userID, sid, newToken, nil
+}
+
+// SessionActive reports whether a session is neither revoked nor expired and
+// its user is not disabled
+func (m *UserModel) SessionActive(sid int64) (bool, error) {
+	var active bool
+	err := m.DB.QueryRow("SELECT COUNT(*) > 0 FROM user_session S LEFT JOIN user U ON U.id = S.user_id WHERE S.id = ? AND S.revoked_at IS NULL AND S.expires_at > NOW() AND U.disabled = 0", sid).Scan(&active)
+	return active, err
+}
+
+// RevokeSession revokes a session of a user
+func (m *UserModel) RevokeSession(userID int, sid int64) error {
+	_, err := m.DB.Exec("UPDATE user_session SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL", sid, userID)
+	return err
+}
+
+// RevokeSessions revokes every session of a user
+func (m *UserModel) RevokeSessions(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	err = revokeSessions(tx, userID)
+	return err
+}
+
+func (m *UserModel) createSession(tx *sql.Tx, userID int) (int64, string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return 0, "", err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	sid, err := mysequel.Insert(mysequel.Table{
+		TableName: "user_session",
+		Columns:   []string{"user_id", "refresh_token", "created_at", "expires_at"},
+		Vals:      []interface{}{userID, hashToken(refreshToken), now.Format("2006-01-02 15:04:05"), now.Add(m.RefreshTTL).Format("2006-01-02 15:04:05")},
+		Tx:        tx,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return sid, refreshToken, nil
+}
+
+func revokeSessions(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec("UPDATE user_session SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+	return err
+}
+
+// hashToken returns the stored form of a refresh token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
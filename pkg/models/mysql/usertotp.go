@@ -0,0 +1,235 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/totp"
+	"github.com/ssrdive/mysequel"
+)
+
+// RecoveryCodes is the number of recovery codes issued on TOTP enrolment
+const RecoveryCodes = 10
+
+// totpSkew is the number of time steps of clock drift accepted either way
+const totpSkew = 1
+
+// EnrolTOTP starts TOTP enrolment of a user and returns the new secret. The
+// secret is not enforced until confirmed with EnableTOTP
+func (m *UserModel) EnrolTOTP(userID int) (string, error) {
+	var enabled bool
+	err := m.DB.QueryRow("SELECT enabled FROM user_totp WHERE user_id = ?", userID).Scan(&enabled)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if enabled {
+		return "", models.ErrTOTPEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = m.DB.Exec("INSERT INTO user_totp (user_id, secret, enabled, last_step) VALUES (?, ?, 0, 0) ON DUPLICATE KEY UPDATE secret = VALUES(secret), last_step = 0", userID, secret)
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// EnableTOTP confirms the enrolment of a user with a code from the
+// authenticator and returns a fresh set of recovery codes
+func (m *UserModel) EnableTOTP(userID int, code string) ([]string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	var secret string
+	var enabled bool
+	err = tx.QueryRow("SELECT secret, enabled FROM user_totp WHERE user_id = ? FOR UPDATE", userID).Scan(&secret, &enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = models.ErrNoRecord
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	if enabled {
+		err = models.ErrTOTPEnabled
+		return nil, err
+	}
+
+	step, ok, err := totp.Validate(secret, code, time.Now(), totpSkew)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		err = models.ErrInvalidTOTP
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE user_totp SET enabled = 1, last_step = ?, enabled_at = NOW() WHERE user_id = ?", step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_recovery_code WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodes)
+	for i := range codes {
+		codes[i], err = recoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = mysequel.Insert(mysequel.Table{
+			TableName: "user_recovery_code",
+			Columns:   []string{"user_id", "code"},
+			Vals:      []interface{}{userID, hashToken(normaliseRecoveryCode(codes[i]))},
+			Tx:        tx,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = auditUser(tx, userID, userID, UserTOTPEnabled, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyTOTP checks a code from the authenticator of a user, or one of their
+// unused recovery codes. Authenticator codes cannot be used twice and recovery
+// codes are spent once used
+func (m *UserModel) VerifyTOTP(userID int, code string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	var secret string
+	var lastStep int64
+	err = tx.QueryRow("SELECT secret, last_step FROM user_totp WHERE user_id = ? AND enabled = 1 FOR UPDATE", userID).Scan(&secret, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = models.ErrNoRecord
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	step, ok, err := totp.Validate(secret, code, time.Now(), totpSkew)
+	if err != nil {
+		return err
+	}
+	if ok && step > lastStep {
+		_, err = tx.Exec("UPDATE user_totp SET last_step = ? WHERE user_id = ?", step, userID)
+		return err
+	}
+
+	res, err := tx.Exec("UPDATE user_recovery_code SET used_at = NOW() WHERE user_id = ? AND code = ? AND used_at IS NULL", userID, hashToken(normaliseRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidTOTP
+	}
+
+	return nil
+}
+
+// DisableTOTP removes the TOTP enrolment and recovery codes of a user
+// on their own request
+func (m *UserModel) DisableTOTP(userID int) error {
+	return m.removeTOTP(userID, userID, false)
+}
+
+// ResetTOTP removes the TOTP enrolment and recovery codes of a user on
+// behalf of an admin
+func (m *UserModel) ResetTOTP(actorID, userID int) error {
+	return m.removeTOTP(actorID, userID, true)
+}
+
+// removeTOTP removes a TOTP enrolment. An admin must be allowed to act on
+// the user
+func (m *UserModel) removeTOTP(actorID, userID int, admin bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		_ = tx.Commit()
+	}()
+
+	if admin {
+		err = lockManagedUser(tx, actorID, userID)
+	} else {
+		err = lockUser(tx, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_recovery_code WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	err = auditUser(tx, actorID, userID, UserTOTPDisabled, "")
+	return err
+}
+
+// recoveryCode returns a random recovery code such as abcde-fghij
+func recoveryCode() (string, error) {
+	b := make([]byte, 7)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normaliseRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
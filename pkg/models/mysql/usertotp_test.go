@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/totp"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// totpDB holds the TOTP enrolment of a user and their recovery codes,
+// answering the statements of VerifyTOTP
+type totpDB struct {
+	lastStep int64
+	// unused holds the hashes of unused recovery codes
+	unused map[string]bool
+}
+
+func (d *totpDB) handle(query string, args []driver.Value) fakeResult {
+	switch {
+	case strings.HasPrefix(query, "SELECT secret, last_step FROM user_totp"):
+		return fakeResult{Columns: []string{"secret", "last_step"}, Rows: [][]driver.Value{{testTOTPSecret, d.lastStep}}}
+	case strings.HasPrefix(query, "UPDATE user_totp SET last_step"):
+		d.lastStep = args[0].(int64)
+	case strings.HasPrefix(query, "UPDATE user_recovery_code SET used_at"):
+		hash := args[1].(string)
+		if !d.unused[hash] {
+			return fakeResult{Unchanged: true}
+		}
+		delete(d.unused, hash)
+	}
+	return fakeResult{}
+}
+
+func TestVerifyTOTPReplay(t *testing.T) {
+	d := &totpDB{}
+	db, _ := openFakeDB(t, d.handle)
+	m := &UserModel{DB: db}
+
+	step := totp.Step(time.Now())
+	code, err := totp.Code(testTOTPSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.VerifyTOTP(1, code); err != nil {
+		t.Fatalf("first use error = %v, want nil", err)
+	}
+	if d.lastStep < step {
+		t.Errorf("last step = %d, want at least %d", d.lastStep, step)
+	}
+
+	if err := m.VerifyTOTP(1, code); !errors.Is(err, models.ErrInvalidTOTP) {
+		t.Errorf("replayed code error = %v, want %v", err, models.ErrInvalidTOTP)
+	}
+
+	previous, err := totp.Code(testTOTPSecret, step-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifyTOTP(1, previous); !errors.Is(err, models.ErrInvalidTOTP) {
+		t.Errorf("code older than the last step error = %v, want %v", err, models.ErrInvalidTOTP)
+	}
+}
+
+func TestVerifyTOTPRecoveryCode(t *testing.T) {
+	code, err := recoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Fatalf("recovery code = %q, want the form abcde-fghij", code)
+	}
+
+	d := &totpDB{unused: map[string]bool{hashToken(normaliseRecoveryCode(code)): true}}
+	db, _ := openFakeDB(t, d.handle)
+	m := &UserModel{DB: db}
+
+	// Recovery codes are accepted without the dash and in upper case
+	entered := strings.ToUpper(strings.Replace(code, "-", "", 1))
+	if err := m.VerifyTOTP(1, " "+entered+" "); err != nil {
+		t.Fatalf("first use error = %v, want nil", err)
+	}
+
+	if err := m.VerifyTOTP(1, code); !errors.Is(err, models.ErrInvalidTOTP) {
+		t.Errorf("second use error = %v, want %v", err, models.ErrInvalidTOTP)
+	}
+}
@@ -0,0 +1,144 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAmount is returned when a value cannot be read as an amount
+var ErrInvalidAmount = errors.New("money: invalid amount")
+
+// Amount holds a monetary value in cents
+type Amount int64
+
+// FromFloat converts a float to an amount, rounding to the nearest cent
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * 100))
+}
+
+// Parse reads a decimal amount such as "1250", "1250.5" or "-12.25".
+// Digits beyond the second decimal place are rounded half away from zero
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	units, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		units, fraction = s[:i], s[i+1:]
+	}
+	if units == "" && fraction == "" {
+		return 0, ErrInvalidAmount
+	}
+	if units == "" {
+		units = "0"
+	}
+	for _, r := range units + fraction {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalidAmount
+		}
+	}
+
+	// Leave room for the cents and rounding so the amount cannot overflow
+	u, err := strconv.ParseInt(units, 10, 64)
+	if err != nil || u > (math.MaxInt64-100)/100 {
+		return 0, ErrInvalidAmount
+	}
+
+	round := len(fraction) > 2 && fraction[2] >= '5'
+	fraction = (fraction + "00")[:2]
+	c, _ := strconv.ParseInt(fraction, 10, 64)
+
+	a := Amount(u*100 + c)
+	if round {
+		a++
+	}
+	if negative {
+		a = -a
+	}
+	return a, nil
+}
+
+// Float64 returns the amount as a float
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+// Mul multiplies the amount by a factor, rounding to the nearest cent
+func (a Amount) Mul(f float64) Amount {
+	return FromFloat(a.Float64() * f)
+}
+
+// String formats the amount with two decimal places
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)
+}
+
+// Scan implements sql.Scanner for DECIMAL columns
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case []byte:
+		p, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = p
+	case string:
+		p, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = p
+	case float64:
+		*a = FromFloat(v)
+	case int64:
+		if v > math.MaxInt64/100 || v < math.MinInt64/100 {
+			return ErrInvalidAmount
+		}
+		*a = Amount(v * 100)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// MarshalJSON writes the amount as a JSON number
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads the amount from a JSON number or string
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" {
+		*a = 0
+		return nil
+	}
+	p, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = p
+	return nil
+}
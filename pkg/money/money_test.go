@@ -0,0 +1,173 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Amount
+		err  error
+	}{
+		{"1250", 125000, nil},
+		{"1250.5", 125050, nil},
+		{"1250.50", 125050, nil},
+		{" 1250.05 ", 125005, nil},
+		{".75", 75, nil},
+		{"12.", 1200, nil},
+		{"+12.25", 1225, nil},
+		{"-12.25", -1225, nil},
+		{"0.004", 0, nil},
+		{"0.005", 1, nil},
+		{"12.345", 1235, nil},
+		{"12.3449", 1234, nil},
+		{"-12.345", -1235, nil},
+		{"0.995", 100, nil},
+		{"92233720368547757.00", 9223372036854775700, nil},
+		{"92233720368547758", 0, ErrInvalidAmount},
+		{"9223372036854775807", 0, ErrInvalidAmount},
+		{"99999999999999999999", 0, ErrInvalidAmount},
+		{"1,000.00", 0, ErrInvalidAmount},
+		{"", 0, ErrInvalidAmount},
+		{".", 0, ErrInvalidAmount},
+		{"-", 0, ErrInvalidAmount},
+		{"12.5.0", 0, ErrInvalidAmount},
+		{"1e3", 0, ErrInvalidAmount},
+		{"--1", 0, ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.s)
+		if err != tt.err {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.s, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{125050, "1250.50"},
+		{-1225, "-12.25"},
+		{-5, "-0.05"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		f    float64
+		want Amount
+	}{
+		{100000, 0.24 / 12, 2000},
+		{333, 0.5, 167},
+		{-333, 0.5, -167},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.Mul(tt.f); got != tt.want {
+			t.Errorf("Amount(%d).Mul(%v) = %d, want %d", tt.a, tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want Amount
+		err  bool
+	}{
+		{"nil", nil, 0, false},
+		{"decimal bytes", []byte("1250.50"), 125050, false},
+		{"negative decimal bytes", []byte("-0.75"), -75, false},
+		{"string", "99.99", 9999, false},
+		{"float64", 1250.505, 125051, false},
+		{"float64 representation error", 0.1 + 0.2, 30, false},
+		{"int64", int64(1250), 125000, false},
+		{"negative int64", int64(-3), -300, false},
+		{"int64 overflow", int64(1) << 62, 0, true},
+		{"invalid bytes", []byte("N/A"), 0, true},
+		{"unsupported type", true, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Amount(42)
+			err := a.Scan(tt.src)
+			if (err != nil) != tt.err {
+				t.Fatalf("Scan(%v) error = %v, want error %v", tt.src, err, tt.err)
+			}
+			if err == nil && a != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, a, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type receipt struct {
+		Amount Amount  `json:"amount"`
+		Due    *Amount `json:"due"`
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want Amount
+		out  string
+	}{
+		{"number", `{"amount": 1250.5, "due": null}`, 125050, `{"amount":1250.50,"due":null}`},
+		{"string", `{"amount": "-12.25", "due": null}`, -1225, `{"amount":-12.25,"due":null}`},
+		{"null", `{"amount": null, "due": null}`, 0, `{"amount":0.00,"due":null}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r receipt
+			if err := json.Unmarshal([]byte(tt.in), &r); err != nil {
+				t.Fatal(err)
+			}
+			if r.Amount != tt.want {
+				t.Errorf("amount = %d, want %d", r.Amount, tt.want)
+			}
+
+			b, err := json.Marshal(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.out {
+				t.Errorf("json = %s, want %s", b, tt.out)
+			}
+
+			var back receipt
+			if err := json.Unmarshal(b, &back); err != nil {
+				t.Fatal(err)
+			}
+			if back.Amount != r.Amount {
+				t.Errorf("round trip = %d, want %d", back.Amount, r.Amount)
+			}
+		})
+	}
+
+	var a Amount
+	if err := json.Unmarshal([]byte(`"1,000.00"`), &a); err != ErrInvalidAmount {
+		t.Errorf("Unmarshal(\"1,000.00\") error = %v, want %v", err, ErrInvalidAmount)
+	}
+}
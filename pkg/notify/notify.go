@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier sends a text message to a list of recipients
+type Notifier interface {
+	Send(recipients []string, message string) error
+}
+
+// Gateways holds the notifiers used for each kind of message
+type Gateways struct {
+	// Randeepa sends receipts for contracts not managed by Agrivest
+	Randeepa Notifier
+	// Agrivest sends receipts for contracts managed by Agrivest
+	Agrivest Notifier
+	// Approval sends credit worthiness approvals
+	Approval Notifier
+	// Officer sends special comments to recovery officers
+	Officer Notifier
+}
+
+// Gateway names stored with queued messages
+const (
+	GatewayRandeepa = "RANDEEPA"
+	GatewayAgrivest = "AGRIVEST"
+	GatewayApproval = "APPROVAL"
+	GatewayOfficer  = "OFFICER"
+)
+
+// ErrUnknownGateway is returned when a gateway name is not recognised
+var ErrUnknownGateway = errors.New("notify: unknown gateway")
+
+// Get returns the notifier registered under a gateway name
+func (g Gateways) Get(name string) (Notifier, error) {
+	var n Notifier
+	switch name {
+	case GatewayRandeepa:
+		n = g.Randeepa
+	case GatewayAgrivest:
+		n = g.Agrivest
+	case GatewayApproval:
+		n = g.Approval
+	case GatewayOfficer:
+		n = g.Officer
+	}
+	if n == nil {
+		return nil, ErrUnknownGateway
+	}
+	return n, nil
+}
+
+// Recipients holds the staff numbers copied on notifications
+type Recipients struct {
+	// Receipt is copied on every receipt message
+	Receipt []string
+	// Approval is copied on every credit worthiness approval
+	Approval []string
+	// Redirect, when set, replaces every recipient list.
+	// Used outside production so that customers are not messaged
+	Redirect []string
+}
+
+// For returns the recipient list for a message sent to the
+// given primary recipients and copied to staff
+func (r Recipients) For(primary []string, staff []string) []string {
+	if len(r.Redirect) > 0 {
+		return r.Redirect
+	}
+	to := []string{}
+	for _, p := range primary {
+		if p != "" {
+			to = append(to, p)
+		}
+	}
+	return append(to, staff...)
+}
+
+// ParseList splits a comma separated list of numbers
+func ParseList(list string) []string {
+	numbers := []string{}
+	for _, n := range strings.Split(list, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+func get(requestURL string) error {
+	resp, err := client.Get(requestURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("notify: gateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Dialog sends messages through a Dialog inline SMS API
+type Dialog struct {
+	URL    string
+	APIKey string
+}
+
+// Send sends a message through Dialog
+func (d Dialog) Send(recipients []string, message string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	return get(fmt.Sprintf("%s?destination=%s&q=%s&message=%s", d.URL, strings.Join(recipients, ","), d.APIKey, url.QueryEscape(message)))
+}
+
+// Mobitel sends messages through the Mobitel enterprise SMS API
+type Mobitel struct {
+	URL      string
+	Alias    string
+	User     string
+	Password string
+}
+
+// Send sends a message through Mobitel
+func (m Mobitel) Send(recipients []string, message string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	return get(fmt.Sprintf("%s?m=%s&r=%s&a=%s&u=%s&p=%s&t=0", m.URL, url.QueryEscape(message), strings.Join(recipients, ","), m.Alias, m.User, m.Password))
+}
+
+// Message holds a message captured by Recorder
+type Message struct {
+	Recipients []string
+	Message    string
+}
+
+// Recorder is a Notifier that keeps messages in memory
+// instead of sending them. Used in tests and offline runs
+type Recorder struct {
+	mu   sync.Mutex
+	Sent []Message
+	Err  error
+}
+
+// Send records the message
+func (r *Recorder) Send(recipients []string, message string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Err != nil {
+		return r.Err
+	}
+	r.Sent = append(r.Sent, Message{Recipients: recipients, Message: message})
+	return nil
+}
+
+// Messages returns a copy of the recorded messages
+func (r *Recorder) Messages() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message{}, r.Sent...)
+}
@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRecipientsFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		recipients Recipients
+		primary    []string
+		staff      []string
+		want       []string
+	}{
+		{
+			name:       "primary then staff",
+			recipients: Recipients{Receipt: []string{"94770000001"}},
+			primary:    []string{"94771234567"},
+			staff:      []string{"94770000001"},
+			want:       []string{"94771234567", "94770000001"},
+		},
+		{
+			name:    "blank primary numbers are dropped",
+			primary: []string{"", "94771234567", ""},
+			want:    []string{"94771234567"},
+		},
+		{
+			name:    "no recipients",
+			primary: []string{""},
+			want:    []string{},
+		},
+		{
+			name:       "redirect replaces every recipient",
+			recipients: Recipients{Redirect: []string{"94779999999"}},
+			primary:    []string{"94771234567"},
+			staff:      []string{"94770000001"},
+			want:       []string{"94779999999"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.recipients.For(tt.primary, tt.staff)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("For() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"", []string{}},
+		{"94771234567", []string{"94771234567"}},
+		{" 94771234567 , 94770000001,", []string{"94771234567", "94770000001"}},
+		{",,", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseList(tt.list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseList(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestGatewaysGet(t *testing.T) {
+	randeepa, agrivest, approval := &Recorder{}, &Recorder{}, &Recorder{}
+	gateways := Gateways{Randeepa: randeepa, Agrivest: agrivest, Approval: approval}
+
+	tests := []struct {
+		name string
+		want Notifier
+		err  error
+	}{
+		{GatewayRandeepa, randeepa, nil},
+		{GatewayAgrivest, agrivest, nil},
+		{GatewayApproval, approval, nil},
+		{GatewayOfficer, nil, ErrUnknownGateway},
+		{"SMTP", nil, ErrUnknownGateway},
+	}
+
+	for _, tt := range tests {
+		got, err := gateways.Get(tt.name)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Get(%q) error = %v, want %v", tt.name, err, tt.err)
+		}
+		if got != tt.want {
+			t.Errorf("Get(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := &Recorder{}
+	recipients := Recipients{Redirect: []string{"94779999999"}}
+
+	err := r.Send(recipients.For([]string{"94771234567"}, nil), "Receipt 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Message{{Recipients: []string{"94779999999"}, Message: "Receipt 1"}}
+	if got := r.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Messages() = %v, want %v", got, want)
+	}
+
+	r.Err = errors.New("gateway down")
+	if err := r.Send([]string{"94771234567"}, "Receipt 2"); err != r.Err {
+		t.Errorf("Send() error = %v, want %v", err, r.Err)
+	}
+	if got := len(r.Messages()); got != 1 {
+		t.Errorf("len(Messages()) = %d after a failed send, want 1", got)
+	}
+}
+
+func TestDialogSend(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	}))
+	defer server.Close()
+
+	d := Dialog{URL: server.URL, APIKey: "key"}
+	if err := d.Send([]string{"94771234567", "94770000001"}, "Paid Rs. 1,000"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{"destination": {"94771234567,94770000001"}, "q": {"key"}, "message": {"Paid Rs. 1,000"}}
+	if !reflect.DeepEqual(query, want) {
+		t.Errorf("query = %v, want %v", query, want)
+	}
+}
+
+func TestGatewayError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	m := Mobitel{URL: server.URL}
+	if err := m.Send([]string{"94771234567"}, "Paid"); err == nil {
+		t.Error("Send() error = nil, want gateway error")
+	}
+	if err := m.Send(nil, "Paid"); err != nil {
+		t.Errorf("Send() to no recipients error = %v, want nil", err)
+	}
+}
@@ -1183,6 +1183,13 @@ const (
 		GROUP BY CS.contract_id
 	`
 
+	NplCapitalProvisionAfterPayment = `
+		SELECT ROUND((SUM(CS.capital-CS.capital_paid)-?)/2, 2) AS capital_provision
+		FROM contract_schedule CS
+		WHERE CS.contract_id = ? AND CS.contract_installment_type_id = 1
+		GROUP BY CS.contract_id
+	`
+
 	ContractFinancialRaw = `
 		SELECT id, contract_id, active, recovery_status_id, doubtful, payment, agreed_capital, agreed_interest, capital_paid, interest_paid, charges_debits_paid, capital_arrears, interest_arrears, charges_debits_arrears, capital_provisioned, financial_schedule_start_date, financial_schedule_end_date, marketed_schedule_start_date, marketed_schedule_end_date, payment_interval, payments
 		FROM contract_financial WHERE contract_id = ?
@@ -1212,4 +1219,207 @@ const (
 		FROM contract_receipt_checksum C 
 		WHERE C.checksum = ?
 	`
+
+	DueNotification = `
+		SELECT N.id, N.gateway, N.recipients, N.message, N.attempts
+		FROM notification_outbox N
+		WHERE N.status IN ('PENDING', 'SENDING') AND N.next_attempt_at <= NOW()
+		ORDER BY N.next_attempt_at ASC, N.id ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	ContractNotifications = `
+		SELECT N.id, N.gateway, N.recipients, N.message, N.status, N.attempts, N.last_error, N.created_at, N.next_attempt_at, N.sent_at
+		FROM notification_outbox N
+		WHERE N.contract_id = ?
+		ORDER BY N.id DESC
+	`
+
+	ReceiptReversalTarget = `
+		SELECT CR.contract_id, CR.lkas_17,
+			(SELECT COUNT(*) FROM contract_receipt_reversal CRR WHERE CRR.contract_receipt_id = CR.id) AS reversed,
+			CR.id = (
+				SELECT MAX(L.id) FROM contract_receipt L
+				WHERE L.contract_id = CR.contract_id AND L.id NOT IN (SELECT contract_receipt_id FROM contract_receipt_reversal)
+			) AS latest,
+			(SELECT COUNT(*) FROM contract_receipt_financial CRF WHERE CRF.contract_receipt_id = CR.id) AS snapshot
+		FROM contract_receipt CR
+		WHERE CR.id = ?
+		FOR UPDATE
+	`
+
+	ReceiptFinancialPayments = `
+		SELECT contract_payment_type_id, contract_schedule_id, amount
+		FROM contract_financial_payment
+		WHERE contract_receipt_id = ?
+	`
+
+	ReceiptMarketedPayments = `
+		SELECT contract_payment_type_id, contract_schedule_id, amount
+		FROM contract_marketed_payment
+		WHERE contract_receipt_id = ?
+	`
+
+	ReceiptFinancialSnapshot = `
+		SELECT recovery_status_id, doubtful, capital_provisioned
+		FROM contract_receipt_financial
+		WHERE contract_receipt_id = ?
+	`
+
+	ReceiptDefaultDebitNotes = `
+		SELECT contract_schedule_id, amount
+		FROM contract_receipt_default
+		WHERE contract_receipt_id = ?
+	`
+
+	TransactionByRemark = `
+		SELECT T.id
+		FROM transaction T
+		WHERE T.contract_id = ? AND T.remark = ?
+	`
+
+	LaterContractTransactions = `
+		SELECT COUNT(*)
+		FROM transaction T
+		WHERE T.contract_id = ? AND T.id > ?
+	`
+
+	TransactionEntries = `
+		SELECT AT.account_id, AT.type, AT.amount
+		FROM account_transaction AT
+		WHERE AT.transaction_id = ?
+	`
+
+	RecoveryStatusName = `
+		SELECT name FROM recovery_status WHERE id = ?
+	`
+
+	DebitTypeUnearnedIncomeAccount = `
+		SELECT unearned_account_id, income_account_id FROM contract_installment_type WHERE id = ?
+	`
+
+	ContractExists = `
+		SELECT id FROM contract WHERE id = ?
+	`
+
+	SettlementContract = `
+		SELECT C.lkas_17_compliant, C.contract_type_id, C.contract_state_id, COALESCE(S.name, '') AS state
+		FROM contract C
+		LEFT JOIN contract_state CS ON CS.id = C.contract_state_id
+		LEFT JOIN state S ON S.id = CS.state_id
+		WHERE C.id = ?
+		FOR UPDATE
+	`
+
+	SettlementQuoteLKAS17 = `
+		SELECT COALESCE(SUM(CASE WHEN CS.contract_installment_type_id = 1 THEN CS.capital-CS.capital_paid END), 0) AS capital_outstanding,
+			COALESCE(SUM(CASE WHEN CS.contract_installment_type_id = 1 AND CS.monthly_date <= ? THEN CS.capital-CS.capital_paid END), 0) AS capital_arrears,
+			COALESCE(SUM(CASE WHEN CS.contract_installment_type_id = 1 AND CS.monthly_date <= ? THEN CS.interest-CS.interest_paid END), 0) AS interest_arrears,
+			COALESCE(SUM(CASE WHEN CS.contract_installment_type_id <> 1 THEN CS.capital-CS.capital_paid END), 0) AS charges_debits,
+			0 AS default_interest,
+			COALESCE(SUM(CASE WHEN CS.contract_installment_type_id = 1 AND CS.monthly_date > ? THEN CS.interest-CS.interest_paid END), 0) AS unearned_interest
+		FROM contract_schedule CS
+		WHERE CS.contract_id = ?
+	`
+
+	SettlementInstallmentsLegacy = `
+		SELECT COALESCE(CIT.di_chargable, 0) AS di_chargable, DATE_FORMAT(CI.due_date, '%Y-%m-%d') AS due_date,
+			CI.capital-COALESCE(CCP.amount, 0) AS capital,
+			CI.interest-COALESCE(CIP.amount, 0) AS interest,
+			CI.default_interest-COALESCE(CDIP.amount, 0) AS default_interest
+		FROM contract_installment CI
+		LEFT JOIN (
+			SELECT CIP.contract_installment_id, COALESCE(SUM(amount), 0) AS amount
+			FROM contract_interest_payment CIP
+			GROUP BY CIP.contract_installment_id
+		) CIP ON CIP.contract_installment_id = CI.id
+		LEFT JOIN (
+			SELECT CCP.contract_installment_id, COALESCE(SUM(amount), 0) AS amount
+			FROM contract_capital_payment CCP
+			GROUP BY CCP.contract_installment_id
+		) CCP ON CCP.contract_installment_id = CI.id
+		LEFT JOIN (
+			SELECT CDIP.contract_installment_id, COALESCE(SUM(amount), 0) AS amount
+			FROM contract_default_interest_payment CDIP
+			GROUP BY CDIP.contract_installment_id
+		) CDIP ON CDIP.contract_installment_id = CI.id
+		LEFT JOIN contract_installment_type CIT ON CIT.id = CI.contract_installment_type_id
+		WHERE CI.contract_id = ?
+		ORDER BY CI.due_date ASC, CI.id ASC
+	`
+
+	SettlementPendingDefault = `
+		SELECT COALESCE(SUM(CD.amount), 0) AS amount
+		FROM contract_default CD
+		LEFT JOIN contract C ON C.id = CD.contract_id
+		WHERE CD.contract_id = ? AND C.hold_default = 0
+	`
+
+	RescheduleInstallments = `
+		SELECT CS.id, CS.capital, CS.capital_paid, CS.interest, CS.interest_paid, CS.installment, CS.installment_paid, CS.marketed_capital, CS.marketed_capital_paid, CS.marketed_interest, CS.marketed_interest_paid
+		FROM contract_schedule CS
+		WHERE CS.contract_id = ? AND CS.contract_installment_type_id = 1 AND CS.daily_entry_issued = 0 AND CS.installment - CS.installment_paid > 0
+		ORDER BY CS.monthly_date ASC
+		FOR UPDATE
+	`
+
+	RescheduleKeptPayments = `
+		SELECT COUNT(*)
+		FROM contract_schedule CS
+		WHERE CS.contract_id = ? AND CS.contract_installment_type_id = 1 AND CS.marketed_installment = 1 AND CS.installment > 0
+	`
+
+	EODRun = `
+		SELECT id, DATE_FORMAT(run_date, '%Y-%m-%d') AS run_date, status, rentals_posted, status_changes, defaults_accrued, default_amount, rentals_done, defaults_done, started_at, completed_at, last_error
+		FROM eod_run
+		WHERE run_date = ?
+	`
+
+	EODPreviousRun = `
+		SELECT COALESCE(DATE_FORMAT(MAX(run_date), '%Y-%m-%d'), '')
+		FROM eod_run
+		WHERE run_date < ? AND defaults_done = 1
+	`
+
+	EODRuns = `
+		SELECT id, DATE_FORMAT(run_date, '%Y-%m-%d') AS run_date, status, rentals_posted, status_changes, defaults_accrued, default_amount, rentals_done, defaults_done, started_at, completed_at, last_error
+		FROM eod_run
+		ORDER BY run_date DESC
+		LIMIT ?
+	`
+
+	LoanProducts = `
+		SELECT id, contract_type_id, name, method, min_rate, max_rate, min_installments, max_installments, installment_interval, min_capital, max_capital, max_grace_periods, document_fee, processing_fee_rate
+		FROM loan_product
+		ORDER BY contract_type_id
+	`
+
+	LoanProduct = `
+		SELECT id, contract_type_id, name, method, min_rate, max_rate, min_installments, max_installments, installment_interval, min_capital, max_capital, max_grace_periods, document_fee, processing_fee_rate
+		FROM loan_product
+		WHERE contract_type_id = ?
+	`
+
+	ContractTypeID = `
+		SELECT contract_type_id FROM contract WHERE id = ?
+	`
+
+	DefaultInterestArrears = `
+		SELECT CF.contract_id, CF.capital_arrears + CF.interest_arrears AS arrears,
+			COALESCE((
+				SELECT DATE_FORMAT(MIN(CS.monthly_date), '%Y-%m-%d')
+				FROM contract_schedule CS
+				WHERE CS.contract_id = CF.contract_id AND CS.contract_installment_type_id = 1 AND CS.installment_paid < CS.installment AND CS.monthly_date <= ?
+			), '') AS arrears_since,
+			COALESCE((
+				SELECT DATE_FORMAT(MAX(ER.run_date), '%Y-%m-%d')
+				FROM contract_default_accrual CDA
+				LEFT JOIN eod_run ER ON ER.id = CDA.eod_run_id
+				WHERE CDA.contract_id = CF.contract_id
+			), '') AS last_accrual
+		FROM contract_financial CF
+		LEFT JOIN contract C ON C.id = CF.contract_id
+		WHERE C.lkas_17_compliant = 1 AND C.hold_default = 0 AND CF.capital_arrears + CF.interest_arrears > 0
+	`
 )
@@ -0,0 +1,128 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCode checks the SHA-1 test vectors of RFC 6238 appendix B, truncated
+// to six digits
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("Code(T=%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestCodeSecret(t *testing.T) {
+	code, err := Code(" "+strings.ToLower(rfcSecret)+" ", Step(time.Unix(59, 0)))
+	if err != nil || code != "287082" {
+		t.Errorf("Code() with a lower case secret = %s, %v, want 287082", code, err)
+	}
+
+	if _, err := Code("not base32!", 1); err != ErrInvalidSecret {
+		t.Errorf("Code() error = %v, want %v", err, ErrInvalidSecret)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name string
+		code string
+		skew int
+		step int64
+		ok   bool
+	}{
+		{"current step", "050471", 1, step, true},
+		{"surrounding spaces", " 050471 ", 1, step, true},
+		{"previous step within skew", code(step - 1), 1, step - 1, true},
+		{"next step within skew", code(step + 1), 1, step + 1, true},
+		{"previous step without skew", code(step - 1), 0, 0, false},
+		{"two steps behind", code(step - 2), 1, 0, false},
+		{"wrong code", "123456", 1, 0, false},
+		{"short code", "50471", 1, 0, false},
+		{"eight digit code", "07081804", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := Validate(rfcSecret, tt.code, now, tt.skew)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || got != tt.step {
+				t.Errorf("Validate() = %d, %v, want %d, %v", got, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a) != 32 {
+		t.Errorf("len(secret) = %d, want 32", len(a))
+	}
+	if a == b {
+		t.Error("GenerateSecret() returned the same secret twice")
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("Code() with a generated secret error = %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Cidium", "cashier.ab", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Cidium:cashier.ab" {
+		t.Errorf("URI = %s, want otpauth://totp/Cidium:cashier.ab", u)
+	}
+	want := url.Values{"secret": {rfcSecret}, "issuer": {"Cidium"}, "algorithm": {"SHA1"}, "digits": {"6"}, "period": {"30"}}
+	if got := u.Query(); got.Encode() != want.Encode() {
+		t.Errorf("query = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"github.com/ssrdive/cidium/pkg/loan"
+	"github.com/ssrdive/cidium/pkg/models"
+	"github.com/ssrdive/cidium/pkg/money"
+)
+
+// Request bodies decoded and validated by pkg/forms. The acting user is
+// taken from the token and is never part of a request
+
+type accountCategoryRequest struct {
+	SubAccountID int    `form:"sub_account_id" validate:"required,positive"`
+	AccountID    int    `form:"account_id" validate:"required,positive"`
+	Name         string `form:"name" validate:"required,max=128"`
+	Datetime     string `form:"datetime"`
+}
+
+type accountRequest struct {
+	AccountCategoryID int    `form:"account_category_id" validate:"required,positive"`
+	AccountID         int    `form:"account_id" validate:"required,positive"`
+	Name              string `form:"name" validate:"required,max=128"`
+	Datetime          string `form:"datetime"`
+}
+
+type journalEntryRequest struct {
+	PostingDate string `form:"posting_date" validate:"required,date"`
+	Remark      string `form:"remark" validate:"required"`
+	Entries     string `form:"entries" validate:"required"`
+}
+
+type paymentVoucherRequest struct {
+	PostingDate   string       `form:"posting_date" validate:"required,date"`
+	FromAccountID int          `form:"from_account_id" validate:"required,positive"`
+	Amount        money.Amount `form:"amount" validate:"required,positive"`
+	Entries       string       `form:"entries" validate:"required"`
+	Remark        string       `form:"remark" validate:"required"`
+	DueDate       string       `form:"due_date"`
+	CheckNumber   string       `form:"check_number"`
+	Payee         string       `form:"payee"`
+}
+
+type depositRequest struct {
+	PostingDate string       `form:"posting_date" validate:"required,date"`
+	ToAccountID int          `form:"to_account_id" validate:"required,positive"`
+	Amount      money.Amount `form:"amount" validate:"required,positive"`
+	Entries     string       `form:"entries" validate:"required"`
+	Remark      string       `form:"remark" validate:"required"`
+}
+
+type authenticateRequest struct {
+	Username string `form:"username" validate:"required"`
+	Password string `form:"password" validate:"required"`
+	TOTP     string `form:"totp"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `form:"refresh_token" validate:"required"`
+}
+
+type logoutRequest struct {
+	All bool `form:"all"`
+}
+
+type newUserRequest struct {
+	GroupID    int    `form:"group_id" validate:"required,positive"`
+	Role       string `form:"role" validate:"required,max=32"`
+	FirstName  string `form:"first_name" validate:"required"`
+	MiddleName string `form:"middle_name"`
+	LastName   string `form:"last_name" validate:"required"`
+	CommonName string `form:"common_name" validate:"required"`
+	Password   string `form:"password" validate:"required"`
+}
+
+type userRequest struct {
+	ID int `form:"id" validate:"required,positive"`
+}
+
+type userPasswordResetRequest struct {
+	ID       int    `form:"id" validate:"required,positive"`
+	Password string `form:"password" validate:"required"`
+}
+
+type userPasswordRequest struct {
+	CurrentPassword string `form:"current_password" validate:"required"`
+	Password        string `form:"password" validate:"required"`
+}
+
+type userAccessKeysRequest struct {
+	ID         int      `form:"id" validate:"required,positive"`
+	AccessKeys []string `form:"access_key"`
+}
+
+type userGroupRequest struct {
+	ID      int `form:"id" validate:"required,positive"`
+	GroupID int `form:"group_id" validate:"required,positive"`
+}
+
+type userUnlockRequest struct {
+	ID int    `form:"id" validate:"required,positive"`
+	IP string `form:"ip"`
+}
+
+type totpCodeRequest struct {
+	Code string `form:"code" validate:"required"`
+}
+
+type contractRequest struct {
+	External             int          `form:"external" validate:"required"`
+	IntroducingOfficerID int          `form:"introducing_officer_id" validate:"required,positive"`
+	CreditOfficerID      int          `form:"credit_officer_id" validate:"required,positive"`
+	RecoveryOfficerID    int          `form:"recovery_officer_id" validate:"required,positive"`
+	ContractTypeID       int          `form:"contract_type_id" validate:"required,oneof=1|2|3"`
+	InstituteDealerID    int          `form:"institute_dealer_id" validate:"required,positive"`
+	ContractBatchID      int          `form:"contract_batch_id" validate:"required,positive"`
+	ModelID              int          `form:"model_id" validate:"required,positive"`
+	ChassisNumber        string       `form:"chassis_number" validate:"required"`
+	CustomerNIC          string       `form:"customer_nic" validate:"required"`
+	CustomerName         string       `form:"customer_name" validate:"required"`
+	CustomerAddress      string       `form:"customer_address" validate:"required"`
+	CustomerContact      string       `form:"customer_contact" validate:"required"`
+	Price                money.Amount `form:"price" validate:"required,positive"`
+	InstituteID          int          `form:"institute_id"`
+	LiaisonContact       string       `form:"liaison_contact"`
+	Downpayment          money.Amount `form:"downpayment" validate:"min=0"`
+}
+
+type legacyContractRequest struct {
+	RecoveryOfficerID   int          `form:"recovery_officer_id" validate:"required,positive"`
+	ContractTypeID      int          `form:"contract_type_id" validate:"required,positive"`
+	InstituteDealerID   int          `form:"institute_dealer_id" validate:"required,positive"`
+	ContractBatchID     int          `form:"contract_batch_id" validate:"required,positive"`
+	ModelID             int          `form:"model_id" validate:"required,positive"`
+	ChassisNumber       string       `form:"chassis_number" validate:"required"`
+	CustomerNIC         string       `form:"customer_nic" validate:"required"`
+	CustomerName        string       `form:"customer_name" validate:"required"`
+	CustomerAddress     string       `form:"customer_address" validate:"required"`
+	CustomerContact     string       `form:"customer_contact" validate:"required"`
+	Price               money.Amount `form:"price" validate:"required,positive"`
+	Capital             money.Amount `form:"capital" validate:"required,positive"`
+	Rate                float64      `form:"rate" validate:"required,min=0"`
+	Installments        int          `form:"installments" validate:"required,positive"`
+	InstallmentInterval int          `form:"installment_interval" validate:"required,positive"`
+	Method              string       `form:"method" validate:"required,oneof=S|R|R2|IRR|SM"`
+	InitiationDate      string       `form:"initiation_date" validate:"required,date"`
+	InstituteID         int          `form:"institute_id"`
+	LiaisonContact      string       `form:"liaison_contact"`
+	Downpayment         money.Amount `form:"downpayment" validate:"min=0"`
+}
+
+type contractAnswerRequest struct {
+	ContractStateID int    `form:"contract_state_id" validate:"required,positive"`
+	QuestionID      int    `form:"question_id" validate:"required,positive"`
+	Answer          string `form:"answer" validate:"required"`
+}
+
+type contractDocumentRequest struct {
+	ContractStateID int `form:"contract_state_id" validate:"required,positive"`
+	DocumentID      int `form:"document_id" validate:"required,positive"`
+}
+
+type deleteAnswerRequest struct {
+	ID    int    `form:"id" validate:"required,positive"`
+	Table string `form:"table" validate:"required,oneof=contract_state_question_answer|contract_state_document"`
+}
+
+type contractStateRequest struct {
+	ContractID int    `form:"contract_id" validate:"required,positive"`
+	StateID    int    `form:"state_id" validate:"required,positive"`
+	Remarks    string `form:"remarks"`
+}
+
+type requestActionRequest struct {
+	Request int    `form:"request" validate:"required,positive"`
+	Action  string `form:"action" validate:"required,oneof=0|1"`
+	Note    string `form:"note"`
+}
+
+type commitmentActionRequest struct {
+	ID        int `form:"id" validate:"required,positive"`
+	Fulfilled int `form:"fulfilled" validate:"required,oneof=0|1"`
+}
+
+type amountRequest struct {
+	CID    int          `form:"cid" validate:"required,positive"`
+	Amount money.Amount `form:"amount" validate:"required,positive"`
+}
+
+type receiptRequest struct {
+	CID      int          `form:"cid" validate:"required,positive"`
+	Amount   money.Amount `form:"amount" validate:"required,positive"`
+	Notes    string       `form:"notes"`
+	DueDate  string       `form:"due_date"`
+	Checksum string       `form:"checksum"`
+}
+
+type receiptReverseRequest struct {
+	RID    int    `form:"rid" validate:"required,positive"`
+	Reason string `form:"reason" validate:"required,max=255"`
+}
+
+type settleRequest struct {
+	CID    int          `form:"cid" validate:"required,positive"`
+	Amount money.Amount `form:"amount" validate:"required,min=0"`
+}
+
+type rescheduleRequest struct {
+	CID                 int     `form:"cid" validate:"required,positive"`
+	Rate                float64 `form:"rate" validate:"required,min=0"`
+	Installments        int     `form:"installments" validate:"required,positive"`
+	InstallmentInterval int     `form:"installment_interval" validate:"required,positive"`
+	Method              string  `form:"method" validate:"required,oneof=S|R|R2|IRR|SM"`
+	InitiationDate      string  `form:"initiation_date" validate:"date"`
+}
+
+type debitNoteRequest struct {
+	ContractID                int          `form:"contract_id" validate:"required,positive"`
+	ContractInstallmentTypeID int          `form:"contract_installment_type_id" validate:"required,positive"`
+	Capital                   money.Amount `form:"capital" validate:"required,positive"`
+}
+
+type commitmentRequest struct {
+	ContractID     int    `form:"contract_id" validate:"required,positive"`
+	Text           string `form:"text" validate:"required"`
+	DueDate        string `form:"due_date"`
+	SpecialMessage bool   `form:"special_message"`
+}
+
+type legalCaseStatusRequest struct {
+	ContractID      int    `form:"contract_id" validate:"required,positive"`
+	LegalCaseStatus string `form:"legal_case_status" validate:"required"`
+}
+
+type temporaryOfficerRequest struct {
+	ContractID       int `form:"contract_id" validate:"required,positive"`
+	TemporaryOfficer int `form:"temporary_officer" validate:"required,positive"`
+}
+
+type calculationRequest struct {
+	Capital                 float64 `form:"capital" validate:"required,positive"`
+	Rate                    float64 `form:"rate" validate:"required,min=0"`
+	Installments            int     `form:"installments" validate:"positive"`
+	InstallmentInterval     int     `form:"installmentInterval" validate:"positive"`
+	InitiationDate          string  `form:"initiationDate" validate:"required,date"`
+	StructuredMonthlyRental int     `form:"structuredMonthlyRental" validate:"min=0"`
+	Method                  string  `form:"method" validate:"required,oneof=S|R|R2|IRR|SM|SP"`
+	ContractTypeID          int     `form:"contractTypeID" validate:"min=0"`
+	GracePeriods            int     `form:"gracePeriods" validate:"min=0"`
+	Grace                   string  `form:"grace" validate:"oneof=capital|interest_only"`
+	Balloon                 float64 `form:"balloon" validate:"min=0"`
+	// Plan holds the installments of a seasonal plan as YYYY-MM-DD:weight
+	Plan []string `form:"plan"`
+}
+
+func (req calculationRequest) terms() (loan.Terms, error) {
+	plan, err := loan.ParsePlan(req.Plan)
+	if err != nil {
+		return loan.Terms{}, models.NewFieldError(map[string]string{"plan": "must list installments as YYYY-MM-DD:weight"})
+	}
+
+	return loan.Terms{
+		Capital:                 req.Capital,
+		Rate:                    req.Rate,
+		Installments:            req.Installments,
+		InstallmentInterval:     req.InstallmentInterval,
+		StructuredMonthlyRental: req.StructuredMonthlyRental,
+		InitiationDate:          req.InitiationDate,
+		GracePeriods:            req.GracePeriods,
+		Grace:                   loan.Grace(req.Grace),
+		Balloon:                 req.Balloon,
+		Plan:                    plan,
+	}, nil
+}
+
+// compareRequest holds calculations to compare as a JSON list of objects
+// with the fields of calculationRequest. Other fields of the request apply
+// to every calculation that does not set them
+type compareRequest struct {
+	Scenarios     string       `form:"scenarios" validate:"required"`
+	MonthlyIncome money.Amount `form:"monthlyIncome" validate:"positive"`
+}
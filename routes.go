@@ -8,87 +8,187 @@ import (
 	"github.com/justinas/alice"
 )
 
+// apiPrefix is the path the current version of the API is served under
+const apiPrefix = "/api/v1"
+
+// apiRoute describes a route of the API. Routes are registered under
+// apiPrefix, at their legacy path as a deprecated alias, and documented in
+// the OpenAPI document
+type apiRoute struct {
+	Method string
+	// Path is the path of the route under apiPrefix. Routes with no path are
+	// only served at their legacy path
+	Path string
+	// Legacy is the unversioned path the route was first served at
+	Legacy string
+	// Successor is the path replacing a route with no path of its own
+	Successor string
+	Handler   http.HandlerFunc
+	// Permission is required of the user when set
+	Permission string
+	// Public routes are served without a token
+	Public  bool
+	Tag     string
+	Summary string
+	// Query lists the query parameters read by the handler
+	Query []string
+	// Params is a request struct decoded from the query string
+	Params interface{}
+	// Body is the request struct decoded from the body
+	Body interface{}
+	// File is the multipart field of an uploaded file
+	File string
+}
+
+// apiRoutes returns the routes of the API. Static paths are listed before
+// variable paths of the same length, as the first matching route is served
+func (app *application) apiRoutes() []apiRoute {
+	dropdown := []string{"q", "limit", "offset"}
+
+	return []apiRoute{
+		{Method: "POST", Path: "/sessions", Legacy: "/authenticate", Handler: app.authenticate, Public: true, Tag: "Sessions", Summary: "Sign in", Body: authenticateRequest{}},
+		{Method: "POST", Path: "/sessions/refresh", Legacy: "/authenticate/refresh", Handler: app.authenticateRefresh, Public: true, Tag: "Sessions", Summary: "Exchange a refresh token for a new session", Body: refreshRequest{}},
+		{Method: "POST", Path: "/sessions/revoke", Legacy: "/logout", Handler: app.logout, Tag: "Sessions", Summary: "Sign out of the current or every session", Body: logoutRequest{}},
+
+		{Method: "GET", Path: "/dropdowns/{name}", Legacy: "/dropdown/{name}", Handler: app.dropdownHandler, Tag: "Dropdowns", Summary: "List a dropdown", Query: dropdown},
+		{Method: "GET", Path: "/dropdowns/{name}/{where}/{value}", Legacy: "/dropdown/condition/{name}/{where}/{value}", Handler: app.dropdownConditionHandler, Tag: "Dropdowns", Summary: "List a dropdown filtered by a column", Query: dropdown},
+		{Method: "GET", Path: "/dropdowns/accounts/{name}/{where}/{value}", Legacy: "/dropdown/condition/accounts/{name}/{where}/{value}", Handler: app.dropdownConditionAccountsHandler, Tag: "Dropdowns", Summary: "List a chart of accounts dropdown filtered by a column", Query: dropdown},
+
+		{Method: "POST", Path: "/account-categories", Legacy: "/account/category/new", Handler: app.newAccountCategory, Permission: permAccounting, Tag: "Accounts", Summary: "Create an account category", Body: accountCategoryRequest{}},
+		{Method: "POST", Path: "/accounts", Legacy: "/account/new", Handler: app.newAccount, Permission: permAccounting, Tag: "Accounts", Summary: "Create an account", Body: accountRequest{}},
+		{Method: "GET", Path: "/accounts/chart", Legacy: "/account/chart", Handler: app.accountChart, Permission: permAccounting, Tag: "Accounts", Summary: "Chart of accounts"},
+		{Method: "GET", Path: "/accounts/trial-balance", Legacy: "/account/trialbalance", Handler: app.accountTrialBalance, Permission: permAccounting, Tag: "Accounts", Summary: "Trial balance", Query: []string{"postingdate"}},
+		{Method: "GET", Path: "/accounts/{aid}/ledger", Legacy: "/account/ledger/{aid}", Handler: app.accountLedger, Permission: permAccounting, Tag: "Accounts", Summary: "Ledger of an account"},
+		{Method: "POST", Path: "/journal-entries", Legacy: "/account/journalentry", Handler: app.accountJournalEntry, Permission: permAccounting, Tag: "Accounts", Summary: "Post a journal entry", Body: journalEntryRequest{}},
+		{Method: "GET", Path: "/journal-entries/audit", Legacy: "/account/journalentryaudit", Handler: app.journalEntryAudit, Permission: permAccounting, Tag: "Accounts", Summary: "Journal entries for audit", Query: []string{"entrydate", "postingdate"}},
+		{Method: "GET", Path: "/payment-vouchers", Legacy: "/paymentvouchers", Handler: app.paymentVouchers, Permission: permAccounting, Tag: "Accounts", Summary: "List payment vouchers"},
+		{Method: "POST", Path: "/payment-vouchers", Legacy: "/account/paymentvoucher", Handler: app.accountPaymentVoucher, Permission: permAccounting, Tag: "Accounts", Summary: "Issue a payment voucher", Body: paymentVoucherRequest{}},
+		{Method: "GET", Path: "/payment-vouchers/{pid}", Legacy: "/paymentvoucher/{pid}", Handler: app.paymentVoucherDetails, Permission: permAccounting, Tag: "Accounts", Summary: "Payment voucher details"},
+		{Method: "POST", Path: "/deposits", Legacy: "/account/deposit", Handler: app.accountDeposit, Permission: permAccounting, Tag: "Accounts", Summary: "Record a deposit", Body: depositRequest{}},
+		{Method: "GET", Path: "/transactions/{tid}", Legacy: "/transaction/{tid}", Handler: app.accountTransaction, Permission: permAccounting, Tag: "Accounts", Summary: "Transaction details"},
+
+		{Method: "GET", Path: "/reports/account-balances", Legacy: "/account/balancesforreporting", Handler: app.accountBalancesForReporting, Permission: permReporting, Tag: "Reports", Summary: "Account balances", Query: []string{"postingdate"}},
+		{Method: "GET", Path: "/reports/balance-sheet", Legacy: "/account/balancesheetsummary", Handler: app.balanceSheetSummary, Permission: permReporting, Tag: "Reports", Summary: "Balance sheet summary", Query: []string{"postingdate"}},
+		{Method: "GET", Path: "/reports/profit-and-loss", Legacy: "/account/pnlsummary", Handler: app.pnlSummary, Permission: permReporting, Tag: "Reports", Summary: "Profit and loss summary", Query: []string{"startdate", "enddate"}},
+		{Method: "GET", Path: "/reports/arrears-analysis", Legacy: "/reporting/arrearsanalysis", Handler: app.arrearsAnalysis, Permission: permReporting, Tag: "Reports", Summary: "Arrears analysis", Query: []string{"startdate", "enddate"}},
+		{Method: "GET", Path: "/reports/achievement-summary", Legacy: "/reporting/achievementsummary", Handler: app.achievementSummary, Permission: permReporting, Tag: "Reports", Summary: "Achievement summary"},
+		{Method: "GET", Path: "/reports/credit-achievement-summary", Legacy: "/reporting/creditachievementsummary", Handler: app.creditAchievementSummary, Permission: permReporting, Tag: "Reports", Summary: "Credit achievement summary"},
+		{Method: "GET", Path: "/reports/receipts", Legacy: "/reporting/receiptsearch", Handler: app.receiptSearch, Permission: permReporting, Tag: "Reports", Summary: "Search receipts", Query: []string{"startdate", "enddate", "officer"}},
+		{Method: "GET", Path: "/reports/performance-review", Legacy: "/contract/performancereview", Handler: app.performanceReview, Permission: permReporting, Tag: "Reports", Summary: "Performance review", Query: []string{"startdate", "enddate", "state", "officer", "batch", "npl"}},
+		{Method: "GET", Path: "/eod-runs", Legacy: "/eod/runs", Handler: app.eodRuns, Permission: permReporting, Tag: "Reports", Summary: "Recent end of day runs", Query: []string{"limit"}},
+
+		{Method: "GET", Path: "/contracts", Legacy: "/contract/searchv2", Handler: app.searchContractV2, Tag: "Contracts", Summary: "Search contracts", Query: []string{"searchtype", "search", "state", "officer", "batch", "npl", "lkas17", "external", "startod", "endod", "legalcasestatus"}},
+		{Method: "GET", Legacy: "/contract/search", Successor: "/contracts", Handler: app.searchContractOld},
+		{Method: "GET", Legacy: "/contract/searchnew", Successor: "/contracts", Handler: app.searchContract},
+		{Method: "GET", Path: "/contracts/lkas17", Legacy: "/contract/lkas17searchv2", Handler: app.lkas17SearchContractV2, Tag: "Contracts", Summary: "Search contracts under LKAS 17", Query: []string{"searchtype", "search", "state", "officer", "batch", "recoverystatus", "legalcasestatus"}},
+		{Method: "GET", Path: "/contracts/csqa", Legacy: "/contract/csqasearch", Handler: app.csqaSearchContract, Tag: "Contracts", Summary: "Search contracts by state question answers", Query: []string{"search", "question", "empty"}},
+		{Method: "POST", Path: "/contracts", Legacy: "/contract/new", Handler: app.newContract, Tag: "Contracts", Summary: "Create a contract", Body: contractRequest{}},
+		{Method: "POST", Path: "/contracts/legacy", Legacy: "/contract/legacy/new", Handler: app.newLegacyContract, Tag: "Contracts", Summary: "Create an active contract migrated from a legacy system", Body: legacyContractRequest{}},
+		{Method: "GET", Path: "/contracts/{cid}", Legacy: "/contract/details/{cid}", Handler: app.contractDetails, Tag: "Contracts", Summary: "Contract details"},
+		{Method: "GET", Path: "/contracts/{cid}/financial", Legacy: "/contract/detailfinancial/{cid}", Handler: app.contractDetailFinancial, Tag: "Contracts", Summary: "Financial summary of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/financial/raw", Legacy: "/contract/detailfinancialraw/{cid}", Handler: app.contractDetailFinancialRaw, Tag: "Contracts", Summary: "Unformatted financial summary of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/financial/legacy-raw", Legacy: "/contract/detaillegacyfinancialraw/{cid}", Handler: app.contractDetailLegacyFinancialRaw, Tag: "Contracts", Summary: "Unformatted financial summary of a legacy contract"},
+		{Method: "GET", Path: "/contracts/{cid}/installments", Legacy: "/contract/installments/{cid}", Handler: app.contractInstallments, Tag: "Contracts", Summary: "Installments of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/receipts", Legacy: "/contract/receiptsv2/{cid}", Handler: app.contractReceiptsV2, Tag: "Contracts", Summary: "Receipts of a contract"},
+		{Method: "GET", Legacy: "/contract/receipts/{cid}", Successor: "/contracts/{cid}/receipts", Handler: app.contractReceipts},
+		{Method: "GET", Path: "/contracts/{cid}/receipts/float", Legacy: "/contract/receipts/float/{cid}", Handler: app.contractFloatReceipts, Tag: "Contracts", Summary: "Receipts of a contract held in float"},
+		{Method: "GET", Path: "/contracts/{cid}/receipts/preview/{amount}", Legacy: "/contract/receipt/preview/{cid}/{amount}", Handler: app.contractReceiptPreview, Permission: permReceipts, Tag: "Receipts", Summary: "Preview the allocation of a receipt"},
+		{Method: "GET", Path: "/contracts/{cid}/questions", Legacy: "/contract/questions/{cid}", Handler: app.contractQuestions, Tag: "Contracts", Summary: "Answered state questions of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/documents", Legacy: "/contract/documents/{cid}", Handler: app.contractDocuments, Tag: "Contracts", Summary: "Uploaded state documents of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/work/questions", Legacy: "/contract/work/questions/{cid}", Handler: app.workQuestions, Tag: "Contracts", Summary: "Questions of the current state of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/work/documents", Legacy: "/contract/work/documents/{cid}", Handler: app.workDocuments, Tag: "Contracts", Summary: "Documents of the current state of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/history", Legacy: "/contract/history/{cid}", Handler: app.contractHistory, Tag: "Contracts", Summary: "State history of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/requestability", Legacy: "/contract/requestability/{cid}", Handler: app.contractRequestability, Tag: "Contracts", Summary: "States a contract may be requested to move to"},
+		{Method: "GET", Path: "/contracts/{cid}/state-documents", Legacy: "/contract/statedocgen/{cid}", Handler: app.contractStateDocGen, Tag: "Contracts", Summary: "Generated documents of the current state of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/micro-loan", Legacy: "/contract/microloandetails/{cid}", Handler: app.contractMicroLoanDetails, Tag: "Contracts", Summary: "Micro loan details of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/settlement", Legacy: "/contract/settlement/{cid}", Handler: app.contractSettlement, Tag: "Contracts", Summary: "Settlement quote of a contract", Query: []string{"date"}},
+		{Method: "GET", Path: "/contracts/{cid}/notifications", Legacy: "/contract/notifications/{cid}", Handler: app.contractNotifications, Tag: "Contracts", Summary: "Notifications sent for a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/commitments", Legacy: "/contract/commitments/{cid}", Handler: app.contractCommitments, Tag: "Contracts", Summary: "Commitments of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/timeline", Legacy: "/contract/timeline/{cid}", Handler: app.contractTimeline, Tag: "Contracts", Summary: "Timeline of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/temporary-assignment", Legacy: "/contract/temporaryassignment/{cid}", Handler: app.contractTemporaryAssignment, Tag: "Contracts", Summary: "Temporary officer of a contract"},
+		{Method: "GET", Path: "/contracts/{cid}/legal-case-status", Legacy: "/contract/legalcasestatus/{cid}", Handler: app.contractLegalCaseStatus, Tag: "Contracts", Summary: "Legal case status of a contract"},
+		{Method: "POST", Path: "/contract-answers", Legacy: "/contract/answer", Handler: app.contractAnswer, Tag: "Contracts", Summary: "Answer a state question", Body: contractAnswerRequest{}},
+		{Method: "POST", Path: "/contract-documents", Legacy: "/contract/document", Handler: app.contractDocument, Tag: "Contracts", Summary: "Upload a state document", Body: contractDocumentRequest{}, File: "source"},
+		{Method: "GET", Path: "/contract-documents/download", Legacy: "/contract/document/download", Handler: app.contractDocumentDownload, Tag: "Contracts", Summary: "Download a state document", Query: []string{"bucket", "region", "source"}},
+		{Method: "POST", Path: "/contract-states/delete", Legacy: "/contract/state/delete", Handler: app.deleteAnswer, Tag: "Contracts", Summary: "Delete a state answer or document", Body: deleteAnswerRequest{}},
+		{Method: "POST", Path: "/contract-requests", Legacy: "/contract/request", Handler: app.contractRequest, Tag: "Contracts", Summary: "Request a contract to move to a state", Body: contractStateRequest{}},
+		{Method: "POST", Path: "/contract-requests/actions", Legacy: "/contract/request/action", Handler: app.contractRequestAction, Permission: permRequestApproval, Tag: "Contracts", Summary: "Approve or reject a state request", Body: requestActionRequest{}},
+		{Method: "POST", Path: "/contract-officers/temporary", Legacy: "/contract/settemporaryofficer", Handler: app.contractSetTemporaryOfficer, Permission: permRecovery, Tag: "Contracts", Summary: "Assign a temporary officer to a contract", Body: temporaryOfficerRequest{}},
+		{Method: "POST", Path: "/legal-case-statuses", Legacy: "/contract/setlegalcasestatus", Handler: app.contractSetLegalCaseStatus, Permission: permRecovery, Tag: "Contracts", Summary: "Set the legal case status of a contract", Body: legalCaseStatusRequest{}},
+		{Method: "POST", Path: "/commitments", Legacy: "/contract/commitment", Handler: app.contractCommitment, Tag: "Contracts", Summary: "Record a commitment or comment", Body: commitmentRequest{}},
+		{Method: "POST", Path: "/commitments/actions", Legacy: "/contract/commitment/action", Handler: app.contractCommitmentAction, Permission: permRecovery, Tag: "Contracts", Summary: "Mark a commitment fulfilled or broken", Body: commitmentActionRequest{}},
+		{Method: "GET", Path: "/products", Handler: app.loanProducts, Tag: "Contracts", Summary: "Loan products offered per contract type"},
+		{Method: "POST", Path: "/calculation/compare", Legacy: "/contract/calculation/compare", Handler: app.contractCalculationCompare, Tag: "Contracts", Summary: "Compare the disclosed cost and affordability of calculations", Body: compareRequest{}},
+		{Method: "GET", Path: "/calculation", Handler: app.contractCalculation, Tag: "Contracts", Summary: "Calculate and disclose the cost of a loan schedule", Params: calculationRequest{}},
+		{Method: "GET", Legacy: "/contract/calculation/{capital}/{rate}/{installments}/{installmentInterval}/{initiationDate}/{method}/{structuredMonthlyRental}", Successor: "/calculation", Handler: app.contractCalculationLegacy},
+
+		{Method: "POST", Path: "/receipts", Legacy: "/contract/receipt", Handler: app.contractReceipt, Permission: permReceipts, Tag: "Receipts", Summary: "Issue a receipt", Body: receiptRequest{}},
+		{Method: "POST", Path: "/receipts/legacy", Legacy: "/contract/receipt/legacy", Handler: app.contractReceiptLegacy, Permission: permReceipts, Tag: "Receipts", Summary: "Issue a receipt on a legacy contract", Body: receiptRequest{}},
+		{Method: "POST", Path: "/receipts/import", Legacy: "/contract/receipts/import", Handler: app.contractReceiptImport, Permission: permReceipts, Tag: "Receipts", Summary: "Import receipts from a CSV file", File: "file"},
+		{Method: "POST", Path: "/receipts/reversals", Legacy: "/contract/receipt/reverse", Handler: app.contractReceiptReverse, Permission: permReceiptReversal, Tag: "Receipts", Summary: "Reverse a receipt", Body: receiptReverseRequest{}},
+		{Method: "GET", Path: "/receipts/officer/{officer}/{date}", Legacy: "/contract/receipts/officer/{officer}/{date}", Handler: app.contractOfficerReceipts, Permission: permReceipts, Tag: "Receipts", Summary: "Receipts issued by an officer on a date"},
+		{Method: "POST", Path: "/settlements", Legacy: "/contract/settle", Handler: app.contractSettle, Permission: permRebates, Tag: "Receipts", Summary: "Settle a contract", Body: settleRequest{}},
+		{Method: "POST", Path: "/rebates/legacy", Legacy: "/contract/legacyrebate", Handler: app.contractLegacyRebate, Permission: permRebates, Tag: "Receipts", Summary: "Grant a rebate on a legacy contract", Body: amountRequest{}},
+		{Method: "POST", Path: "/rebates/lkas17", Legacy: "/contract/lkas17rebate", Handler: app.contractLKAS17LegacyRebate, Permission: permRebates, Tag: "Receipts", Summary: "Grant a rebate on an LKAS 17 contract", Body: amountRequest{}},
+		{Method: "POST", Path: "/reschedules", Legacy: "/contract/reschedule", Handler: app.contractReschedule, Permission: permRestructuring, Tag: "Receipts", Summary: "Reschedule the outstanding capital of a contract", Body: rescheduleRequest{}},
+		{Method: "POST", Path: "/debit-notes", Legacy: "/contract/debitnote", Handler: app.contractDebitNote, Permission: permDebitNotes, Tag: "Receipts", Summary: "Issue a debit note", Body: debitNoteRequest{}},
+
+		{Method: "GET", Path: "/dashboard/commitments/{type}", Legacy: "/dashboard/commitments/{type}", Handler: app.dashboardCommitments, Tag: "Dashboard", Summary: "Commitments due"},
+		{Method: "GET", Path: "/dashboard/commitments/{type}/{officer}", Legacy: "/dashboard/commitments/{type}/{officer}", Handler: app.dashboardCommitmentsByOfficer, Tag: "Dashboard", Summary: "Commitments due of an officer"},
+
+		{Method: "GET", Path: "/users", Legacy: "/user/all", Handler: app.users, Permission: permUserAdmin, Tag: "Users", Summary: "List users"},
+		{Method: "POST", Path: "/users", Legacy: "/user/new", Handler: app.newUser, Permission: permUserAdmin, Tag: "Users", Summary: "Create a user", Body: newUserRequest{}},
+		{Method: "POST", Path: "/users/disable", Legacy: "/user/disable", Handler: app.userDisable, Permission: permUserAdmin, Tag: "Users", Summary: "Disable a user and revoke their sessions", Body: userRequest{}},
+		{Method: "POST", Path: "/users/enable", Legacy: "/user/enable", Handler: app.userEnable, Permission: permUserAdmin, Tag: "Users", Summary: "Enable a user", Body: userRequest{}},
+		{Method: "POST", Path: "/users/password-reset", Legacy: "/user/password/reset", Handler: app.userPasswordReset, Permission: permUserAdmin, Tag: "Users", Summary: "Reset the password of a user", Body: userPasswordResetRequest{}},
+		{Method: "POST", Path: "/users/access-keys", Legacy: "/user/accesskeys", Handler: app.userAccessKeys, Permission: permUserAdmin, Tag: "Users", Summary: "Replace the access keys of a user", Body: userAccessKeysRequest{}},
+		{Method: "POST", Path: "/users/group", Legacy: "/user/group", Handler: app.userGroup, Permission: permUserAdmin, Tag: "Users", Summary: "Move a user to a group", Body: userGroupRequest{}},
+		{Method: "POST", Path: "/users/unlock", Legacy: "/user/unlock", Handler: app.userUnlock, Permission: permUserAdmin, Tag: "Users", Summary: "Clear the login throttle of a user", Body: userUnlockRequest{}},
+		{Method: "POST", Path: "/users/totp-reset", Legacy: "/user/totp/reset", Handler: app.userTOTPReset, Permission: permUserAdmin, Tag: "Users", Summary: "Remove the two-factor enrolment of a user", Body: userRequest{}},
+		{Method: "GET", Path: "/users/{uid}/contract-requests", Legacy: "/contract/requests/{uid}", Handler: app.contractRequests, Tag: "Users", Summary: "State requests awaiting a user"},
+		{Method: "GET", Path: "/users/{uid}/seasonal-incentive", Legacy: "/seasonalincentive/{uid}", Handler: app.contractSeasonalIncentive, Tag: "Users", Summary: "Seasonal incentive of a user"},
+		{Method: "POST", Path: "/me/password", Legacy: "/user/password", Handler: app.userPassword, Tag: "Users", Summary: "Change your password", Body: userPasswordRequest{}},
+		{Method: "POST", Path: "/me/totp/enrol", Legacy: "/user/totp/enrol", Handler: app.userTOTPEnrol, Tag: "Users", Summary: "Start two-factor enrolment"},
+		{Method: "POST", Path: "/me/totp/enable", Legacy: "/user/totp/enable", Handler: app.userTOTPEnable, Tag: "Users", Summary: "Confirm two-factor enrolment", Body: totpCodeRequest{}},
+		{Method: "POST", Path: "/me/totp/disable", Legacy: "/user/totp/disable", Handler: app.userTOTPDisable, Tag: "Users", Summary: "Remove your two-factor enrolment", Body: totpCodeRequest{}},
+	}
+}
+
 func (app *application) routes() http.Handler {
 	standardMiddleware := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
 
 	r := mux.NewRouter()
 	r.Handle("/", http.HandlerFunc(app.home)).Methods("GET")
-	r.Handle("/dropdown/{name}", app.validateToken(http.HandlerFunc(app.dropdownHandler))).Methods("GET")
-	r.Handle("/dropdown/condition/{name}/{where}/{value}", app.validateToken(http.HandlerFunc(app.dropdownConditionHandler))).Methods("GET")
-	r.Handle("/dropdown/condition/accounts/{name}/{where}/{value}", app.validateToken(http.HandlerFunc(app.dropdownConditionAccountsHandler))).Methods("GET")
-	r.Handle("/account/category/new", app.validateToken(http.HandlerFunc(app.newAccountCategory))).Methods("POST")
-	r.Handle("/account/new", app.validateToken(http.HandlerFunc(app.newAccount))).Methods("POST")
-	r.Handle("/account/chart", app.validateToken(http.HandlerFunc(app.accountChart))).Methods("GET")
-	r.Handle("/account/journalentry", app.validateToken(http.HandlerFunc(app.accountJournalEntry))).Methods("POST")
-	r.Handle("/account/paymentvoucher", app.validateToken(http.HandlerFunc(app.accountPaymentVoucher))).Methods("POST")
-	r.Handle("/account/deposit", app.validateToken(http.HandlerFunc(app.accountDeposit))).Methods("POST")
-	r.Handle("/account/trialbalance", app.validateToken(http.HandlerFunc(app.accountTrialBalance))).Methods("GET")
-	r.Handle("/account/ledger/{aid}", app.validateToken(http.HandlerFunc(app.accountLedger))).Methods("GET")
-	r.Handle("/account/journalentryaudit", app.validateToken(http.HandlerFunc(app.journalEntryAudit))).Methods("GET")
-	r.Handle("/account/balancesforreporting", app.validateToken(http.HandlerFunc(app.accountBalancesForReporting))).Methods("GET")
-	r.Handle("/account/balancesheetsummary", app.validateToken(http.HandlerFunc(app.balanceSheetSummary))).Methods("GET")
-	r.Handle("/account/pnlsummary", app.validateToken(http.HandlerFunc(app.pnlSummary))).Methods("GET")
-	r.Handle("/transaction/{tid}", app.validateToken(http.HandlerFunc(app.accountTransaction))).Methods("GET")
-	r.Handle("/contract/search", app.validateToken(http.HandlerFunc(app.searchContractOld))).Methods("GET")
-	r.Handle("/contract/searchv2", app.validateToken(http.HandlerFunc(app.searchContractV2))).Methods("GET")
-	r.Handle("/contract/lkas17searchv2", app.validateToken(http.HandlerFunc(app.lkas17SearchContractV2))).Methods("GET")
-	r.Handle("/contract/performancereview", app.validateToken(http.HandlerFunc(app.performanceReview))).Methods("GET")
-	r.Handle("/contract/searchnew", app.validateToken(http.HandlerFunc(app.searchContract))).Methods("GET")
-	r.Handle("/contract/csqasearch", app.validateToken(http.HandlerFunc(app.csqaSearchContract))).Methods("GET")
-	r.HandleFunc("/authenticate", http.HandlerFunc(app.authenticate)).Methods("POST")
-	r.Handle("/contract/new", app.validateToken(http.HandlerFunc(app.newContract))).Methods("POST")
-	r.Handle("/contract/legacy/new", app.validateToken(http.HandlerFunc(app.newLegacyContract))).Methods("POST")
-	r.Handle("/contract/work/documents/{cid}", app.validateToken(http.HandlerFunc(app.workDocuments))).Methods("GET")
-	r.Handle("/contract/work/questions/{cid}", app.validateToken(http.HandlerFunc(app.workQuestions))).Methods("GET")
-	r.Handle("/contract/questions/{cid}", app.validateToken(http.HandlerFunc(app.contractQuestions))).Methods("GET")
-	r.Handle("/contract/documents/{cid}", app.validateToken(http.HandlerFunc(app.contractDocuments))).Methods("GET")
-	r.Handle("/contract/history/{cid}", app.validateToken(http.HandlerFunc(app.contractHistory))).Methods("GET")
-	r.Handle("/contract/answer", app.validateToken(http.HandlerFunc(app.contractAnswer))).Methods("POST")
-	r.Handle("/contract/document", app.validateToken(http.HandlerFunc(app.contractDocument))).Methods("POST")
-	r.Handle("/contract/document/download", app.validateToken(http.HandlerFunc(app.contractDocumentDownload))).Methods("GET")
-	r.Handle("/contract/state/delete", app.validateToken(http.HandlerFunc(app.deleteAnswer))).Methods("POST")
-	r.Handle("/contract/details/{cid}", app.validateToken(http.HandlerFunc(app.contractDetails))).Methods("GET")
-	r.Handle("/contract/detailfinancial/{cid}", app.validateToken(http.HandlerFunc(app.contractDetailFinancial))).Methods("GET")
-	r.Handle("/contract/detailfinancialraw/{cid}", app.validateToken(http.HandlerFunc(app.contractDetailFinancialRaw))).Methods("GET")
-	r.Handle("/contract/detaillegacyfinancialraw/{cid}", app.validateToken(http.HandlerFunc(app.contractDetailLegacyFinancialRaw))).Methods("GET")
-	r.Handle("/contract/installments/{cid}", app.validateToken(http.HandlerFunc(app.contractInstallments))).Methods("GET")
-	r.Handle("/contract/receipts/{cid}", app.validateToken(http.HandlerFunc(app.contractReceipts))).Methods("GET")
-	r.Handle("/contract/receipts/float/{cid}", app.validateToken(http.HandlerFunc(app.contractFloatReceipts))).Methods("GET")
-	r.Handle("/contract/receiptsv2/{cid}", app.validateToken(http.HandlerFunc(app.contractReceiptsV2))).Methods("GET")
-	r.Handle("/contract/receipts/officer/{officer}/{date}", app.validateToken(http.HandlerFunc(app.contractOfficerReceipts))).Methods("GET")
-	r.Handle("/contract/requestability/{cid}", app.validateToken(http.HandlerFunc(app.contractRequestability))).Methods("GET")
-	r.Handle("/contract/statedocgen/{cid}", app.validateToken(http.HandlerFunc(app.contractStateDocGen))).Methods("GET")
-	r.Handle("/contract/microloandetails/{cid}", app.validateToken(http.HandlerFunc(app.contractMicroLoanDetails))).Methods("GET")
-	r.Handle("/contract/request", app.validateToken(http.HandlerFunc(app.contractRequest))).Methods("POST")
-	r.Handle("/contract/requests/{uid}", app.validateToken(http.HandlerFunc(app.contractRequests))).Methods("GET")
-	r.Handle("/seasonalincentive/{uid}", app.validateToken(http.HandlerFunc(app.contractSeasonalIncentive))).Methods("GET")
-	r.Handle("/contract/request/action", app.validateToken(http.HandlerFunc(app.contractRequestAction))).Methods("POST")
-	r.Handle("/contract/calculation/{capital}/{rate}/{installments}/{installmentInterval}/{initiationDate}/{method}/{structuredMonthlyRental}", app.validateToken(http.HandlerFunc(app.contractCalculation))).Methods("GET")
-	r.Handle("/contract/receipt", app.validateToken(http.HandlerFunc(app.contractReceipt))).Methods("POST")
-	r.Handle("/contract/legacyrebate", app.validateToken(http.HandlerFunc(app.contractLegacyRebate))).Methods("POST")
-	r.Handle("/contract/lkas17rebate", app.validateToken(http.HandlerFunc(app.contractLKAS17LegacyRebate))).Methods("POST")
-	r.Handle("/contract/debitnote", app.validateToken(http.HandlerFunc(app.contractDebitNote))).Methods("POST")
-	r.Handle("/contract/commitment", app.validateToken(http.HandlerFunc(app.contractCommitment))).Methods("POST")
-	r.Handle("/contract/commitments/{cid}", app.validateToken(http.HandlerFunc(app.contractCommitments))).Methods("GET")
-	r.Handle("/contract/timeline/{cid}", app.validateToken(http.HandlerFunc(app.contractTimeline))).Methods("GET")
-	r.Handle("/dashboard/commitments/{type}", app.validateToken(http.HandlerFunc(app.dashboardCommitments))).Methods("GET")
-	r.Handle("/dashboard/commitments/{type}/{officer}", app.validateToken(http.HandlerFunc(app.dashboardCommitmentsByOfficer))).Methods("GET")
-	r.Handle("/contract/receipt/legacy", app.validateToken(http.HandlerFunc(app.contractReceiptLegacy))).Methods("POST")
-	r.Handle("/contract/commitment/action", app.validateToken(http.HandlerFunc(app.contractCommitmentAction))).Methods("POST")
-	r.Handle("/contract/temporaryassignment/{cid}", app.validateToken(http.HandlerFunc(app.contractTemporaryAssignment))).Methods("GET")
-	r.Handle("/contract/settemporaryofficer", app.validateToken(http.HandlerFunc(app.contractSetTemporaryOfficer))).Methods("POST")
-	r.Handle("/contract/legalcasestatus/{cid}", app.validateToken(http.HandlerFunc(app.contractLegalCaseStatus))).Methods("GET")
-	r.Handle("/contract/setlegalcasestatus", app.validateToken(http.HandlerFunc(app.contractSetLegalCaseStatus))).Methods("POST")
-	r.Handle("/paymentvouchers", app.validateToken(http.HandlerFunc(app.paymentVouchers))).Methods("GET")
-	r.Handle("/paymentvoucher/{pid}", app.validateToken(http.HandlerFunc(app.paymentVoucherDetails))).Methods("GET")
-
-	r.Handle("/reporting/arrearsanalysis", app.validateToken(http.HandlerFunc(app.arrearsAnalysis))).Methods("GET")
-	r.Handle("/reporting/achievementsummary", app.validateToken(http.HandlerFunc(app.achievementSummary))).Methods("GET")
-	r.Handle("/reporting/creditachievementsummary", app.validateToken(http.HandlerFunc(app.creditAchievementSummary))).Methods("GET")
-	r.Handle("/reporting/receiptsearch", app.validateToken(http.HandlerFunc(app.receiptSearch))).Methods("GET")
+
+	apiRoutes := app.apiRoutes()
+	for _, route := range apiRoutes {
+		h := app.routeHandler(route)
+		successor := route.Successor
+		if route.Path != "" {
+			r.Handle(apiPrefix+route.Path, h).Methods(route.Method)
+			successor = route.Path
+		}
+		if route.Legacy != "" {
+			r.Handle(route.Legacy, deprecated(apiPrefix+successor, h)).Methods(route.Method)
+		}
+	}
+	r.Handle(apiPrefix+"/openapi.json", openAPIHandler(newOpenAPIDocument(apiRoutes))).Methods("GET")
 
 	fileServer := http.FileServer(http.Dir("./ui/static/"))
 	r.Handle("/static/", http.StripPrefix("/static", fileServer))
 
 	return standardMiddleware.Then(handlers.CORS(handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}), handlers.AllowedMethods([]string{"GET", "POST", "PUT", "HEAD", "OPTIONS"}), handlers.AllowedOrigins([]string{"*"}))(r))
 }
+
+// routeHandler wraps the handler of a route in the token and permission
+// checks it requires
+func (app *application) routeHandler(route apiRoute) http.Handler {
+	var h http.Handler = route.Handler
+	if route.Permission != "" {
+		h = app.requirePermission(route.Permission, h)
+	}
+	if !route.Public {
+		h = app.validateToken(h)
+	}
+	return h
+}